@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// maxPreviewSize is the number of bytes of each value shown by the
+	// admin key listing
+	maxPreviewSize = 64
+
+	// defaultKeysLimit is the number of keys listed per page by default
+	defaultKeysLimit = 100
+
+	// maxKeysLimit is the maximum number of keys listed per page
+	maxKeysLimit = 1000
+)
+
+// redactedPrefixes are the key prefixes whose values are secrets and never
+// previewed: API keys and tokens, users with their password hashes and the
+// secret feed tokens are signed with
+var redactedPrefixes = []string{apiKeyPrefix, tokenPrefix, "users_", feedSecretKey}
+
+type keyInfo struct {
+	Key     string `json:"key"`
+	Size    int    `json:"size"`
+	Preview string `json:"preview"`
+}
+
+type keysPage struct {
+	Keys []keyInfo `json:"keys"`
+	Next string    `json:"next,omitempty"`
+}
+
+// isText reports whether value is printable UTF-8 text
+func isText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// preview returns the start of a value for display, as text if it is
+// printable and hex encoded otherwise
+func preview(key string, value []byte) string {
+	for _, prefix := range redactedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return "[redacted]"
+		}
+	}
+
+	truncated := len(value) > maxPreviewSize
+	if truncated {
+		value = value[:maxPreviewSize]
+	}
+
+	var s string
+	if isText(value) {
+		s = string(value)
+	} else {
+		s = "0x" + hex.EncodeToString(value)
+	}
+	if truncated {
+		s += "…"
+	}
+	return s
+}
+
+// KeysHandler lists the raw keys of the database with their size and a
+// preview of their value for debugging. Keys are ordered and paginated
+// like todos: ?after=<key> returns the keys following the given key.
+func (s *server) KeysHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_admin_keys")
+
+		q := r.URL.Query()
+		after := q.Get("after")
+
+		limit := defaultKeysLimit
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+				return
+			}
+			if n > maxKeysLimit {
+				n = maxKeysLimit
+			}
+			limit = n
+		}
+
+		var keys []string
+		err := s.db.Fold(func(key []byte) error {
+			if string(key) > after {
+				keys = append(keys, string(key))
+			}
+			return nil
+		})
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing keys")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		sort.Strings(keys)
+
+		page := keysPage{Keys: []keyInfo{}}
+		if len(keys) > limit {
+			keys = keys[:limit]
+			page.Next = keys[limit-1]
+		}
+
+		for _, key := range keys {
+			value, err := s.db.Get([]byte(key))
+			if err != nil {
+				// Deleted since it was listed
+				continue
+			}
+			page.Keys = append(page.Keys, keyInfo{Key: key, Size: len(value), Preview: preview(key, value)})
+		}
+
+		writeJSON(w, r, http.StatusOK, page)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type analyticsResponse struct {
+	Total   int `json:"total"`
+	Done    int `json:"done"`
+	Pending int `json:"pending"`
+	Overdue int `json:"overdue"`
+
+	// CompletionRate is the fraction of todos that are done
+	CompletionRate float64 `json:"completion_rate"`
+
+	// AvgTimeToComplete is the average number of seconds between a todo
+	// being created and completed, over the done todos whose completion
+	// time is known
+	AvgTimeToComplete float64 `json:"avg_time_to_complete"`
+
+	Tags map[string]int `json:"tags"`
+}
+
+// AnalyticsHandler returns statistics about the todos, filtered like the
+// index, for dashboards. HTTP statistics remain on /debug/stats.
+func (s *server) AnalyticsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_analytics")
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, _, err := s.loadTodos(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := analyticsResponse{Tags: make(map[string]int)}
+
+		var (
+			completed  int
+			timeToDone time.Duration
+			now        = time.Now()
+		)
+		for _, todo := range filterTodos(todoList, filters) {
+			res.Total++
+			if todo.Done {
+				res.Done++
+				if !todo.CompletedAt.IsZero() {
+					completed++
+					timeToDone += todo.CompletedAt.Sub(todo.CreatedAt)
+				}
+			} else {
+				res.Pending++
+			}
+			if todo.isOverdue(now) {
+				res.Overdue++
+			}
+			for _, tag := range todo.Tags {
+				res.Tags[tag]++
+			}
+		}
+
+		if res.Total > 0 {
+			res.CompletionRate = float64(res.Done) / float64(res.Total)
+		}
+		if completed > 0 {
+			res.AvgTimeToComplete = (timeToDone / time.Duration(completed)).Seconds()
+		}
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
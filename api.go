@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+const (
+	// defaultPageLimit is the number of todos returned per page by default
+	defaultPageLimit = 20
+
+	// maxPageLimit is the maximum number of todos returned per page
+	maxPageLimit = 100
+
+	// maxRequestSize bounds the size of JSON request bodies
+	maxRequestSize = 1 << 20
+)
+
+// writeJSON writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		requestLog(r).WithError(err).Error("error marshaling response")
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	setNoCache(w)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// wantsJSON reports whether the request was made by a script expecting a
+// JSON response rather than by a plain form submission
+func wantsJSON(r *http.Request) bool {
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accept, ";")[0])
+		if mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+type countResponse struct {
+	Total   int `json:"total"`
+	Done    int `json:"done"`
+	Pending int `json:"pending"`
+	Overdue int `json:"overdue"`
+}
+
+func (s *server) CountHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_count")
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, _, err := s.loadTodos(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		todoList = filterTodos(todoList, filters)
+
+		var count countResponse
+
+		now := time.Now()
+		for _, todo := range todoList {
+			count.Total++
+			if todo.Done {
+				count.Done++
+			} else {
+				count.Pending++
+			}
+			if todo.isOverdue(now) {
+				count.Overdue++
+			}
+		}
+
+		writeJSON(w, r, http.StatusOK, count)
+	}
+}
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type tagsResponse struct {
+	Tags []tagCount `json:"tags"`
+}
+
+// TagsHandler lists every tag in use, sorted by name, along with the number
+// of todos tagged with it
+func (s *server) TagsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_tags")
+
+		todoList, _, err := s.loadTodos(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		counts := make(map[string]int)
+		for _, todo := range todoList {
+			for _, tag := range todo.Tags {
+				counts[tag]++
+			}
+		}
+
+		res := tagsResponse{Tags: []tagCount{}}
+		for tag, count := range counts {
+			res.Tags = append(res.Tags, tagCount{Tag: tag, Count: count})
+		}
+		sort.Slice(res.Tags, func(i, j int) bool { return res.Tags[i].Tag < res.Tags[j].Tag })
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
+
+type tagRequest struct {
+	Tag string   `json:"tag"`
+	IDs []uint64 `json:"ids"`
+}
+
+type tagResponse struct {
+	Modified int `json:"modified"`
+}
+
+// BulkTagHandler adds (or removes) a tag to (or from) every todo with one of
+// the given ids, or every todo matching the query's filters when no ids are
+// given. Todos already having (or lacking) the tag are left untouched.
+func (s *server) BulkTagHandler(add bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_bulk_tag")
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var req tagRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			http.Error(w, "Bad Request: invalid request", http.StatusBadRequest)
+			return
+		}
+
+		tags, err := normalizeTags(req.Tag)
+		if err == nil && len(tags) != 1 {
+			err = errors.New("a single tag is required")
+		}
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		tag := tags[0]
+
+		if len(req.IDs) > 0 {
+			ids := make(map[uint64]bool)
+			for _, id := range req.IDs {
+				ids[id] = true
+			}
+			filters = append(filters, func(todo *Todo) bool {
+				return ids[todo.ID]
+			})
+		}
+
+		prefix := keyPrefix(r)
+
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		var res tagResponse
+		for _, todo := range filterTodos(todoList, filters) {
+			if todo.hasTag(tag) == add {
+				continue
+			}
+
+			_, _, err := s.updateTodo(prefix, todo.ID, func(todo *Todo) error {
+				var changed bool
+				if add {
+					changed = todo.addTag(tag)
+				} else {
+					changed = todo.removeTag(tag)
+				}
+				if !changed {
+					return errUnchanged
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errUnchanged) && !errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithError(err).WithField("id", todo.ID).Error("error updating todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				res.Modified++
+			}
+		}
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
+
+type todosPage struct {
+	Todos TodoList `json:"todos"`
+	Next  *uint64  `json:"next,omitempty"`
+}
+
+// ListTodosHandler returns a page of todos ordered by id. Pages are
+// addressed by cursor: ?after=<id> returns the todos with an id greater
+// than the given id and next holds the cursor for the following page, if
+// any. Since ids are never reused, todos deleted between pages are simply
+// absent and the remaining todos are neither skipped nor repeated; todos
+// added meanwhile always appear on the last page. The list can be filtered
+// like the index.
+func (s *server) ListTodosHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_todos")
+
+		q := r.URL.Query()
+
+		var start uint64
+		if after := q.Get("after"); after != "" {
+			id, err := strconv.ParseUint(after, 10, 64)
+			if err != nil {
+				http.Error(w, "Bad Request: invalid after", http.StatusBadRequest)
+				return
+			}
+			start = id + 1
+		}
+
+		limit := defaultPageLimit
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+				return
+			}
+			if n > maxPageLimit {
+				n = maxPageLimit
+			}
+			limit = n
+		}
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, more, err := s.loadTodosFrom(r.Context(), keyPrefix(r), start, limit, filters)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		page := todosPage{Todos: todoList}
+		if page.Todos == nil {
+			page.Todos = TodoList{}
+		}
+		if more && len(todoList) > 0 {
+			next := todoList[len(todoList)-1].ID
+			page.Next = &next
+		}
+
+		writeJSON(w, r, http.StatusOK, page)
+	}
+}
+
+// createTodo adds a todo under prefix from a normalized update, which must
+// have a title
+func (s *server) createTodo(r *http.Request, prefix string, u *todoUpdate) (*Todo, error) {
+	todo := newTodo(*u.Title)
+	u.apply(todo)
+
+	key, err := s.addTodo(prefix, todo)
+	if err != nil {
+		return nil, err
+	}
+
+	s.undo.Push(prefix, undoEntry{key: key})
+	s.notifyAsync(r, eventCreated, todo)
+
+	return todo, nil
+}
+
+// CreateTodoHandler adds a todo from a JSON body like PUT takes, of which
+// only the title is required, and returns it with 201 Created and its
+// Location. With dedupe enabled an incomplete todo with the same title is
+// returned with 200 OK instead.
+func (s *server) CreateTodoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_create_todo")
+
+		prefix := keyPrefix(r)
+
+		var u todoUpdate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&u); err != nil {
+			http.Error(w, "Bad Request: invalid todo", http.StatusBadRequest)
+			return
+		}
+		if u.Title == nil {
+			http.Error(w, "Bad Request: title is required", http.StatusBadRequest)
+			return
+		}
+		if err := u.normalize(s.maxTitleLength); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if s.dedupe {
+			existing, err := s.findDuplicate(r.Context(), prefix, *u.Title)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error checking for duplicate todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			if existing != nil {
+				w.Header().Set("ETag", etag(existing))
+				writeJSON(w, r, http.StatusOK, existing)
+				return
+			}
+		}
+
+		todo, err := s.createTodo(r, prefix, &u)
+		if errors.Is(err, errTooManyTodos) {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			requestLog(r).WithError(err).Error("error adding todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/%d", strings.TrimSuffix(r.URL.Path, "/"), todo.ID))
+		w.Header().Set("ETag", etag(todo))
+		writeJSON(w, r, http.StatusCreated, todo)
+	}
+}
+
+// DeleteTodoHandler moves a single todo to the trash, responding 204 No
+// Content
+func (s *server) DeleteTodoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_delete_todo")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		todo, err := s.discardTodo(r.Context(), keyPrefix(r), id)
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("id", id).Error("error deleting todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if todo != nil {
+			s.notifyAsync(r, eventDeleted, todo)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetTodoHandler returns a single todo
+func (s *server) GetTodoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_get_todo")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		todo, err := s.loadTodo(keyPrefix(r), id)
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("id", id).Error("error loading todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", etag(todo))
+		writeJSON(w, r, http.StatusOK, todo)
+	}
+}
+
+type idsRequest struct {
+	IDs []uint64 `json:"ids"`
+}
+
+// readIDs reads a list of todo ids from the request body given either as
+// a plain JSON array or as an object with an ids field
+func readIDs(w http.ResponseWriter, r *http.Request) ([]uint64, error) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var ids []uint64
+		err := json.Unmarshal(data, &ids)
+		return ids, err
+	}
+
+	var req idsRequest
+	err = json.Unmarshal(data, &req)
+	return req.IDs, err
+}
+
+type bulkDeleteResponse struct {
+	Deleted []uint64 `json:"deleted"`
+	Missing []uint64 `json:"missing"`
+	Failed  []uint64 `json:"failed"`
+}
+
+// BulkDeleteHandler moves all of the given todos to the trash. Ids that do
+// not exist are reported as missing (already gone) rather than as an
+// error.
+func (s *server) BulkDeleteHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_bulk_delete")
+
+		ids, err := readIDs(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid ids", http.StatusBadRequest)
+			return
+		}
+
+		res := bulkDeleteResponse{
+			Deleted: []uint64{},
+			Missing: []uint64{},
+			Failed:  []uint64{},
+		}
+
+		prefix := keyPrefix(r)
+		for _, id := range ids {
+			todo, err := s.discardTodo(r.Context(), prefix, id)
+			switch {
+			case err == nil:
+				if todo != nil {
+					s.notifyAsync(r, eventDeleted, todo)
+				}
+				res.Deleted = append(res.Deleted, id)
+			case errors.Is(err, bitcask.ErrKeyNotFound):
+				res.Missing = append(res.Missing, id)
+			default:
+				requestLog(r).WithError(err).WithField("id", id).Error("error deleting todo")
+				res.Failed = append(res.Failed, id)
+			}
+		}
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// ArchiveHandler moves a todo to the archive, hiding it from the list until
+// it is restored
+func (s *server) ArchiveHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_archive")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		key := fmt.Sprintf("%stodo_%d", prefix, id)
+
+		if err := s.archiveTodo(prefix, id); err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("key", key).Warn("todo not found")
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("key", key).Error("error updating todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.setFlash(w, "archived")
+		redirectBack(w, r)
+	}
+}
+
+// archiveTodo moves the todo with the given id under prefix to the archive
+// so it can be undone, or returns bitcask.ErrKeyNotFound if it is not on
+// the list
+func (s *server) archiveTodo(prefix string, id uint64) error {
+	before, _, err := s.moveTodo(prefix, id, todoNamespace, archiveNamespace, func(todo *Todo) error {
+		todo.ArchivedAt = s.now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.trackTodo(before, nil)
+	s.undo.Push(prefix, undoEntry{
+		key:    fmt.Sprintf("%stodo_%d", prefix, id),
+		before: before,
+		moved:  fmt.Sprintf("%sarchive_%d", prefix, id),
+	})
+
+	return nil
+}
+
+// ArchiveListHandler lists the archived todos, most recently archived first
+func (s *server) ArchiveListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_archive_list")
+
+		todoList, skipped, err := s.loadArchived(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing archived todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		sort.SliceStable(todoList, func(i, j int) bool {
+			return todoList[i].ArchivedAt.After(todoList[j].ArchivedAt)
+		})
+
+		s.render("archive", w, r, &templateContext{
+			Title:    "archive",
+			TodoList: todoList,
+			Total:    len(todoList),
+			Skipped:  skipped,
+		})
+	}
+}
+
+// RestoreHandler brings an archived todo back to the list
+func (s *server) RestoreHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_restore")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		key := fmt.Sprintf("%sarchive_%d", prefix, id)
+
+		before, todo, err := s.moveTodo(prefix, id, archiveNamespace, todoNamespace, func(todo *Todo) error {
+			todo.ArchivedAt = time.Time{}
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("key", key).Warn("archived todo not found")
+				http.Error(w, "Not Found: no such archived todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("key", key).Error("error restoring todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.trackTodo(nil, todo)
+		s.undo.Push(prefix, undoEntry{key: key, before: before, moved: fmt.Sprintf("%stodo_%d", prefix, id)})
+
+		redirectBack(w, r)
+	}
+}
+
+// ArchiveDeleteHandler moves an archived todo to the trash
+func (s *server) ArchiveDeleteHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_archive_delete")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		key := fmt.Sprintf("%sarchive_%d", prefix, id)
+
+		todo, err := s.trashTodo(prefix, archiveNamespace, id)
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("key", key).Warn("archived todo not found")
+				http.Error(w, "Not Found: no such archived todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("key", key).Error("error deleting todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.notifyAsync(r, eventDeleted, todo)
+
+		s.setFlash(w, "trashed")
+		redirectBack(w, r)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prologic/bitcask"
+)
+
+func TestArchiveMovesTodoToArchiveNamespace(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	todo := addTestTodo(t, s, "buy milk")
+	addTestTodo(t, s, "walk the dog")
+
+	if w := serve(s, "POST", "/archive/0", nil); w.Code != 302 {
+		t.Fatalf("expected 302 archiving, got %d", w.Code)
+	}
+
+	if db.Has([]byte("todo_0")) {
+		t.Error("expected the archived todo to be removed from the list")
+	}
+	archived, err := s.loadTodoAt("archive_0")
+	if err != nil {
+		t.Fatalf("expected the todo under archive_0: %s", err)
+	}
+	if archived.Title != todo.Title || archived.ArchivedAt.IsZero() {
+		t.Errorf("expected the archived todo with ArchivedAt set, got %+v", archived)
+	}
+
+	todoList, _, err := s.loadTodos(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todoList) != 1 || todoList[0].Title != "walk the dog" {
+		t.Errorf("expected only the other todo on the list, got %v", todoList)
+	}
+	if n := todoGauges(s); n != 1 {
+		t.Errorf("expected 1 todo counted, got %d", n)
+	}
+
+	if w := serve(s, "POST", "/restore/0", nil); w.Code != 302 {
+		t.Fatalf("expected 302 restoring, got %d", w.Code)
+	}
+	restored, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatalf("expected the todo back on the list: %s", err)
+	}
+	if !restored.ArchivedAt.IsZero() {
+		t.Errorf("expected ArchivedAt to be cleared, got %s", restored.ArchivedAt)
+	}
+	if db.Has([]byte("archive_0")) {
+		t.Error("expected the restored todo to be removed from the archive")
+	}
+	if n := todoGauges(s); n != 2 {
+		t.Errorf("expected 2 todos counted, got %d", n)
+	}
+
+	if w := serve(s, "POST", "/restore/0", nil); w.Code != 404 {
+		t.Errorf("expected 404 restoring a todo that is not archived, got %d", w.Code)
+	}
+}
+
+func TestArchiveUndo(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+
+	serve(s, "POST", "/archive/0", nil)
+	if w := serve(s, "POST", "/undo", nil); w.Code != 302 {
+		t.Fatalf("expected 302 undoing, got %d", w.Code)
+	}
+
+	if _, err := s.loadTodo("", 0); err != nil {
+		t.Errorf("expected undo to bring the todo back: %s", err)
+	}
+	if db.Has([]byte("archive_0")) {
+		t.Error("expected undo to remove the todo from the archive")
+	}
+	if n := todoGauges(s); n != 1 {
+		t.Errorf("expected 1 todo counted, got %d", n)
+	}
+}
+
+func TestArchiveDelete(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+	serve(s, "POST", "/archive/0", nil)
+
+	if w := serve(s, "POST", "/archive/0/delete", nil); w.Code != 302 {
+		t.Fatalf("expected 302 deleting, got %d", w.Code)
+	}
+	if _, err := s.loadTodoAt("archive_0"); !errors.Is(err, bitcask.ErrKeyNotFound) {
+		t.Errorf("expected the archived todo to be deleted, got %v", err)
+	}
+	if !db.Has([]byte("trash_0")) {
+		t.Error("expected the deleted todo to be moved to the trash")
+	}
+	if w := serve(s, "POST", "/archive/0/delete", nil); w.Code != 404 {
+		t.Errorf("expected 404 deleting it again, got %d", w.Code)
+	}
+}
+
+func TestMigrateArchived(t *testing.T) {
+	db := newMemoryStore()
+
+	// Earlier versions kept archived todos on the list
+	for _, todo := range []*Todo{
+		{ID: 0, Title: "on the list"},
+		{ID: 1, Title: "archived", ArchivedAt: testTime},
+	} {
+		data, err := json.Marshal(todo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put([]byte(fmt.Sprintf("todo_%d", todo.ID)), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestServer(t, db)
+
+	if !db.Has([]byte("todo_0")) {
+		t.Error("expected the todo on the list to stay")
+	}
+	if db.Has([]byte("todo_1")) || !db.Has([]byte("archive_1")) {
+		t.Error("expected the archived todo to be moved to the archive")
+	}
+	if n := todoGauges(s); n != 1 {
+		t.Errorf("expected 1 todo counted, got %d", n)
+	}
+
+	// The archived id is never handed out again
+	if todo := addTestTodo(t, s, "new"); todo.ID != 2 {
+		t.Errorf("expected the next id to be 2, got %d", todo.ID)
+	}
+}
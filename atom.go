@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// atomEntries is the number of most recent entries in the activity feed
+const atomEntries = 50
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID       string         `xml:"id"`
+	Title    string         `xml:"title"`
+	Updated  string         `xml:"updated"`
+	Link     atomLink       `xml:"link"`
+	Category []atomCategory `xml:"category,omitempty"`
+	Content  *atomContent   `xml:"content,omitempty"`
+
+	// time orders the entries, most recent first
+	time time.Time
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// activityEntries returns an entry for the addition of every todo and the
+// completion of every completed todo, most recent first
+func activityEntries(r *http.Request, prefix string, todoList TodoList) []atomEntry {
+	host := (&url.URL{Host: r.Host}).Hostname()
+
+	newEntry := func(todo *Todo, event string, t time.Time) atomEntry {
+		entry := atomEntry{
+			ID:      fmt.Sprintf("tag:%s,2020:%stodo-%d/%s", host, prefix, todo.ID, event),
+			Title:   event + ": " + todo.Title,
+			Updated: t.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: fmt.Sprintf("%s/edit/%d", baseURL(r), todo.ID)},
+			time:    t,
+		}
+		// Archived todos cannot be edited
+		if !todo.ArchivedAt.IsZero() {
+			entry.Link.Href = baseURL(r) + "/archive"
+		}
+		for _, tag := range todo.Tags {
+			entry.Category = append(entry.Category, atomCategory{Term: tag})
+		}
+		if todo.Body != "" {
+			entry.Content = &atomContent{Type: "html", Body: string(markdown(todo.Body))}
+		}
+		return entry
+	}
+
+	var entries []atomEntry
+	for _, todo := range todoList {
+		if !todo.CreatedAt.IsZero() {
+			entries = append(entries, newEntry(todo, "added", todo.CreatedAt))
+		}
+		if todo.Done && !todo.CompletedAt.IsZero() {
+			entries = append(entries, newEntry(todo, "completed", todo.CompletedAt))
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].time.After(entries[j].time)
+	})
+	return entries
+}
+
+// AtomHandler returns an Atom feed of recently added and completed todos,
+// archived ones included, for following the list in a feed reader. Like
+// the calendar feed it requires the signed feed token of its user.
+func (s *server) AtomHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_atom")
+
+		if !s.checkFeedToken(w, r) {
+			return
+		}
+
+		prefix := keyPrefix(r)
+
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		archived, _, err := s.loadArchived(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing archived todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		todoList = append(todoList, archived...)
+
+		entries := activityEntries(r, prefix, todoList)
+		if len(entries) > atomEntries {
+			entries = entries[:atomEntries]
+		}
+
+		updated := lastModified(todoList)
+		feed := atomFeed{
+			ID:      baseURL(r) + "/feed.atom",
+			Title:   "todo",
+			Updated: updated.UTC().Format(time.RFC3339),
+			Author:  atomAuthor{Name: "todo"},
+			Link:    atomLink{Href: baseURL(r) + "/"},
+			Entries: entries,
+		}
+		if user := userFromRequest(r); user != nil {
+			feed.ID += "#" + user.Username
+			feed.Title += " - " + user.Username
+			feed.Author.Name = user.Username
+		}
+
+		data, err := xml.MarshalIndent(feed, "", "  ")
+		if err != nil {
+			requestLog(r).WithError(err).Error("error marshaling atom feed")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		setMaxAge(w, exportMaxAge, "private")
+
+		content := append([]byte(xml.Header), data...)
+		http.ServeContent(w, r, "feed.atom", updated, bytes.NewReader(content))
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivityEntries(t *testing.T) {
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.FixedZone("UTC+2", 2*60*60))
+	todoList := TodoList{
+		{ID: 1, Title: "buy milk", Done: true, CreatedAt: start, CompletedAt: start.Add(2 * time.Hour)},
+		{ID: 2, Title: "walk the dog", Tags: []string{"home", "pets"}, Body: "*twice*", CreatedAt: start.Add(time.Hour)},
+		{ID: 3, Title: "call mum", CreatedAt: start.Add(3 * time.Hour), ArchivedAt: start.Add(4 * time.Hour)},
+		{ID: 4, Title: "imported without dates"},
+	}
+
+	entries := activityEntries(httptest.NewRequest("GET", "/feed.atom", nil), "user_1_", todoList)
+
+	var ids, updated, titles, links []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+		updated = append(updated, entry.Updated)
+		titles = append(titles, entry.Title)
+		links = append(links, entry.Link.Href)
+	}
+
+	if expected := []string{
+		"tag:example.com,2020:user_1_todo-3/added",
+		"tag:example.com,2020:user_1_todo-1/completed",
+		"tag:example.com,2020:user_1_todo-2/added",
+		"tag:example.com,2020:user_1_todo-1/added",
+	}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected ids %q, most recent first, got %q", expected, ids)
+	}
+	if expected := []string{"2024-01-02T16:04:05Z", "2024-01-02T15:04:05Z", "2024-01-02T14:04:05Z", "2024-01-02T13:04:05Z"}; !reflect.DeepEqual(updated, expected) {
+		t.Errorf("expected updated times %q, got %q", expected, updated)
+	}
+	if expected := []string{"added: call mum", "completed: buy milk", "added: walk the dog", "added: buy milk"}; !reflect.DeepEqual(titles, expected) {
+		t.Errorf("expected titles %q, got %q", expected, titles)
+	}
+	if expected := []string{"http://example.com/archive", "http://example.com/edit/1", "http://example.com/edit/2", "http://example.com/edit/1"}; !reflect.DeepEqual(links, expected) {
+		t.Errorf("expected links %q, got %q", expected, links)
+	}
+
+	walk := entries[2]
+	if expected := []atomCategory{{Term: "home"}, {Term: "pets"}}; !reflect.DeepEqual(walk.Category, expected) {
+		t.Errorf("expected the tags as categories, got %+v", walk.Category)
+	}
+	if walk.Content == nil || walk.Content.Type != "html" || !strings.Contains(walk.Content.Body, "<em>twice</em>") {
+		t.Errorf("expected the notes as HTML content, got %+v", walk.Content)
+	}
+	if entries[0].Content != nil || entries[0].Category != nil {
+		t.Errorf("expected no content or categories without notes or tags, got %+v", entries[0])
+	}
+}
+
+func TestAtomFeed(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	addFeedTodo(t, s, `{"title":"<b>buy</b> milk & \"eggs\"","body":"a <script>","tags":["shopping"],"done":true}`)
+
+	if w := serve(s, "GET", "/feed.atom", nil); w.Code != 401 {
+		t.Errorf("expected 401 without the feed token, got %d", w.Code)
+	}
+
+	path, err := s.feedURL(httptest.NewRequest("GET", "/", nil), "/feed.atom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(s, "GET", path, nil)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 with the feed token, got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+		t.Errorf("expected an Atom content type, got %q", ct)
+	}
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, xml.Header) {
+		t.Errorf("expected an XML declaration, got %q", body)
+	}
+	if strings.Contains(body, "<b>") || strings.Contains(body, "<script>") {
+		t.Errorf("expected markup in titles and notes to be escaped, got:\n%s", body)
+	}
+	if !strings.Contains(body, "<title>completed: &lt;b&gt;buy&lt;/b&gt; milk &amp; &#34;eggs&#34;</title>") {
+		t.Errorf("expected the escaped title, got:\n%s", body)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("expected a well-formed feed, got %v", err)
+	}
+	if feed.ID != "http://example.com/feed.atom" || feed.Title != "todo" || feed.Link.Href != "http://example.com/" {
+		t.Errorf("expected the feed's id, title and link, got %+v", feed)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("expected an added and a completed entry, got %+v", feed.Entries)
+	}
+	if title := feed.Entries[0].Title; title != `completed: <b>buy</b> milk & "eggs"` {
+		t.Errorf("expected the title to round-trip, got %q", title)
+	}
+	if feed.Updated < feed.Entries[0].Updated {
+		t.Errorf("expected the feed to be updated no earlier than its latest entry %s, got %s", feed.Entries[0].Updated, feed.Updated)
+	}
+	if _, err := time.Parse(time.RFC3339, feed.Updated); err != nil {
+		t.Errorf("expected an RFC3339 updated time, got %v", err)
+	}
+}
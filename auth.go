@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// apiKeyPrefix is the key prefix under which API keys are stored in the
+// database. The value of each key is the API key itself so a key can be
+// revoked by simply deleting it.
+const apiKeyPrefix = "keys_"
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	requestIDContextKey
+	csrfContextKey
+	basePathContextKey
+	graphqlRequestContextKey
+)
+
+// publicPaths are the path prefixes reachable without a session in
+// multi-user mode. /admin/ is not scoped to a user and is guarded by
+// adminAuth instead.
+var publicPaths = []string{"/login", "/register", "/healthz", "/admin/", "/css/", "/icons/", "/js/"}
+
+// isAPIPath reports whether path is one of the API's, which accept API keys
+// and tokens: the /api/ routes and the GraphQL endpoint
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == graphqlPath
+}
+
+// userFromRequest returns the logged in user of the request or nil when
+// multi-user mode is disabled
+func userFromRequest(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	return user
+}
+
+// keyPrefix returns the prefix used to scope all of the request's todo
+// keys to the logged in user, or an empty prefix in single-user mode
+func keyPrefix(r *http.Request) string {
+	if user := userFromRequest(r); user != nil {
+		return fmt.Sprintf("user_%d_", user.ID)
+	}
+	return ""
+}
+
+// apiKeyFromRequest returns the API key supplied either as a Bearer token
+// in the Authorization header or in the X-API-Key header
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// allAPIKeys returns the configured API keys along with those stored in
+// the database
+func (s *server) allAPIKeys() ([][]byte, error) {
+	var keys [][]byte
+
+	for _, key := range s.apiKeys {
+		if key != "" {
+			keys = append(keys, []byte(key))
+		}
+	}
+
+	err := s.db.Scan([]byte(apiKeyPrefix), func(key []byte) error {
+		value, err := s.db.Get(key)
+		if err != nil {
+			return err
+		}
+		if len(value) > 0 {
+			keys = append(keys, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// apiAuth requires a valid API key on all /api/ requests once at least one
+// key is configured. All other routes are passed through untouched.
+func (s *server) apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		configured, valid, err := s.checkAPIKey(r)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error loading api keys")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if configured && !valid && s.multiUser {
+			// API tokens of users are accepted too, sessionAuth then
+			// scopes the request to the token's user
+			user, err := s.tokenUser(r)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error loading api token")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			valid = user != nil
+		}
+
+		if configured && !valid {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="todo"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkAPIKey reports whether any API keys are configured and whether the
+// request carries one of them
+func (s *server) checkAPIKey(r *http.Request) (configured, valid bool, err error) {
+	return s.checkKey(apiKeyFromRequest(r))
+}
+
+// checkKey reports whether any API keys are configured and whether the
+// given key is one of them
+func (s *server) checkKey(key string) (configured, valid bool, err error) {
+	keys, err := s.allAPIKeys()
+	if err != nil {
+		return false, false, err
+	}
+
+	if len(keys) == 0 {
+		return false, false, nil
+	}
+
+	given := []byte(key)
+
+	// Compare against every key so the time taken does not depend on
+	// which (if any) key matched.
+	match := 0
+	for _, key := range keys {
+		match |= subtle.ConstantTimeCompare(given, key)
+	}
+
+	return true, len(given) > 0 && match == 1, nil
+}
+
+// isCalDAVPath reports whether the path is served to CalDAV clients
+func isCalDAVPath(path string) bool {
+	return strings.HasPrefix(path, caldavPath) || path == "/.well-known/caldav"
+}
+
+// caldavAuth requires one of the API keys as the password of HTTP Basic
+// authentication, the only kind CalDAV clients support, on CalDAV requests
+// once at least one key is configured. The username is ignored. In
+// multi-user mode sessionAuth authenticates the user instead.
+func (s *server) caldavAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.multiUser || !isCalDAVPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, password, _ := r.BasicAuth()
+		configured, valid, err := s.checkKey(password)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error loading api keys")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if configured && !valid {
+			w.Header().Set("WWW-Authenticate", `Basic realm="todo"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminAuth requires a valid API key on all /admin/ requests. Unlike the
+// API these are refused outright when no key is configured, as they
+// expose the whole database.
+func (s *server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		configured, valid, err := s.checkAPIKey(r)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error loading api keys")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if !configured {
+			http.Error(w, "Forbidden: an API key must be configured", http.StatusForbidden)
+			return
+		}
+		if !valid {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="todo"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionAuth validates the session token of every request in multi-user
+// mode and injects the logged in user into the request context. Requests
+// without a valid session are redirected to the login page, or rejected
+// for /api/ routes.
+func (s *server) sessionAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.multiUser {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		for _, path := range publicPaths {
+			if strings.HasPrefix(r.URL.Path, path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		var user *User
+
+		// CalDAV clients authenticate with HTTP Basic authentication only,
+		// sessions are ignored so other sites cannot use a browser's
+		if isCalDAVPath(r.URL.Path) {
+			user, err := s.basicAuthUser(r)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error checking caldav credentials")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			if user == nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="todo"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if cookie, err := r.Cookie(tokenCookie); err == nil {
+			c, err := decodeJWT(s.jwtSecret, cookie.Value)
+			if err == nil {
+				user, err = s.getUser(c.Username)
+				if err == nil && user.ID != c.Subject {
+					user = nil
+				}
+			}
+			if err != nil {
+				requestLog(r).WithError(err).Debug("invalid session")
+			}
+		}
+
+		if user == nil && isAPIPath(r.URL.Path) {
+			var err error
+			user, err = s.tokenUser(r)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error loading api token")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Calendar apps and feed readers subscribe to feeds with their token
+		if user == nil && feedPaths[r.URL.Path] {
+			var err error
+			user, err = s.feedUser(r)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error checking feed token")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if user == nil {
+			if isAPIPath(r.URL.Path) || feedPaths[r.URL.Path] {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Formats of GET /export and POST /import
+const (
+	formatJSON = "json"
+	formatTxt  = "txt"
+)
+
+// decodeTodoList decodes a list of todos given either as a bare array or
+// as returned by GET /api/todos
+func decodeTodoList(data []byte) (TodoList, error) {
+	var todoList TodoList
+	if err := json.Unmarshal(data, &todoList); err != nil {
+		var page todosPage
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, errors.New("invalid export")
+		}
+		todoList = page.Todos
+	}
+
+	for _, todo := range todoList {
+		if todo == nil {
+			return nil, errors.New("invalid export")
+		}
+	}
+	return todoList, nil
+}
+
+// todoFromJSON validates a todo of a JSON export the way adding a todo does
+// returning a copy to import
+func (s *server) todoFromJSON(in *Todo) (*Todo, error) {
+	title, color, tags := in.Title, in.Color, in.Tags
+	u := todoUpdate{Title: &title, Color: &color, Tags: &tags}
+	if err := u.normalize(s.maxTitleLength); err != nil {
+		return nil, err
+	}
+
+	todo := *in
+	todo.Title, todo.Color, todo.Tags = *u.Title, *u.Color, *u.Tags
+	todo.ID, todo.Rev = 0, 0
+	if todo.UpdatedAt.IsZero() {
+		todo.UpdatedAt = s.now()
+	}
+	if todo.CreatedAt.IsZero() {
+		todo.CreatedAt = todo.UpdatedAt
+	}
+
+	return &todo, nil
+}
+
+// importKey identifies todos that are the same for import: todos with the
+// same title and state
+func importKey(todo *Todo) string {
+	return fmt.Sprintf("%t:%s", todo.Done, normalizeTitle(todo.Title))
+}
+
+// ExportHandler downloads the todo list, filtered like the index, as JSON
+// (?format=json, the default) or as a todo.txt file (?format=txt)
+func (s *server) ExportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_export")
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = formatJSON
+		}
+		if format != formatJSON && format != formatTxt {
+			http.Error(w, "Bad Request: invalid format", http.StatusBadRequest)
+			return
+		}
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, _, err := s.loadTodos(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		todoList = filterTodos(todoList, filters)
+		sortTodos(todoList)
+		if todoList == nil {
+			todoList = TodoList{}
+		}
+
+		var (
+			buf         bytes.Buffer
+			contentType string
+			filename    string
+		)
+		switch format {
+		case formatJSON:
+			if err := json.NewEncoder(&buf).Encode(todoList); err != nil {
+				requestLog(r).WithError(err).Error("error marshaling todos")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			contentType, filename = "application/json; charset=utf-8", "todo.json"
+		case formatTxt:
+			for _, todo := range todoList {
+				buf.WriteString(formatTodoTxt(todo) + "\n")
+			}
+			contentType, filename = "text/plain; charset=utf-8", "todo.txt"
+		}
+
+		setAttachment(w, contentType, filename)
+		setMaxAge(w, exportMaxAge, "private")
+
+		http.ServeContent(w, r, filename, lastModified(todoList), bytes.NewReader(buf.Bytes()))
+	}
+}
+
+// importFormat returns the format of an import given by ?format= or the
+// content type, falling back to JSON if the data looks like JSON and
+// todo.txt otherwise
+func importFormat(r *http.Request, data []byte) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return formatJSON
+	case "text/plain":
+		return formatTxt
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		return formatJSON
+	}
+	return formatTxt
+}
+
+// ImportHandler adds the todos of a JSON or todo.txt export. Imported
+// todos are always given new ids so they never collide with existing
+// todos, and todos with the same title and state as an existing todo (or
+// one imported before) are skipped, so importing the same file twice adds
+// nothing. Rows (todos of a JSON export, lines of a todo.txt file) that
+// cannot be imported are reported without aborting the rest.
+func (s *server) ImportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_import")
+
+		prefix := keyPrefix(r)
+
+		in, err := uploadReader(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := ioutil.ReadAll(in)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res := importResult{Errors: []importError{}}
+
+		// Rows are numbered from 1, missing rows failed to parse
+		rows := make(map[int]*Todo)
+		var count int
+
+		switch importFormat(r, data) {
+		case formatJSON:
+			todoList, err := decodeTodoList(data)
+			if err != nil {
+				http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			count = len(todoList)
+			for i, in := range todoList {
+				todo, err := s.todoFromJSON(in)
+				if err != nil {
+					res.Errors = append(res.Errors, importError{Row: i + 1, Error: err.Error()})
+					continue
+				}
+				rows[i+1] = todo
+			}
+		case formatTxt:
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			for row := 1; scanner.Scan(); row++ {
+				count = row
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				todo, err := s.todoFromTodoTxt(line)
+				if err != nil {
+					res.Errors = append(res.Errors, importError{Row: row, Error: err.Error()})
+					continue
+				}
+				rows[row] = todo
+			}
+			if err := scanner.Err(); err != nil {
+				http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Bad Request: invalid format", http.StatusBadRequest)
+			return
+		}
+
+		existing, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		seen := make(map[string]uint64)
+		for _, todo := range existing {
+			seen[importKey(todo)] = todo.ID
+		}
+
+		for row := 1; row <= count; row++ {
+			todo, ok := rows[row]
+			if !ok {
+				continue
+			}
+
+			if id, ok := seen[importKey(todo)]; ok {
+				res.Errors = append(res.Errors, importError{Row: row, Error: fmt.Sprintf("duplicate of todo %d", id)})
+				continue
+			}
+
+			if _, err := s.addTodo(prefix, todo); errors.Is(err, errTooManyTodos) {
+				res.Errors = append(res.Errors, importError{Row: row, Error: err.Error()})
+				continue
+			} else if err != nil {
+				requestLog(r).WithError(err).Error("error importing todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			seen[importKey(todo)] = todo.ID
+			res.Imported++
+		}
+
+		sort.Slice(res.Errors, func(i, j int) bool { return res.Errors[i].Row < res.Errors[j].Row })
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// addRoundTripTodos adds todos using every field exports carry
+func addRoundTripTodos(t *testing.T, s *server) {
+	for _, tc := range []struct {
+		title    string
+		done     bool
+		tags     []string
+		due      time.Time
+		priority priority
+	}{
+		{"buy milk", false, []string{"errands"}, time.Date(2020, time.July, 3, 23, 59, 59, 0, time.Local), priorityHigh},
+		{"walk the dog", true, []string{"home", "pets"}, time.Time{}, priorityLow},
+		{"call mum, then dad", false, nil, time.Time{}, priorityNone},
+	} {
+		todo := addTestTodo(t, s, tc.title)
+		_, _, err := s.updateTodoAt(fmt.Sprintf("todo_%d", todo.ID), func(todo *Todo) error {
+			todo.setDone(tc.done)
+			todo.Tags = tc.tags
+			todo.DueDate = tc.due
+			todo.Priority = tc.priority
+			todo.CreatedAt = testTime
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// exportTodos downloads the todos of the server in the given export
+func exportTodos(t *testing.T, s *server, target string) string {
+	w := serve(s, "GET", target, nil)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 exporting %s, got %d", target, w.Code)
+	}
+	return w.Body.String()
+}
+
+// importTodos uploads an export to the server returning the result
+func importTodos(t *testing.T, s *server, target, contentType, data string) importResult {
+	r := newJSONRequest("POST", target, data)
+	r.Header.Set("Content-Type", contentType)
+
+	w := serveRequest(s, r)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 importing %s, got %d: %s", target, w.Code, w.Body.String())
+	}
+
+	var res importResult
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// roundTripFields returns the fields of the todos that survive an export in
+// a stable order
+func roundTripFields(t *testing.T, s *server) []string {
+	var fields []string
+	for id := uint64(0); id < 3; id++ {
+		todo, err := s.loadTodo("", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		due := ""
+		if todo.hasDueDate() {
+			due = formatDate(todo.DueDate)
+		}
+		fields = append(fields, fmt.Sprintf("%s|%t|%s|%s|%s|%s",
+			todo.Title, todo.Done, strings.Join(todo.Tags, ","), due, todo.Priority, formatDate(todo.CreatedAt)))
+	}
+	return fields
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		export, contentType string
+	}{
+		{"/export?format=json", "application/json"},
+		{"/export?format=txt", "text/plain"},
+	} {
+		src := newTestServer(t, newMemoryStore())
+		addRoundTripTodos(t, src)
+		data := exportTodos(t, src, tc.export)
+
+		dst := newTestServer(t, newMemoryStore())
+		if res := importTodos(t, dst, "/import", tc.contentType, data); res.Imported != 3 || len(res.Errors) != 0 {
+			t.Fatalf("expected 3 todos imported from %s, got %+v", tc.export, res)
+		}
+
+		if expected, fields := roundTripFields(t, src), roundTripFields(t, dst); !reflect.DeepEqual(fields, expected) {
+			t.Errorf("expected %s to round-trip\n%q\ngot\n%q", tc.export, expected, fields)
+		}
+
+		// Importing the same export again adds nothing
+		if res := importTodos(t, dst, "/import", tc.contentType, data); res.Imported != 0 || len(res.Errors) != 3 {
+			t.Errorf("expected every todo of %s to be skipped as a duplicate, got %+v", tc.export, res)
+		}
+		if n := todoGauges(dst); n != 3 {
+			t.Errorf("expected 3 todos after importing %s twice, got %d", tc.export, n)
+		}
+	}
+}
+
+func TestImportReportsInvalidRows(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	data := `[{"Title":"buy milk"},{"Title":""},{"Title":"walk the dog","Tags":["c++"]}]`
+	res := importTodos(t, s, "/import", "application/json", data)
+	if res.Imported != 1 {
+		t.Errorf("expected 1 todo imported, got %d", res.Imported)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Row != 2 || res.Errors[1].Row != 3 {
+		t.Errorf("expected rows 2 and 3 to be reported, got %+v", res.Errors)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+type bulkRequest struct {
+	IDs    []uint64 `json:"ids"`
+	Action string   `json:"action"`
+	Tag    string   `json:"tag"`
+}
+
+type bulkResponse struct {
+	Modified  []uint64 `json:"modified"`
+	Unchanged []uint64 `json:"unchanged"`
+	Missing   []uint64 `json:"missing"`
+	Failed    []uint64 `json:"failed"`
+}
+
+// validate checks the request's action, which is one of done, undone,
+// clear or tag, normalizing the tag of the tag action
+func (req *bulkRequest) validate() error {
+	switch req.Action {
+	case "done", "undone", "clear":
+	case "tag":
+		tags, err := normalizeTags(req.Tag)
+		if err != nil {
+			return err
+		}
+		if len(tags) != 1 {
+			return errors.New("a single tag is required")
+		}
+		req.Tag = tags[0]
+	default:
+		return fmt.Errorf("invalid action: %q", req.Action)
+	}
+	return nil
+}
+
+// bulkUpdate applies the request's action to every todo with one of its
+// ids in a single pass over the todos. Ids of todos that do not exist or
+// are archived are reported as missing.
+func (s *server) bulkUpdate(r *http.Request, req *bulkRequest) (*bulkResponse, error) {
+	prefix := keyPrefix(r)
+
+	todoList, _, err := s.loadTodos(r.Context(), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[uint64]bool)
+	for _, id := range req.IDs {
+		wanted[id] = true
+	}
+
+	res := &bulkResponse{
+		Modified:  []uint64{},
+		Unchanged: []uint64{},
+		Missing:   []uint64{},
+		Failed:    []uint64{},
+	}
+
+	for _, todo := range todoList {
+		if !wanted[todo.ID] {
+			continue
+		}
+		delete(wanted, todo.ID)
+
+		err := s.bulkApply(r, prefix, todo.ID, req)
+		switch {
+		case err == nil:
+			res.Modified = append(res.Modified, todo.ID)
+		case errors.Is(err, errUnchanged):
+			res.Unchanged = append(res.Unchanged, todo.ID)
+		case errors.Is(err, bitcask.ErrKeyNotFound):
+			res.Missing = append(res.Missing, todo.ID)
+		default:
+			requestLog(r).WithError(err).WithField("id", todo.ID).Error("error updating todo")
+			res.Failed = append(res.Failed, todo.ID)
+		}
+	}
+
+	for _, id := range req.IDs {
+		if wanted[id] {
+			delete(wanted, id)
+			res.Missing = append(res.Missing, id)
+		}
+	}
+
+	return res, nil
+}
+
+// bulkApply applies the request's action to the todo with the given id
+// like the routes changing a single todo do
+func (s *server) bulkApply(r *http.Request, prefix string, id uint64, req *bulkRequest) error {
+	if req.Action == "clear" {
+		todo, err := s.discardTodo(r.Context(), prefix, id)
+		if err == nil && todo != nil {
+			s.notifyAsync(r, eventDeleted, todo)
+		}
+		return err
+	}
+
+	before, todo, err := s.updateTodo(prefix, id, func(todo *Todo) error {
+		switch req.Action {
+		case "done", "undone":
+			done := req.Action == "done"
+			if todo.Done == done {
+				return errUnchanged
+			}
+			todo.setDone(done)
+			todo.UpdatedAt = time.Now()
+		case "tag":
+			if !todo.addTag(req.Tag) {
+				return errUnchanged
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.trackTodo(before, todo)
+	s.undo.Push(prefix, undoEntry{key: fmt.Sprintf("%stodo_%d", prefix, id), before: before})
+	if todo.Done && !before.Done {
+		s.notifyAsync(r, eventCompleted, todo)
+	}
+
+	return nil
+}
+
+// BulkHandler applies the action of the index's bulk action bar to the
+// checked todos
+func (s *server) BulkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_bulk")
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := &bulkRequest{Action: r.FormValue("action"), Tag: r.FormValue("tag")}
+		for _, v := range r.Form["ids"] {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Bad Request: invalid ids", http.StatusBadRequest)
+				return
+			}
+			req.IDs = append(req.IDs, id)
+		}
+		if err := req.validate(); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := s.bulkUpdate(r, req)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if wantsJSON(r) {
+			writeJSON(w, r, http.StatusOK, res)
+			return
+		}
+
+		redirectBack(w, r)
+	}
+}
+
+// BulkAPIHandler applies an action to all of the given todos, reporting
+// which todos were modified, unchanged, missing or failed
+func (s *server) BulkAPIHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_bulk")
+
+		var req bulkRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			http.Error(w, "Bad Request: invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := req.validate(); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := s.bulkUpdate(r, &req)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	rice "github.com/GeertJohan/go.rice"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// staticMaxAge is how long fingerprinted static assets are cached
+	staticMaxAge = 365 * 24 * time.Hour
+
+	// assetMaxAge is how long static assets requested without (or with a
+	// stale) fingerprint are cached
+	assetMaxAge = time.Hour
+
+	// exportMaxAge is how long exports of the todo list are cached
+	exportMaxAge = 5 * time.Minute
+)
+
+// setMaxAge allows the response to be cached for maxAge, setting both
+// Cache-Control (with any extra directives) and Expires for older caches
+func setMaxAge(w http.ResponseWriter, maxAge time.Duration, directives ...string) {
+	directives = append(directives, fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("Cache-Control", strings.Join(directives, ", "))
+	w.Header().Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+}
+
+// setNoCache requires clients to revalidate the response before reusing it
+func setNoCache(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "private, no-cache")
+}
+
+// assets fingerprints static files by content so links to them can be
+// cached indefinitely and still change whenever the file does
+type assets struct {
+	sync.Mutex
+
+	boxes    map[string]*rice.Box
+	versions map[string]string
+}
+
+func newAssets() *assets {
+	return &assets{
+		boxes:    make(map[string]*rice.Box),
+		versions: make(map[string]string),
+	}
+}
+
+// version returns the fingerprint of the asset at path, or an empty string
+// if there is no such asset
+func (a *assets) version(path string) string {
+	a.Lock()
+	defer a.Unlock()
+
+	if v, ok := a.versions[path]; ok {
+		return v
+	}
+
+	for prefix, box := range a.boxes {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		data, err := box.Bytes(strings.TrimPrefix(path, prefix))
+		if err != nil {
+			return ""
+		}
+		v := fmt.Sprintf("%x", sha256.Sum256(data))[:12]
+		a.versions[path] = v
+		return v
+	}
+
+	return ""
+}
+
+// URL returns the fingerprinted URL of the asset at path
+func (a *assets) URL(path string) string {
+	if v := a.version(path); v != "" {
+		return path + "?v=" + v
+	}
+	return path
+}
+
+// Handler serves the files in box under prefix. Requests carrying the
+// current fingerprint of the file are cached as immutable.
+func (a *assets) Handler(prefix string, box *rice.Box) httprouter.Handle {
+	a.Lock()
+	a.boxes[prefix] = box
+	a.Unlock()
+
+	fileServer := http.FileServer(box.HTTPBox())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		path := p.ByName("filepath")
+
+		if v := r.URL.Query().Get("v"); v != "" && v == a.version(prefix+strings.TrimPrefix(path, "/")) {
+			setMaxAge(w, staticMaxAge, "public", "immutable")
+		} else {
+			setMaxAge(w, assetMaxAge, "public")
+		}
+
+		r.URL.Path = path
+		fileServer.ServeHTTP(w, r)
+	}
+}
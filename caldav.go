@@ -0,0 +1,790 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+const (
+	// caldavPath is the root of the CalDAV server, which is both the
+	// user's principal and calendar home
+	caldavPath = "/caldav/"
+
+	// caldavCalendarPath is the user's one calendar, holding a VTODO
+	// resource for every todo that is not archived
+	caldavCalendarPath = "/caldav/todos/"
+
+	// caldavContentType is the content type of todo resources
+	caldavContentType = "text/calendar; charset=utf-8; component=vtodo"
+)
+
+// Namespaces of the WebDAV and CalDAV properties
+const (
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// davPrefixes are the prefixes multistatus responses declare for the
+// namespaces
+var davPrefixes = map[string]string{
+	nsDAV:            "d",
+	nsCalDAV:         "c",
+	nsCalendarServer: "cs",
+}
+
+// davPropNames are the properties a PROPFIND or REPORT asks for
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type davPropfind struct {
+	AllProp *struct{}     `xml:"DAV: allprop"`
+	Prop    *davPropNames `xml:"DAV: prop"`
+}
+
+type davCompFilter struct {
+	Name  string          `xml:"name,attr"`
+	Comps []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// davReport is a calendar-query or calendar-multiget REPORT
+type davReport struct {
+	XMLName xml.Name
+	Prop    *davPropNames `xml:"DAV: prop"`
+	Hrefs   []string      `xml:"DAV: href"`
+	Filter  struct {
+		Comp davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// davResource is a resource in a multistatus response with the values of
+// its properties as XML, or without any if it does not exist
+type davResource struct {
+	href  string
+	props map[xml.Name]string
+}
+
+// davElement returns an element of the property name with the XML content
+func davElement(name xml.Name, content string) string {
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		if content == "" {
+			return fmt.Sprintf("<%s:%s/>", prefix, name.Local)
+		}
+		return fmt.Sprintf("<%s:%s>%s</%s:%s>", prefix, name.Local, content, prefix, name.Local)
+	}
+
+	var ns bytes.Buffer
+	xml.EscapeText(&ns, []byte(name.Space))
+	return fmt.Sprintf(`<x:%s xmlns:x="%s"/>`, name.Local, ns.String())
+}
+
+// davText returns text escaped for an XML element
+func davText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writeMultistatus writes a 207 Multi-Status response with the requested
+// properties of the resources, or all of them if names is nil, reporting
+// the ones a resource does not have as not found
+func writeMultistatus(w http.ResponseWriter, resources []davResource, names []xml.Name) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+
+	for _, res := range resources {
+		b.WriteString("<d:response><d:href>" + davText(res.href) + "</d:href>")
+		if res.props == nil {
+			b.WriteString("<d:status>HTTP/1.1 404 Not Found</d:status></d:response>")
+			continue
+		}
+
+		var found, missing strings.Builder
+		if names == nil {
+			for name, value := range res.props {
+				found.WriteString(davElement(name, value))
+			}
+		}
+		for _, name := range names {
+			if value, ok := res.props[name]; ok {
+				found.WriteString(davElement(name, value))
+			} else {
+				missing.WriteString(davElement(name, ""))
+			}
+		}
+
+		if found.Len() > 0 {
+			b.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+		}
+		if missing.Len() > 0 {
+			b.WriteString("<d:propstat><d:prop>" + missing.String() + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+
+	b.WriteString("</d:multistatus>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+// requestedProps returns the properties asked for, nil for all of them
+func requestedProps(prop *davPropNames) []xml.Name {
+	if prop == nil {
+		return nil
+	}
+	names := []xml.Name{}
+	for _, n := range prop.Names {
+		names = append(names, n.XMLName)
+	}
+	return names
+}
+
+// caldavName returns the name of a todo's resource, its UID for todos
+// created by CalDAV clients (which expect to find them where they put
+// them) and its id otherwise
+func caldavName(todo *Todo) string {
+	if todo.UID != "" {
+		return todo.UID + ".ics"
+	}
+	return fmt.Sprintf("%d.ics", todo.ID)
+}
+
+// calendarData returns a todo as an iCalendar object
+func calendarData(r *http.Request, prefix string, todo *Todo) []byte {
+	var b bytes.Buffer
+	beginVCALENDAR(&b)
+	writeVTODO(&b, todo, icsUID(r, prefix, todo))
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.Bytes()
+}
+
+// calendarCTag returns a tag of the calendar's contents, which changes
+// whenever a todo is added, changed or removed
+func calendarCTag(todoList TodoList) string {
+	revs := make([]string, len(todoList))
+	for i, todo := range todoList {
+		revs[i] = fmt.Sprintf("%d:%d", todo.ID, todo.Rev)
+	}
+	sort.Strings(revs)
+
+	sum := sha256.Sum256([]byte(strings.Join(revs, ",")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// homeResource returns the principal and calendar home of the request's
+// user
+func homeResource(r *http.Request) davResource {
+	name := "todo"
+	if user := userFromRequest(r); user != nil {
+		name = user.Username
+	}
+
+	home := basePath(r) + caldavPath
+	return davResource{
+		href: home,
+		props: map[xml.Name]string{
+			{Space: nsDAV, Local: "resourcetype"}:           "<d:collection/><d:principal/>",
+			{Space: nsDAV, Local: "displayname"}:            davText(name),
+			{Space: nsDAV, Local: "current-user-principal"}: "<d:href>" + davText(home) + "</d:href>",
+			{Space: nsDAV, Local: "principal-URL"}:          "<d:href>" + davText(home) + "</d:href>",
+			{Space: nsCalDAV, Local: "calendar-home-set"}:   "<d:href>" + davText(home) + "</d:href>",
+		},
+	}
+}
+
+// calendarResource returns the calendar of the todos
+func calendarResource(r *http.Request, todoList TodoList) davResource {
+	return davResource{
+		href: basePath(r) + caldavCalendarPath,
+		props: map[xml.Name]string{
+			{Space: nsDAV, Local: "resourcetype"}:                        "<d:collection/><c:calendar/>",
+			{Space: nsDAV, Local: "displayname"}:                         "todo",
+			{Space: nsDAV, Local: "current-user-principal"}:              "<d:href>" + davText(basePath(r)+caldavPath) + "</d:href>",
+			{Space: nsDAV, Local: "current-user-privilege-set"}:          "<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege><d:privilege><d:bind/></d:privilege><d:privilege><d:unbind/></d:privilege>",
+			{Space: nsDAV, Local: "supported-report-set"}:                "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report><d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>",
+			{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<c:comp name="VTODO"/>`,
+			{Space: nsCalendarServer, Local: "getctag"}:                  calendarCTag(todoList),
+		},
+	}
+}
+
+// todoResource returns the resource of a todo, with its calendar data if
+// data is set
+func todoResource(r *http.Request, prefix string, todo *Todo, data bool) davResource {
+	res := davResource{
+		href: basePath(r) + caldavCalendarPath + url.PathEscape(caldavName(todo)),
+		props: map[xml.Name]string{
+			{Space: nsDAV, Local: "resourcetype"}:    "",
+			{Space: nsDAV, Local: "getetag"}:         davText(etag(todo)),
+			{Space: nsDAV, Local: "getcontenttype"}:  caldavContentType,
+			{Space: nsDAV, Local: "getlastmodified"}: todo.UpdatedAt.UTC().Format(http.TimeFormat),
+		},
+	}
+	if data {
+		res.props[xml.Name{Space: nsCalDAV, Local: "calendar-data"}] = davText(string(calendarData(r, prefix, todo)))
+	}
+	return res
+}
+
+// findCalDAVTodo returns the todo whose resource has the given name, nil
+// if there is none. Resources are also found by the todo's id.
+func findCalDAVTodo(todoList TodoList, name string) *Todo {
+	for _, todo := range todoList {
+		if caldavName(todo) == name {
+			return todo
+		}
+	}
+
+	if id, err := strconv.ParseUint(strings.TrimSuffix(name, ".ics"), 10, 64); err == nil {
+		for _, todo := range todoList {
+			if todo.ID == id {
+				return todo
+			}
+		}
+	}
+
+	return nil
+}
+
+// caldavDepth returns the Depth of a PROPFIND, infinity being treated as 1
+func caldavDepth(r *http.Request) int {
+	if r.Header.Get("Depth") == "0" {
+		return 0
+	}
+	return 1
+}
+
+// CalDAVOptionsHandler advertises the CalDAV server to clients
+func (s *server) CalDAVOptionsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// CalDAVWellKnownHandler points clients discovering the server at its
+// root
+func (s *server) CalDAVWellKnownHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		http.Redirect(w, r, caldavPath, http.StatusMovedPermanently)
+	}
+}
+
+// CalDAVPropfindHandler returns the properties of the principal, the
+// calendar or a todo
+func (s *server) CalDAVPropfindHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_caldav_propfind")
+
+		var req davPropfind
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := xml.Unmarshal(data, &req); err != nil {
+				http.Error(w, "Bad Request: invalid propfind", http.StatusBadRequest)
+				return
+			}
+		}
+		names := requestedProps(req.Prop)
+
+		prefix := keyPrefix(r)
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		var resources []davResource
+		switch name := p.ByName("name"); {
+		case r.URL.Path == caldavPath:
+			resources = append(resources, homeResource(r))
+			if caldavDepth(r) > 0 {
+				resources = append(resources, calendarResource(r, todoList))
+			}
+		case name == "":
+			resources = append(resources, calendarResource(r, todoList))
+			if caldavDepth(r) > 0 {
+				sortTodos(todoList)
+				for _, todo := range todoList {
+					resources = append(resources, todoResource(r, prefix, todo, false))
+				}
+			}
+		default:
+			todo := findCalDAVTodo(todoList, name)
+			if todo == nil {
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			resources = append(resources, todoResource(r, prefix, todo, false))
+		}
+
+		writeMultistatus(w, resources, names)
+	}
+}
+
+// CalDAVReportHandler answers calendar-query REPORTs with every todo and
+// calendar-multiget REPORTs with the todos asked for
+func (s *server) CalDAVReportHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_caldav_report")
+
+		var req davReport
+		if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			http.Error(w, "Bad Request: invalid report", http.StatusBadRequest)
+			return
+		}
+		names := requestedProps(req.Prop)
+		data := names == nil
+		for _, name := range names {
+			if name == (xml.Name{Space: nsCalDAV, Local: "calendar-data"}) {
+				data = true
+			}
+		}
+
+		prefix := keyPrefix(r)
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		sortTodos(todoList)
+
+		resources := []davResource{}
+		switch req.XMLName {
+		case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+			// Only VTODOs are stored, so queries for other components
+			// match nothing
+			for _, comp := range req.Filter.Comp.Comps {
+				if !strings.EqualFold(comp.Name, "VTODO") {
+					todoList = nil
+				}
+			}
+			for _, todo := range todoList {
+				resources = append(resources, todoResource(r, prefix, todo, data))
+			}
+
+		case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+			for _, href := range req.Hrefs {
+				u, err := url.Parse(strings.TrimSpace(href))
+				calendar := basePath(r) + caldavCalendarPath
+				if err != nil || !strings.HasPrefix(u.Path, calendar) {
+					continue
+				}
+				todo := findCalDAVTodo(todoList, strings.TrimPrefix(u.Path, calendar))
+				if todo == nil {
+					// Todos deleted since the client listed them
+					resources = append(resources, davResource{href: u.Path})
+					continue
+				}
+				resources = append(resources, todoResource(r, prefix, todo, data))
+			}
+
+		default:
+			http.Error(w, "Forbidden: unsupported report", http.StatusForbidden)
+			return
+		}
+
+		writeMultistatus(w, resources, names)
+	}
+}
+
+// CalDAVGetHandler returns a todo as an iCalendar object
+func (s *server) CalDAVGetHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_caldav_get")
+
+		prefix := keyPrefix(r)
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		todo := findCalDAVTodo(todoList, p.ByName("name"))
+		if todo == nil {
+			http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", caldavContentType)
+		w.Header().Set("ETag", etag(todo))
+		setNoCache(w)
+		http.ServeContent(w, r, "", todo.UpdatedAt, bytes.NewReader(calendarData(r, prefix, todo)))
+	}
+}
+
+// CalDAVPutHandler creates or replaces a todo from the VTODO of an
+// iCalendar object. Properties todo has no equivalent for are dropped;
+// its color, reminder and list are kept.
+func (s *server) CalDAVPutHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_caldav_put")
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		u, uid, err := parseVTODO(string(data))
+		if err != nil {
+			if errors.Is(err, errUnsupportedComponent) {
+				http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+				return
+			}
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := u.normalize(s.maxTitleLength); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		match := strings.TrimSpace(r.Header.Get("If-Match"))
+		existing := findCalDAVTodo(todoList, p.ByName("name"))
+		if existing == nil {
+			if match != "" {
+				http.Error(w, "Precondition Failed: no such todo", http.StatusPreconditionFailed)
+				return
+			}
+
+			u.uid = uid
+			todo, err := s.createTodo(r, prefix, u)
+			if errors.Is(err, errTooManyTodos) {
+				http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				requestLog(r).WithError(err).Error("error adding todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("ETag", etag(todo))
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == "*" {
+			http.Error(w, "Precondition Failed: todo exists", http.StatusPreconditionFailed)
+			return
+		}
+
+		before, todo, err := s.updateTodo(prefix, existing.ID, func(todo *Todo) error {
+			if match != "" && match != "*" && match != etag(todo) {
+				return errConflict
+			}
+			u.apply(todo)
+			return nil
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, bitcask.ErrKeyNotFound):
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+			case errors.Is(err, errConflict):
+				http.Error(w, "Precondition Failed: "+err.Error(), http.StatusPreconditionFailed)
+			default:
+				requestLog(r).WithError(err).WithField("id", existing.ID).Error("error updating todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.trackTodo(before, todo)
+		s.undo.Push(prefix, undoEntry{key: fmt.Sprintf("%stodo_%d", prefix, todo.ID), before: before})
+		if !before.Done && todo.Done {
+			s.notifyAsync(r, eventCompleted, todo)
+		}
+
+		w.Header().Set("ETag", etag(todo))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CalDAVDeleteHandler moves a todo to the trash
+func (s *server) CalDAVDeleteHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_caldav_delete")
+
+		prefix := keyPrefix(r)
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		existing := findCalDAVTodo(todoList, p.ByName("name"))
+		if existing == nil {
+			http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+			return
+		}
+		if match := strings.TrimSpace(r.Header.Get("If-Match")); match != "" && match != "*" && match != etag(existing) {
+			http.Error(w, "Precondition Failed: "+errConflict.Error(), http.StatusPreconditionFailed)
+			return
+		}
+
+		todo, err := s.discardTodo(r.Context(), prefix, existing.ID)
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("id", existing.ID).Error("error deleting todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if todo != nil {
+			s.notifyAsync(r, eventDeleted, todo)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// errUnsupportedComponent is returned parsing an iCalendar object without
+// a VTODO, the only component the calendar holds
+var errUnsupportedComponent = errors.New("only VTODO components are supported")
+
+// parseVTODO parses the first VTODO of an iCalendar object into an update
+// replacing the todo's title, notes, state, tags, due date and priority,
+// returning it with the VTODO's UID
+func parseVTODO(data string) (*todoUpdate, string, error) {
+	// Unfold lines continued on the next
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	var (
+		uid, title, body, status, due, prio string
+
+		tags      []string
+		completed bool
+
+		// depth is how deep in the VTODO the line is, 1 for its own
+		// properties and more for those of components like VALARM
+		depth int
+		found bool
+	)
+
+	for _, line := range strings.Split(data, "\n") {
+		name, params, value := splitICSLine(line)
+
+		switch {
+		case name == "BEGIN" && depth == 0:
+			if strings.EqualFold(value, "VTODO") && !found {
+				depth = 1
+			}
+			continue
+		case name == "BEGIN":
+			depth++
+			continue
+		case name == "END" && depth > 0:
+			depth--
+			if depth == 0 {
+				found = true
+			}
+			continue
+		}
+		if depth != 1 {
+			continue
+		}
+
+		switch name {
+		case "UID":
+			uid = value
+		case "SUMMARY":
+			title = icsUnescape(value)
+		case "DESCRIPTION":
+			body = icsUnescape(value)
+		case "STATUS":
+			status = strings.ToUpper(value)
+		case "COMPLETED":
+			completed = true
+		case "PRIORITY":
+			prio = value
+		case "CATEGORIES":
+			for _, tag := range splitICSList(value) {
+				// Categories that are not valid tags are dropped
+				if normalized, err := normalizeTags(tag); err == nil {
+					tags = append(tags, normalized...)
+				}
+			}
+		case "DUE":
+			t, err := parseICSTime(value, params)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid due date: %q", value)
+			}
+			due = t
+		}
+	}
+
+	if !found {
+		return nil, "", errUnsupportedComponent
+	}
+	if uid == "" {
+		return nil, "", errors.New("UID is required")
+	}
+
+	done := status == "COMPLETED" || (status == "" && completed)
+
+	p := "none"
+	if n, err := strconv.Atoi(prio); err == nil {
+		switch {
+		case n >= 1 && n <= 4:
+			p = "high"
+		case n == 5:
+			p = "med"
+		case n >= 6 && n <= 9:
+			p = "low"
+		}
+	}
+
+	tags, _ = normalizeTags(tags...)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return &todoUpdate{
+		Title:    &title,
+		Body:     &body,
+		Done:     &done,
+		Tags:     &tags,
+		Due:      &due,
+		Priority: &p,
+	}, uid, nil
+}
+
+// splitICSLine splits a content line into its upper cased name, its
+// parameters and its value
+func splitICSLine(line string) (string, map[string]string, string) {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if quoted {
+				continue
+			}
+			parts := strings.Split(line[:i], ";")
+			params := make(map[string]string)
+			for _, param := range parts[1:] {
+				if eq := strings.IndexByte(param, '='); eq > 0 {
+					params[strings.ToUpper(param[:eq])] = strings.Trim(param[eq+1:], `"`)
+				}
+			}
+			return strings.ToUpper(parts[0]), params, strings.TrimRight(line[i+1:], "\r")
+		}
+	}
+	return "", nil, ""
+}
+
+// icsUnescape unescapes an iCalendar text value, the reverse of icsEscape
+func icsUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitICSList splits an iCalendar list of text values at the commas that
+// are not escaped
+func splitICSList(s string) []string {
+	var (
+		values []string
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, icsUnescape(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, icsUnescape(s[start:]))
+}
+
+// parseICSTime parses an iCalendar date or date-time as a due date todo
+// understands, a 2006-01-02 date or an RFC3339 time
+func parseICSTime(value string, params map[string]string) (string, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(icsDateFormat) {
+		t, err := time.Parse(icsDateFormat, value)
+		if err != nil {
+			return "", err
+		}
+		return t.Format("2006-01-02"), nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsTimeFormat, value)
+		if err != nil {
+			return "", err
+		}
+		return t.Format(time.RFC3339), nil
+	}
+
+	// Times without a zone are floating, in the server's zone unless
+	// the zone is one it knows
+	loc := time.Local
+	if tzid, ok := params["TZID"]; ok {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339), nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// icsObject joins lines into an iCalendar object with CRLF line endings
+func icsObject(lines ...string) string {
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestParseVTODO(t *testing.T) {
+	data := icsObject(
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VTODO",
+		"UID:abc-123",
+		"SUMMARY:buy milk\\, eggs\\; and a very long title that the client folded",
+		"  onto a second line",
+		"DESCRIPTION:first\\nsecond",
+		"CATEGORIES:shopping,Home,not a tag",
+		"DUE;VALUE=DATE:20240102",
+		"PRIORITY:1",
+		"STATUS:COMPLETED",
+		"BEGIN:VALARM",
+		"SUMMARY:alarm",
+		"END:VALARM",
+		"END:VTODO",
+		"END:VCALENDAR",
+	)
+
+	u, uid, err := parseVTODO(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != "abc-123" {
+		t.Errorf("expected UID abc-123, got %q", uid)
+	}
+	if expected := "buy milk, eggs; and a very long title that the client folded onto a second line"; *u.Title != expected {
+		t.Errorf("expected title %q, got %q", expected, *u.Title)
+	}
+	if *u.Body != "first\nsecond" {
+		t.Errorf("expected the description as the body, got %q", *u.Body)
+	}
+	if expected := []string{"shopping", "home", "not-a-tag"}; !reflect.DeepEqual(*u.Tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, *u.Tags)
+	}
+	if *u.Due != "2024-01-02" || *u.Priority != "high" || !*u.Done {
+		t.Errorf("expected due 2024-01-02, high priority and done, got %q, %q, %v", *u.Due, *u.Priority, *u.Done)
+	}
+
+	// A todo without these properties is cleared
+	u, _, err = parseVTODO(icsObject("BEGIN:VTODO", "UID:abc-123", "END:VTODO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *u.Title != "" || *u.Due != "" || *u.Priority != "none" || *u.Done || len(*u.Tags) != 0 {
+		t.Errorf("expected an empty update, got %+v", u)
+	}
+}
+
+func TestParseVTODOErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        string
+		unsupported bool
+	}{
+		{"event", icsObject("BEGIN:VCALENDAR", "BEGIN:VEVENT", "UID:abc-123", "END:VEVENT", "END:VCALENDAR"), true},
+		{"empty", "", true},
+		{"missing UID", icsObject("BEGIN:VTODO", "SUMMARY:buy milk", "END:VTODO"), false},
+		{"malformed DUE", icsObject("BEGIN:VTODO", "UID:abc-123", "DUE:tomorrow", "END:VTODO"), false},
+	} {
+		_, _, err := parseVTODO(tc.data)
+		if err == nil {
+			t.Errorf("expected an error for %s", tc.name)
+			continue
+		}
+		if errors.Is(err, errUnsupportedComponent) != tc.unsupported {
+			t.Errorf("expected %s to be unsupported: %v, got %v", tc.name, tc.unsupported, err)
+		}
+	}
+}
+
+func TestSplitICSLine(t *testing.T) {
+	for _, tc := range []struct {
+		line   string
+		name   string
+		params map[string]string
+		value  string
+	}{
+		{"SUMMARY:buy milk", "SUMMARY", map[string]string{}, "buy milk"},
+		{"due;tzid=Europe/Berlin:20240102T150000", "DUE", map[string]string{"TZID": "Europe/Berlin"}, "20240102T150000"},
+		{`ATTENDEE;CN="Doe: Jane";ROLE=CHAIR:mailto:jane@example.com`, "ATTENDEE", map[string]string{"CN": "Doe: Jane", "ROLE": "CHAIR"}, "mailto:jane@example.com"},
+		{"DESCRIPTION:a:b\r", "DESCRIPTION", map[string]string{}, "a:b"},
+		{"no value", "", nil, ""},
+	} {
+		name, params, value := splitICSLine(tc.line)
+		if name != tc.name || !reflect.DeepEqual(params, tc.params) || value != tc.value {
+			t.Errorf("expected %q to split into %q %v %q, got %q %v %q", tc.line, tc.name, tc.params, tc.value, name, params, value)
+		}
+	}
+}
+
+func TestParseICSTime(t *testing.T) {
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+
+	for _, tc := range []struct {
+		value    string
+		params   map[string]string
+		expected string
+	}{
+		{"20240102", map[string]string{"VALUE": "DATE"}, "2024-01-02"},
+		{"20240102", nil, "2024-01-02"},
+		{"20240102T150000Z", nil, "2024-01-02T15:00:00Z"},
+		{"20240102T150000", nil, "2024-01-02T15:00:00+02:00"},
+		{"20240102T150000", map[string]string{"TZID": "Nowhere/Special"}, "2024-01-02T15:00:00+02:00"},
+	} {
+		if got, err := parseICSTime(tc.value, tc.params); err != nil || got != tc.expected {
+			t.Errorf("expected %q %v to parse as %q, got %q, %v", tc.value, tc.params, tc.expected, got, err)
+		}
+	}
+
+	for _, value := range []string{"tomorrow", "20241302", "20240102T250000Z", "20240102T1500"} {
+		if _, err := parseICSTime(value, nil); err == nil {
+			t.Errorf("expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestCalDAVPutDelete(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	put := func(name, data, match string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PUT", caldavCalendarPath+name, strings.NewReader(data))
+		r.Header.Set("Content-Type", caldavContentType)
+		if match != "" {
+			r.Header.Set("If-Match", match)
+		}
+		return serveRequest(s, r)
+	}
+	vtodo := func(title string) string {
+		return icsObject("BEGIN:VCALENDAR", "BEGIN:VTODO", "UID:abc-123", "SUMMARY:"+title, "CATEGORIES:shopping", "END:VTODO", "END:VCALENDAR")
+	}
+
+	w := put("abc-123.ics", vtodo("buy milk"), "")
+	if w.Code != 201 {
+		t.Fatalf("expected 201 creating a todo, got %d: %s", w.Code, w.Body)
+	}
+	created := w.Header().Get("ETag")
+
+	w = serve(s, "GET", caldavCalendarPath+"abc-123.ics", nil)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "SUMMARY:buy milk\r\n") || !strings.Contains(w.Body.String(), "UID:abc-123\r\n") {
+		t.Errorf("expected the todo to be served back, got %d:\n%s", w.Code, w.Body)
+	}
+	if w.Header().Get("ETag") != created {
+		t.Errorf("expected ETag %s, got %s", created, w.Header().Get("ETag"))
+	}
+
+	if w := put("abc-123.ics", vtodo("buy oat milk"), created); w.Code != 204 {
+		t.Fatalf("expected 204 replacing the todo, got %d: %s", w.Code, w.Body)
+	}
+	todoList, _, err := s.loadTodos(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := findCalDAVTodo(todoList, "abc-123.ics")
+	if todo == nil {
+		t.Fatal("expected the todo to be stored")
+	}
+	if todo.Title != "buy oat milk" || !reflect.DeepEqual(todo.Tags, []string{"shopping"}) || todo.UID != "abc-123" {
+		t.Errorf("expected the todo to be replaced, got %+v", todo)
+	}
+
+	if w := put("abc-123.ics", vtodo("buy cream"), created); w.Code != 412 {
+		t.Errorf("expected 412 replacing with a stale ETag, got %d", w.Code)
+	}
+	if w := put("def-456.ics", icsObject("BEGIN:VTODO", "SUMMARY:no uid", "END:VTODO"), ""); w.Code != 400 {
+		t.Errorf("expected 400 without a UID, got %d", w.Code)
+	}
+	if w := put("def-456.ics", icsObject("BEGIN:VTODO", "UID:def-456", "DUE:someday", "END:VTODO"), ""); w.Code != 400 {
+		t.Errorf("expected 400 for a malformed DUE, got %d", w.Code)
+	}
+	if w := put("def-456.ics", icsObject("BEGIN:VEVENT", "UID:def-456", "END:VEVENT"), ""); w.Code != 403 {
+		t.Errorf("expected 403 for an event, got %d", w.Code)
+	}
+
+	if w := serve(s, "DELETE", caldavCalendarPath+"abc-123.ics", nil); w.Code != 204 {
+		t.Fatalf("expected 204 deleting the todo, got %d", w.Code)
+	}
+	if s.db.Has([]byte(fmt.Sprintf("todo_%d", todo.ID))) || !s.db.Has([]byte(fmt.Sprintf("trash_%d", todo.ID))) {
+		t.Error("expected the todo to be moved to the trash")
+	}
+	if w := serve(s, "DELETE", caldavCalendarPath+"abc-123.ics", nil); w.Code != 404 {
+		t.Errorf("expected 404 deleting the todo again, got %d", w.Code)
+	}
+	if w := serve(s, "GET", caldavCalendarPath+"abc-123.ics", nil); w.Code != 404 {
+		t.Errorf("expected 404 getting a deleted todo, got %d", w.Code)
+	}
+}
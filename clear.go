@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+type clearCompletedResponse struct {
+	Cleared int `json:"cleared"`
+}
+
+// clearCompleted moves every completed todo under prefix to the trash, or
+// archives them if archive is set, in a single pass over the todos and
+// returns the number cleared
+func (s *server) clearCompleted(r *http.Request, prefix string, archive bool) (int, error) {
+	todoList, _, err := s.loadTodos(r.Context(), prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	var cleared int
+	for _, todo := range todoList {
+		if !todo.Done {
+			continue
+		}
+
+		if archive {
+			if err := s.archiveTodo(prefix, todo.ID); err != nil {
+				if errors.Is(err, bitcask.ErrKeyNotFound) {
+					continue
+				}
+				return cleared, err
+			}
+		} else {
+			trashed, err := s.trashTodo(prefix, todoNamespace, todo.ID)
+			if err != nil {
+				if errors.Is(err, bitcask.ErrKeyNotFound) {
+					continue
+				}
+				return cleared, err
+			}
+			s.notifyAsync(r, eventDeleted, trashed)
+		}
+		cleared++
+	}
+
+	return cleared, nil
+}
+
+// ClearCompletedHandler moves every completed todo to the trash at once, or
+// archives them with archive=true. Following a link only asks for confirmation,
+// showing how many todos would be cleared.
+func (s *server) ClearCompletedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_clear_completed")
+
+		prefix := keyPrefix(r)
+
+		if r.Method == http.MethodGet {
+			todoList, _, err := s.loadTodos(r.Context(), prefix)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error listing todos")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			ctx := &templateContext{Title: "clear completed", ReturnTo: backURL(r)}
+			for _, todo := range todoList {
+				if todo.Done {
+					ctx.Total++
+				}
+			}
+
+			s.render("confirm", w, r, ctx)
+			return
+		}
+
+		cleared, err := s.clearCompleted(r, prefix, r.FormValue("archive") == "true")
+		if err != nil {
+			requestLog(r).WithError(err).WithField("cleared", cleared).Error("error clearing completed todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if wantsJSON(r) {
+			writeJSON(w, r, http.StatusOK, clearCompletedResponse{Cleared: cleared})
+			return
+		}
+
+		redirectBack(w, r)
+	}
+}
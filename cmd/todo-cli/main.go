@@ -0,0 +1,242 @@
+// Command todo-cli manages the todos of a todo server from the terminal
+// through its API.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/namsral/flag"
+)
+
+const usage = `usage: todo-cli [options] <command> [arguments]
+
+commands:
+  add <title>   add a todo
+  list          list the todos
+  done <id>     mark a todo as done
+  clear <id>    delete a todo
+
+options:
+`
+
+// todo is the part of a todo returned by the API that is shown
+type todo struct {
+	ID    uint64
+	Title string
+	Done  bool
+}
+
+type todosPage struct {
+	Todos []todo  `json:"todos"`
+	Next  *uint64 `json:"next"`
+}
+
+// client makes requests to the API of a todo server
+type client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+// do sends a request with the header and body encoded as JSON, if not
+// nil, and decodes the response into v, if not nil, returning the
+// response's header. Responses that are not successful are returned as
+// errors with the server's message.
+func (c *client) do(method, path string, header http.Header, body, v interface{}) (http.Header, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.url, "/")+path, r)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, err := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		if err != nil {
+			return nil, fmt.Errorf("%s: error reading response: %w", res.Status, err)
+		}
+		if len(bytes.TrimSpace(msg)) == 0 {
+			msg = []byte(res.Status)
+		}
+		return nil, errors.New(string(bytes.TrimSpace(msg)))
+	}
+
+	if v == nil {
+		return res.Header, nil
+	}
+	return res.Header, json.NewDecoder(res.Body).Decode(v)
+}
+
+func (c *client) add(title string) error {
+	var t todo
+	if _, err := c.do("POST", "/api/todos", nil, map[string]string{"title": title}, &t); err != nil {
+		return err
+	}
+	fmt.Printf("added %d: %s\n", t.ID, t.Title)
+	return nil
+}
+
+func (c *client) list() error {
+	path := "/api/todos"
+	for {
+		var page todosPage
+		if _, err := c.do("GET", path, nil, nil, &page); err != nil {
+			return err
+		}
+
+		for _, t := range page.Todos {
+			mark := " "
+			if t.Done {
+				mark = "x"
+			}
+			fmt.Printf("%3d [%s] %s\n", t.ID, mark, t.Title)
+		}
+
+		if page.Next == nil {
+			return nil
+		}
+		path = "/api/todos?after=" + strconv.FormatUint(*page.Next, 10)
+	}
+}
+
+// done marks a todo as done, sending the ETag of its current version as
+// the server requires
+func (c *client) done(id uint64) error {
+	path := fmt.Sprintf("/api/todos/%d", id)
+
+	var t todo
+	header, err := c.do("GET", path, nil, nil, &t)
+	if err != nil {
+		return err
+	}
+
+	ifMatch := http.Header{"If-Match": {header.Get("ETag")}}
+	if _, err := c.do("PATCH", path, ifMatch, map[string]bool{"done": true}, &t); err != nil {
+		return err
+	}
+	fmt.Printf("done %d: %s\n", t.ID, t.Title)
+	return nil
+}
+
+func (c *client) clear(id uint64) error {
+	if _, err := c.do("DELETE", fmt.Sprintf("/api/todos/%d", id), nil, nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d\n", id)
+	return nil
+}
+
+// defaultConfigPath returns the configuration file read when -config is
+// not given, if it exists
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "todo", "cli.conf")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+func main() {
+	var (
+		serverURL string
+		token     string
+		timeout   time.Duration
+	)
+
+	fs := flag.NewFlagSetWithEnvPrefix(os.Args[0], "TODO", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	fs.String(flag.DefaultConfigFlagname, defaultConfigPath(), "path of a configuration file of name value lines")
+	fs.StringVar(&serverURL, "url", "http://localhost:8000", "URL of the todo server")
+	fs.StringVar(&token, "token", "", "API token or key to authenticate with")
+	fs.DurationVar(&timeout, "timeout", 10*time.Second, "maximum time to wait for the server")
+	fs.Parse(os.Args[1:])
+
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if _, err := url.ParseRequestURI(serverURL); err != nil {
+		fatalf("invalid -url: %q", serverURL)
+	}
+
+	c := &client{url: serverURL, token: token, http: &http.Client{Timeout: timeout}}
+
+	var err error
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "add":
+		title := strings.TrimSpace(strings.Join(args, " "))
+		if title == "" {
+			fatalf("usage: todo-cli add <title>")
+		}
+		err = c.add(title)
+	case "list", "ls":
+		err = c.list()
+	case "done", "clear":
+		if len(args) != 1 {
+			fatalf("usage: todo-cli %s <id>", cmd)
+		}
+		id, perr := strconv.ParseUint(args[0], 10, 64)
+		if perr != nil {
+			fatalf("invalid id: %q", args[0])
+		}
+		if cmd == "done" {
+			err = c.done(id)
+		} else {
+			err = c.clear(id)
+		}
+	default:
+		fatalf("unknown command: %q", cmd)
+	}
+	if err != nil {
+		fatalf("%s", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "todo-cli: "+format+"\n", args...)
+	os.Exit(1)
+}
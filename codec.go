@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// ErrDecrypt is returned when a stored value cannot be decrypted, either
+// because it is corrupted or because the wrong encryption key is used
+var ErrDecrypt = errors.New("error: unable to decrypt value")
+
+// codec encodes values before they are stored in the database and decodes
+// them after they are read back
+type codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// jsonCodec stores values as plain JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// aesCodec stores values as JSON encrypted with AES-GCM. Each value is
+// prefixed with its random nonce.
+type aesCodec struct {
+	aead cipher.AEAD
+}
+
+// newAESCodec returns an aesCodec whose 256-bit key is derived from the
+// given passphrase
+func newAESCodec(passphrase string) (*aesCodec, error) {
+	key := sha256.Sum256([]byte(passphrase))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesCodec{aead: aead}, nil
+}
+
+func (c *aesCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (c *aesCodec) Unmarshal(data []byte, v interface{}) error {
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return ErrDecrypt
+	}
+
+	plaintext, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+
+	return json.Unmarshal(plaintext, v)
+}
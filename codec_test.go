@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAESCodecRoundTrip(t *testing.T) {
+	c, err := newAESCodec("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.Marshal(&Todo{ID: 1, Title: "buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("buy milk")) {
+		t.Error("expected the title not to be stored in plain text")
+	}
+
+	var todo Todo
+	if err := c.Unmarshal(data, &todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo.ID != 1 || todo.Title != "buy milk" {
+		t.Errorf("expected the todo back, got %+v", todo)
+	}
+}
+
+func TestAESCodecWrongKey(t *testing.T) {
+	c, err := newAESCodec("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong, err := newAESCodec("guess")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.Marshal(&Todo{ID: 1, Title: "buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var todo Todo
+	if err := wrong.Unmarshal(data, &todo); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt with the wrong key, got %v", err)
+	}
+	if todo.Title != "" {
+		t.Errorf("expected nothing to be decoded, got %+v", todo)
+	}
+
+	if err := c.Unmarshal([]byte("short"), &todo); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for a truncated value, got %v", err)
+	}
+}
+
+func TestEncryptedServer(t *testing.T) {
+	c, err := newAESCodec("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newMemoryStore()
+	s := newTestServer(t, db, withEncryption(c))
+	addTestTodo(t, s, "buy milk")
+
+	data, err := db.Get([]byte("todo_0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("buy milk")) {
+		t.Error("expected the stored todo to be encrypted")
+	}
+
+	todo, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Title != "buy milk" {
+		t.Errorf("expected the todo to be decrypted, got %+v", todo)
+	}
+}
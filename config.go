@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/namsral/flag"
+	"gopkg.in/yaml.v2"
+)
+
+// parseConfigFile sets the flags of fs not already given as flags or in the
+// environment from the configuration file at path. A .yaml or .yml file is
+// a YAML mapping of flag names to values, lists being joined with commas,
+// and any other file has a flag name and value on each line.
+func parseConfigFile(fs *flag.FlagSet, path string) error {
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".yaml" && ext != ".yml" {
+		return fs.ParseFile(path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("configuration variable provided but not defined: %s", name)
+		}
+		if set[name] {
+			continue
+		}
+
+		value, err := configValue(settings[name])
+		if err != nil {
+			return fmt.Errorf("invalid value for configuration variable %s: %w", name, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for configuration variable %s: %w", value, name, err)
+		}
+	}
+
+	return nil
+}
+
+// configValue returns a YAML value as a flag value
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, ok := item.(map[interface{}]interface{}); ok {
+				return "", errors.New("expected a list of values")
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ","), nil
+	case map[interface{}]interface{}:
+		return "", errors.New("expected a value, got a mapping")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
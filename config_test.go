@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/namsral/flag"
+)
+
+// parseTestConfig parses args and then the configuration file name holding
+// data into a flag set of a few settings
+func parseTestConfig(t *testing.T, name, data string, args ...string) (map[string]string, error) {
+	dir, err := ioutil.TempDir("", "todo-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.String("bind", "0.0.0.0:8000", "")
+	fs.String("apikeys", "", "")
+	fs.Bool("gzip", true, "")
+	fs.Int("maxtodos", 100, "")
+	fs.Duration("readtimeout", defaultReadTimeout, "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parseConfigFile(fs, path); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values, nil
+}
+
+func TestConfigFileYAML(t *testing.T) {
+	data := "# todo.yaml\n" +
+		"bind: 127.0.0.1:8443\n" +
+		"apikeys:\n" +
+		"  - abc\n" +
+		"  - def\n" +
+		"gzip: false\n" +
+		"maxtodos: 20\n" +
+		"readtimeout: 5s\n"
+
+	values, err := parseTestConfig(t, "todo.yaml", data, "-maxtodos", "50")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"bind":        "127.0.0.1:8443",
+		"apikeys":     "abc,def",
+		"gzip":        "false",
+		"maxtodos":    "50",
+		"readtimeout": "5s",
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("expected %s to be %q, got %q", name, value, values[name])
+		}
+	}
+}
+
+func TestConfigFileLines(t *testing.T) {
+	values, err := parseTestConfig(t, "todo.conf", "bind 127.0.0.1:8443\nmaxtodos 20\n", "-bind", "127.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values["bind"] != "127.0.0.1:9000" || values["maxtodos"] != "20" {
+		t.Errorf("expected flags to take precedence over the file, got %v", values)
+	}
+}
+
+func TestConfigFileInvalid(t *testing.T) {
+	for _, data := range []string{
+		"bind: [\n",
+		"nosuchflag: true\n",
+		"bind:\n  host: 127.0.0.1\n",
+		"maxtodos: lots\n",
+	} {
+		if _, err := parseTestConfig(t, "todo.yml", data); err == nil {
+			t.Errorf("expected an error parsing %q", strings.TrimSpace(data))
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const (
+	// csrfCookie holds the CSRF token of a browser, forms post it back in
+	// csrfField and scripts send it in csrfHeader
+	csrfCookie = "csrf"
+	csrfField  = "csrf"
+	csrfHeader = "X-CSRF-Token"
+
+	// csrfCookieMaxAge is how long a browser keeps its CSRF token
+	csrfCookieMaxAge = 365 * 24 * time.Hour
+)
+
+// randomToken returns a random URL safe token, for CSRF and API tokens
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// csrfTokenFromRequest returns the CSRF token templates embed in forms
+func csrfTokenFromRequest(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey).(string)
+	return token
+}
+
+// safeMethod reports whether requests with the method do not change
+// anything
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// fromBrowser reports whether a request was made by a browser, which sends
+// cookies and (on cross-site requests) Origin or Sec-Fetch-Site on its own.
+// Other clients cannot be tricked into making a request by another site.
+func fromBrowser(r *http.Request) bool {
+	return r.Header.Get("Cookie") != "" ||
+		r.Header.Get("Origin") != "" ||
+		r.Header.Get("Sec-Fetch-Site") != ""
+}
+
+// submittedCSRFToken returns the CSRF token sent in the csrfHeader header
+// or, for forms, the csrfField field
+func submittedCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if token := r.Header.Get(csrfHeader); token != "" {
+		return token
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+		return ""
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	return r.PostFormValue(csrfField)
+}
+
+// csrfProtect gives every browser a CSRF token in a cookie and refuses
+// changes made by a browser without that token, so other sites cannot
+// post forms to todo on a user's behalf. Requests carrying an API key
+// are not affected as browsers never add one by themselves.
+func (s *server) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if cookie, err := r.Cookie(csrfCookie); err == nil {
+			token = cookie.Value
+		}
+
+		// CalDAV clients keep the cookie without sending the token back.
+		// CalDAV requests are only authenticated with HTTP Basic
+		// authentication and other sites cannot send their methods.
+		if !safeMethod(r.Method) && apiKeyFromRequest(r) == "" && !isCalDAVPath(r.URL.Path) && fromBrowser(r) {
+			given := submittedCSRFToken(w, r)
+			if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				requestLog(r).Warn("invalid csrf token")
+				http.Error(w, "Forbidden: invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		if token == "" {
+			var err error
+			token, err = randomToken()
+			if err != nil {
+				requestLog(r).WithError(err).Error("error generating csrf token")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    token,
+				Path:     "/",
+				MaxAge:   int(csrfCookieMaxAge.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfContextKey, token)))
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfTestToken gets the CSRF cookie a browser is given on its first visit
+func csrfTestToken(t *testing.T, h http.Handler) *http.Cookie {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == csrfCookie {
+			if !strings.Contains(w.Body.String(), `value="`+cookie.Value+`"`) {
+				t.Error("expected the CSRF token to be embedded in the page's forms")
+			}
+			return cookie
+		}
+	}
+
+	t.Fatal("expected a CSRF cookie")
+	return nil
+}
+
+func TestCSRF(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	h := s.handler()
+	cookie := csrfTestToken(t, h)
+
+	for _, tc := range []struct {
+		name      string
+		formToken bool
+		prepare   func(r *http.Request)
+		expected  int
+	}{
+		{"cookie without token", false, func(r *http.Request) {
+			r.AddCookie(cookie)
+		}, http.StatusForbidden},
+		{"cookie with wrong token", false, func(r *http.Request) {
+			r.AddCookie(cookie)
+			r.Header.Set(csrfHeader, "guess")
+		}, http.StatusForbidden},
+		{"cross-site without cookie", false, func(r *http.Request) {
+			r.Header.Set("Origin", "https://evil.example.com")
+		}, http.StatusForbidden},
+		{"token in header", false, func(r *http.Request) {
+			r.AddCookie(cookie)
+			r.Header.Set(csrfHeader, cookie.Value)
+		}, http.StatusFound},
+		{"token in form", true, func(r *http.Request) {
+			r.AddCookie(cookie)
+		}, http.StatusFound},
+		{"not a browser", false, func(r *http.Request) {}, http.StatusFound},
+	} {
+		form := url.Values{"title": {tc.name}}
+		if tc.formToken {
+			form.Set(csrfField, cookie.Value)
+		}
+		r := newFormRequest("POST", "/add", form)
+		tc.prepare(r)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.expected {
+			t.Errorf("expected %d for %s, got %d", tc.expected, tc.name, w.Code)
+		}
+	}
+
+	if n := todoGauges(s); n != 3 {
+		t.Errorf("expected only the 3 allowed todos to be added, got %d", n)
+	}
+}
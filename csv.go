@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// csvColumns are the columns of exported CSV files, in order
+var csvColumns = []string{"id", "title", "done", "color", "tags", "due", "created", "updated", "completed", "priority"}
+
+// csvTime formats a time for CSV files, leaving zero times empty
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func (s *server) ExportCSVHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_export_csv")
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, _, err := s.loadTodos(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		todoList = filterTodos(todoList, filters)
+		sortTodos(todoList)
+
+		var buf bytes.Buffer
+
+		cw := csv.NewWriter(&buf)
+		cw.Write(csvColumns)
+		for _, todo := range todoList {
+			cw.Write([]string{
+				strconv.FormatUint(todo.ID, 10),
+				todo.Title,
+				strconv.FormatBool(todo.Done),
+				todo.Color,
+				strings.Join(todo.Tags, ","),
+				csvTime(todo.DueDate),
+				csvTime(todo.CreatedAt),
+				csvTime(todo.UpdatedAt),
+				csvTime(todo.CompletedAt),
+				priorityLabel(todo.Priority),
+			})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			requestLog(r).WithError(err).Error("error writing csv")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		setAttachment(w, "text/csv; charset=utf-8", "todo.csv")
+		setMaxAge(w, exportMaxAge, "private")
+
+		http.ServeContent(w, r, "todo.csv", lastModified(todoList), bytes.NewReader(buf.Bytes()))
+	}
+}
+
+// importError is an error importing a single row of an import file
+type importError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importResult struct {
+	Imported int           `json:"imported"`
+	Errors   []importError `json:"errors"`
+}
+
+// csvReader returns the CSV file uploaded as the "file" field of a
+// multipart form or, failing that, sent as the request body
+func uploadReader(w http.ResponseWriter, r *http.Request) (io.Reader, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// todoFromCSV builds a todo from a CSV record whose columns are given by
+// the header's column indexes
+func (s *server) todoFromCSV(record []string, columns map[string]int) (*Todo, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	title, color, due, priority := field("title"), field("color"), field("due"), field("priority")
+	tags := []string{field("tags")}
+	u := todoUpdate{Title: &title, Color: &color, Tags: &tags, Due: &due, Priority: &priority}
+	if err := u.normalize(s.maxTitleLength); err != nil {
+		return nil, err
+	}
+
+	todo := &Todo{}
+	u.apply(todo)
+
+	if v := field("done"); v != "" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid done: %q", v)
+		}
+		todo.setDone(done)
+	}
+
+	todo.CreatedAt = todo.UpdatedAt
+	if v := field("created"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid created: %q", v)
+		}
+		todo.CreatedAt = t
+	}
+	if v := field("updated"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid updated: %q", v)
+		}
+		todo.UpdatedAt = t
+	}
+	if v := field("completed"); v != "" && todo.Done {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid completed: %q", v)
+		}
+		todo.CompletedAt = t
+	}
+
+	return todo, nil
+}
+
+// ImportCSVHandler adds the todos of a CSV file with a header row naming
+// its columns like the export. Only the title column is required and ids
+// are always newly allocated. Rows that cannot be imported are reported
+// without aborting the rest of the import.
+func (s *server) ImportCSVHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_import_csv")
+
+		prefix := keyPrefix(r)
+
+		in, err := uploadReader(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cr := csv.NewReader(in)
+		cr.FieldsPerRecord = -1
+
+		header, err := cr.Read()
+		if err != nil {
+			http.Error(w, "Bad Request: missing header row", http.StatusBadRequest)
+			return
+		}
+
+		columns := make(map[string]int)
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		if _, ok := columns["title"]; !ok {
+			http.Error(w, "Bad Request: missing title column", http.StatusBadRequest)
+			return
+		}
+
+		res := importResult{Errors: []importError{}}
+
+		for row := 1; ; row++ {
+			record, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var pe *csv.ParseError
+				if errors.As(err, &pe) {
+					res.Errors = append(res.Errors, importError{Row: row, Error: pe.Err.Error()})
+					continue
+				}
+				requestLog(r).WithError(err).Error("error reading csv")
+				http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			todo, err := s.todoFromCSV(record, columns)
+			if err != nil {
+				res.Errors = append(res.Errors, importError{Row: row, Error: err.Error()})
+				continue
+			}
+
+			if _, err := s.addTodo(prefix, todo); errors.Is(err, errTooManyTodos) {
+				res.Errors = append(res.Errors, importError{Row: row, Error: err.Error()})
+				continue
+			} else if err != nil {
+				requestLog(r).WithError(err).Error("error importing todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			res.Imported++
+		}
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
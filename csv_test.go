@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	src := newTestServer(t, newMemoryStore())
+	addRoundTripTodos(t, src)
+	data := exportTodos(t, src, "/export.csv")
+
+	dst := newTestServer(t, newMemoryStore())
+	if res := importTodos(t, dst, "/import.csv", "text/csv", data); res.Imported != 3 || len(res.Errors) != 0 {
+		t.Fatalf("expected 3 todos imported, got %+v", res)
+	}
+
+	if expected, fields := roundTripFields(t, src), roundTripFields(t, dst); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the CSV to round-trip\n%q\ngot\n%q", expected, fields)
+	}
+
+	// The todos get the same ids on an empty list, so exporting them
+	// again gives the same file
+	if again := exportTodos(t, dst, "/export.csv"); again != data {
+		t.Errorf("expected the same export after a round-trip\n%s\ngot\n%s", data, again)
+	}
+}
+
+func TestCSVImportReportsInvalidRows(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	data := "title,done,due\n" +
+		"buy milk,true,\n" +
+		",false,\n" +
+		"\n" +
+		"walk the dog,maybe,\n" +
+		"call mum,false,someday\n" +
+		"\"unterminated,false,\n"
+	res := importTodos(t, s, "/import.csv", "text/csv", data)
+
+	if res.Imported != 1 {
+		t.Errorf("expected 1 todo imported, got %d", res.Imported)
+	}
+	var rows []int
+	for _, e := range res.Errors {
+		rows = append(rows, e.Row)
+	}
+	if expected := []int{2, 3, 4, 5}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected rows %v to be reported, got %+v", expected, res.Errors)
+	}
+
+	if w := serveRequest(s, newJSONRequest("POST", "/import.csv", "name,done\nbuy milk,false\n")); w.Code != 400 {
+		t.Errorf("expected 400 without a title column, got %d", w.Code)
+	}
+}
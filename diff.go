@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// maxDiffRequestSize bounds the size of diff requests, which carry two
+// whole exports
+const maxDiffRequestSize = 16 << 20
+
+// diffRequest is the body of a diff request. Exports are lists of todos
+// as downloaded from GET /export or returned by GET /api/todos. Without to the
+// export is compared to the current todos, of user in multi-user mode.
+type diffRequest struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+	User string          `json:"user"`
+}
+
+// fieldChange is the value of a field of a todo before and after
+type fieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+type todoChange struct {
+	ID      uint64                 `json:"id"`
+	Changes map[string]fieldChange `json:"changes"`
+}
+
+type todoDiff struct {
+	Added    TodoList     `json:"added"`
+	Removed  TodoList     `json:"removed"`
+	Modified []todoChange `json:"modified"`
+}
+
+// decodeExport decodes an export into its todos keyed by id
+func decodeExport(data json.RawMessage) (map[uint64]*Todo, error) {
+	todoList, err := decodeTodoList(data)
+	if err != nil {
+		return nil, err
+	}
+
+	todos := make(map[uint64]*Todo)
+	for _, todo := range todoList {
+		if _, ok := todos[todo.ID]; ok {
+			return nil, fmt.Errorf("duplicate id: %d", todo.ID)
+		}
+		todos[todo.ID] = todo
+	}
+	return todos, nil
+}
+
+// todoFields returns the fields of a todo as they are exported
+func todoFields(todo *Todo) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// diffTodos compares two sets of todos by id, reporting the todos only in
+// to as added, those only in from as removed and for the todos in both the
+// fields that differ
+func diffTodos(from, to map[uint64]*Todo) (todoDiff, error) {
+	diff := todoDiff{Added: TodoList{}, Removed: TodoList{}, Modified: []todoChange{}}
+
+	for id, todo := range from {
+		if _, ok := to[id]; !ok {
+			diff.Removed = append(diff.Removed, todo)
+		}
+	}
+
+	for id, todo := range to {
+		before, ok := from[id]
+		if !ok {
+			diff.Added = append(diff.Added, todo)
+			continue
+		}
+
+		beforeFields, err := todoFields(before)
+		if err != nil {
+			return diff, err
+		}
+		afterFields, err := todoFields(todo)
+		if err != nil {
+			return diff, err
+		}
+
+		changes := make(map[string]fieldChange)
+		for name, value := range afterFields {
+			if string(beforeFields[name]) != string(value) {
+				changes[name] = fieldChange{From: beforeFields[name], To: value}
+			}
+		}
+		if len(changes) > 0 {
+			diff.Modified = append(diff.Modified, todoChange{ID: id, Changes: changes})
+		}
+	}
+
+	sortTodos(diff.Added)
+	sortTodos(diff.Removed)
+	sort.Slice(diff.Modified, func(i, j int) bool { return diff.Modified[i].ID < diff.Modified[j].ID })
+
+	return diff, nil
+}
+
+// DiffHandler compares two exports of the todo list, or an export and the
+// current todos, e.g. to check what a restore from a backup changed. Todos
+// are matched by id and modified todos list every field that changed.
+func (s *server) DiffHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_admin_diff")
+
+		var req diffRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDiffRequestSize)).Decode(&req); err != nil {
+			http.Error(w, "Bad Request: invalid diff request", http.StatusBadRequest)
+			return
+		}
+		if len(req.From) == 0 {
+			http.Error(w, "Bad Request: from is required", http.StatusBadRequest)
+			return
+		}
+
+		from, err := decodeExport(req.From)
+		if err != nil {
+			http.Error(w, "Bad Request: from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var to map[uint64]*Todo
+		if len(req.To) > 0 {
+			to, err = decodeExport(req.To)
+			if err != nil {
+				http.Error(w, "Bad Request: to: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			var prefix string
+			if s.multiUser {
+				user, err := s.getUser(req.User)
+				if err != nil {
+					if errors.Is(err, bitcask.ErrKeyNotFound) {
+						http.Error(w, "Bad Request: no such user", http.StatusBadRequest)
+						return
+					}
+					requestLog(r).WithError(err).Error("error getting user")
+					http.Error(w, "Internal Error", http.StatusInternalServerError)
+					return
+				}
+				prefix = fmt.Sprintf("user_%d_", user.ID)
+			}
+
+			todoList, _, err := s.loadTodos(r.Context(), prefix)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error listing todos")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			to = make(map[uint64]*Todo)
+			for _, todo := range todoList {
+				to[todo.ID] = todo
+			}
+		}
+
+		diff, err := diffTodos(from, to)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error comparing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, diff)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// EditHandler renders a form to change the title and notes of a todo (GET)
+// and changes them (POST) keeping everything else about it
+func (s *server) EditHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_edit")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		key := fmt.Sprintf("%stodo_%d", prefix, id)
+
+		if r.Method == http.MethodGet {
+			todo, err := s.loadTodo(prefix, id)
+			if err != nil {
+				if errors.Is(err, bitcask.ErrKeyNotFound) {
+					http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+					return
+				}
+				requestLog(r).WithError(err).WithField("key", key).Error("error loading todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			s.render("edit", w, r, &templateContext{Title: "edit", Todo: todo, ReturnTo: backURL(r)})
+			return
+		}
+
+		title, body := r.FormValue("title"), r.FormValue("body")
+		u := todoUpdate{Title: &title, Body: &body}
+		if err := u.normalize(s.maxTitleLength); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		before, todo, err := s.updateTodo(prefix, id, func(todo *Todo) error {
+			if err := checkRevision(r, todo); err != nil {
+				return err
+			}
+			if todo.Title == *u.Title && todo.Body == *u.Body {
+				return errUnchanged
+			}
+			todo.setTitle(*u.Title)
+			todo.Body = *u.Body
+			return nil
+		})
+		if err != nil && !errors.Is(err, errUnchanged) {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("key", key).Warn("todo not found")
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errConflict) {
+				http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+				return
+			}
+			requestLog(r).WithError(err).WithField("key", key).Error("error updating todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err == nil {
+			s.trackTodo(before, todo)
+			s.undo.Push(prefix, undoEntry{key: key, before: before})
+		}
+
+		redirectBack(w, r)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSMTPPort is the mail submission port used when none is configured
+const defaultSMTPPort = 587
+
+var emailTemplate = template.Must(template.New("email").Parse(`<p>{{ .Message }}</p>
+{{ if .Due }}<p>Due {{ .Due }}</p>{{ end }}
+`))
+
+// sendMailFunc has the signature of smtp.SendMail so sending can be swapped
+// out
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// emailNotifier sends each notification as an email to a fixed list of
+// recipients through an SMTP server
+type emailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	send sendMailFunc
+}
+
+// newEmailNotifier returns a notifier sending mail through the SMTP server
+// at host:port, authenticating when a username is given
+func newEmailNotifier(host string, port int, username, password, from string, to []string) *emailNotifier {
+	en := &emailNotifier{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+		to:   to,
+		send: smtp.SendMail,
+	}
+	if username != "" {
+		en.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return en
+}
+
+func (en *emailNotifier) Notify(ctx context.Context, n notification) error {
+	msg, err := en.message(n, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// smtp.SendMail cannot be cancelled so the result is dropped if the
+	// context is done first
+	errc := make(chan error, 1)
+	go func() {
+		errc <- en.send(en.addr, en.auth, en.from, en.to, msg)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message builds a multipart plain text and HTML email for the notification
+func (en *emailNotifier) message(n notification, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	var due string
+	text := n.Message() + "\r\n"
+	if n.Todo.hasDueDate() {
+		due = n.Todo.DueDate.Format(time.RFC1123)
+		text += "Due " + due + "\r\n"
+	}
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write([]byte(text)); err != nil {
+		return nil, err
+	}
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	err = emailTemplate.Execute(part, struct{ Message, Due string }{n.Message(), due})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", en.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(en.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "todo "+n.Message()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n", mw.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
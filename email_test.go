@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testMailer records the mails sent in place of an SMTP server, failing
+// each with err
+type testMailer struct {
+	sync.Mutex
+
+	err   error
+	addrs []string
+	froms []string
+	tos   [][]string
+	msgs  []string
+}
+
+func (m *testMailer) send(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.addrs = append(m.addrs, addr)
+	m.froms = append(m.froms, from)
+	m.tos = append(m.tos, to)
+	m.msgs = append(m.msgs, string(msg))
+	return m.err
+}
+
+func (m *testMailer) sent() int {
+	m.Lock()
+	defer m.Unlock()
+
+	return len(m.msgs)
+}
+
+func newTestEmailNotifier(m *testMailer) *emailNotifier {
+	en := newEmailNotifier("smtp.example.com", defaultSMTPPort, "", "", "todo@example.com", []string{"alice@example.com", "bob@example.com"})
+	en.send = m.send
+	return en
+}
+
+func TestEmailReminder(t *testing.T) {
+	m := &testMailer{}
+	s := newTestServer(t, newMemoryStore(), withNotifier(newTestEmailNotifier(m), eventDue))
+
+	addDueTodo(t, s, "buy <milk>", testTime)
+	addTestTodo(t, s, "walk the dog")
+	s.sendReminders(context.Background(), testTime)
+
+	if n := m.sent(); n != 1 {
+		t.Fatalf("expected 1 mail for the due todo, got %d", n)
+	}
+	if m.addrs[0] != "smtp.example.com:587" || m.froms[0] != "todo@example.com" {
+		t.Errorf("expected the mail to be sent from todo@example.com through smtp.example.com:587, got %s and %s", m.froms[0], m.addrs[0])
+	}
+	if expected := []string{"alice@example.com", "bob@example.com"}; !reflect.DeepEqual(m.tos[0], expected) {
+		t.Errorf("expected the mail to be sent to %v, got %v", expected, m.tos[0])
+	}
+
+	msg := m.msgs[0]
+	for _, expected := range []string{
+		"To: alice@example.com, bob@example.com\r\n",
+		"Subject: todo due: buy <milk>\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n\r\ndue: buy <milk>\r\nDue ",
+		"Content-Type: text/html; charset=utf-8\r\n\r\n<p>due: buy &lt;milk&gt;</p>",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("expected the mail to contain %q, got:\n%s", expected, msg)
+		}
+	}
+}
+
+func TestEmailSendFailure(t *testing.T) {
+	failing := &testMailer{err: errors.New("connection refused")}
+	working := &testMailer{}
+	s := newTestServer(t, newMemoryStore(),
+		withNotifier(newTestEmailNotifier(failing), eventDue),
+		withNotifier(newTestEmailNotifier(working), eventDue),
+	)
+
+	addDueTodo(t, s, "buy milk", testTime)
+	addDueTodo(t, s, "walk the dog", testTime)
+	s.sendReminders(context.Background(), testTime)
+
+	// A failing notifier neither stops the scheduler nor the others
+	if n := failing.sent(); n != 2 {
+		t.Errorf("expected both reminders to be tried, got %d", n)
+	}
+	if n := working.sent(); n != 2 {
+		t.Errorf("expected both reminders to be sent by the other notifier, got %d", n)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultEventLogMaxSize is the size the event log is rotated at
+	defaultEventLogMaxSize = 10 << 20
+
+	// defaultEventsLimit is the number of events returned per request by
+	// default
+	defaultEventsLimit = 100
+
+	// maxEventsLimit is the maximum number of events returned per request
+	maxEventsLimit = 1000
+)
+
+// Operations recorded in the event log
+const (
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// event is a single change to a todo recorded in the event log with the
+// full state of the todo after the change, nil for deletions
+type event struct {
+	Seq    uint64    `json:"seq"`
+	TS     time.Time `json:"ts"`
+	Op     string    `json:"op"`
+	Prefix string    `json:"prefix,omitempty"`
+	ID     uint64    `json:"id"`
+	Todo   *Todo     `json:"todo,omitempty"`
+}
+
+// loggedEvent is an event as written to the event log. With encryption
+// the todo is sealed by the log's codec like it is in the database, and
+// only the sequence number, time, operation and key are in plain text.
+type loggedEvent struct {
+	event
+	Sealed []byte `json:"sealed,omitempty"`
+}
+
+// eventLog is an append-only JSON lines file of every change to todos,
+// for sync clients to replay. When the file grows beyond maxSize it is
+// rotated to path.1, replacing the previous one, so at least the last
+// maxSize bytes of events are kept.
+type eventLog struct {
+	sync.Mutex
+
+	path    string
+	maxSize int64
+	codec   codec
+
+	f    *os.File
+	size int64
+	seq  uint64
+}
+
+// openEventLog opens (or creates) the event log at path continuing its
+// sequence numbers. If c is not nil the todos of events are sealed with
+// it, otherwise they are logged in plain text.
+func openEventLog(path string, maxSize int64, c codec) (*eventLog, error) {
+	el := &eventLog{path: path, maxSize: maxSize, codec: c}
+
+	for _, name := range []string{path + ".1", path} {
+		err := readEventFile(name, func(le loggedEvent) {
+			el.seq = le.Seq
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := el.open(); err != nil {
+		return nil, err
+	}
+
+	return el, nil
+}
+
+func (el *eventLog) open() error {
+	f, err := os.OpenFile(el.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	el.f = f
+	el.size = fi.Size()
+	return nil
+}
+
+// readEventFile calls f with every event of the file at name in order. A
+// missing file has no events.
+func readEventFile(name string, f func(le loggedEvent)) error {
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	return readEvents(file, f)
+}
+
+// readEvents calls f with every event read from r in order. Lines that
+// cannot be decoded, such as a line cut short by a crash, are skipped.
+func readEvents(r io.Reader, f func(le loggedEvent)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRequestSize)
+	for scanner.Scan() {
+		var le loggedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &le); err != nil {
+			continue
+		}
+		f(le)
+	}
+
+	return scanner.Err()
+}
+
+// Record appends an event to the log assigning it the next sequence
+// number, which is returned
+func (el *eventLog) Record(e event) (uint64, error) {
+	el.Lock()
+	defer el.Unlock()
+
+	e.Seq = el.seq + 1
+	if e.TS.IsZero() {
+		e.TS = time.Now()
+	}
+
+	le := loggedEvent{event: e}
+	if el.codec != nil && e.Todo != nil {
+		sealed, err := el.codec.Marshal(e.Todo)
+		if err != nil {
+			return 0, err
+		}
+		le.Todo = nil
+		le.Sealed = sealed
+	}
+
+	data, err := json.Marshal(le)
+	if err != nil {
+		return 0, err
+	}
+	data = append(data, '\n')
+
+	if el.maxSize > 0 && el.size > 0 && el.size+int64(len(data)) > el.maxSize {
+		if err := el.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := el.f.Write(data)
+	el.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+
+	el.seq = e.Seq
+	return e.Seq, nil
+}
+
+func (el *eventLog) rotate() error {
+	if err := el.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(el.path, el.path+".1"); err != nil {
+		return err
+	}
+	return el.open()
+}
+
+// decode returns the event of a logged event, unsealing its todo
+func (el *eventLog) decode(le loggedEvent) (event, error) {
+	e := le.event
+	if le.Sealed != nil {
+		if el.codec == nil {
+			return e, ErrDecrypt
+		}
+		e.Todo = &Todo{}
+		if err := el.codec.Unmarshal(le.Sealed, e.Todo); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// snapshot opens the rotated and the current file of the log, the latter
+// limited to the events recorded so far, so they can be read without
+// holding the lock while further events are recorded or the log rotated
+func (el *eventLog) snapshot() ([]io.Reader, func(), error) {
+	el.Lock()
+	defer el.Unlock()
+
+	var (
+		readers []io.Reader
+		files   []*os.File
+	)
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	for _, name := range []string{el.path + ".1", el.path} {
+		f, err := os.Open(name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, f)
+
+		size := el.size
+		if name != el.path {
+			fi, err := f.Stat()
+			if err != nil {
+				closeAll()
+				return nil, nil, err
+			}
+			size = fi.Size()
+		}
+		readers = append(readers, io.NewSectionReader(f, 0, size))
+	}
+
+	return readers, closeAll, nil
+}
+
+// Since returns up to limit events with a sequence number greater than
+// seq for which match returns true, and whether more follow. Events
+// rotated out of the log are lost so a client that has been away for too
+// long sees a gap in the sequence numbers. Events whose todo cannot be
+// unsealed, such as ones logged with another encryption key, are skipped.
+func (el *eventLog) Since(seq uint64, limit int, match func(e event) bool) ([]event, bool, error) {
+	readers, closeAll, err := el.snapshot()
+	if err != nil {
+		return nil, false, err
+	}
+	defer closeAll()
+
+	var (
+		events []event
+		more   bool
+	)
+	for _, r := range readers {
+		err := readEvents(r, func(le loggedEvent) {
+			if more || le.Seq <= seq || !match(le.event) {
+				return
+			}
+			e, err := el.decode(le)
+			if err != nil {
+				log.WithError(err).WithField("seq", le.Seq).Warn("error decoding event")
+				return
+			}
+			if len(events) == limit {
+				more = true
+				return
+			}
+			events = append(events, e)
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return events, more, nil
+}
+
+func (el *eventLog) Close() error {
+	el.Lock()
+	defer el.Unlock()
+
+	return el.f.Close()
+}
+
+// recordEvent records a change to the todo at key in the event log, if
+// enabled, and sends it to live streams. Failing to record is logged but
+// does not fail the change.
+func (s *server) recordEvent(op, key string, todo *Todo) {
+	m := todoKeyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return
+	}
+	id, _ := strconv.ParseUint(m[2], 10, 64)
+
+	e := event{TS: s.now(), Op: op, Prefix: m[1], ID: id}
+	if todo != nil {
+		snapshot := *todo
+		e.Todo = &snapshot
+	}
+
+	if s.events != nil {
+		seq, err := s.events.Record(e)
+		if err != nil {
+			log.WithError(err).WithField("key", key).Error("error recording event")
+		}
+		e.Seq = seq
+	}
+
+	s.live.Publish(e)
+}
+
+type eventsPage struct {
+	Events []event `json:"events"`
+	Next   *uint64 `json:"next,omitempty"`
+}
+
+// EventsHandler returns the events after ?seq=N (all of them without seq)
+// in order, so sync clients can catch up on the changes they missed.
+// When more events follow, next holds the seq to continue from.
+func (s *server) EventsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_events")
+
+		if s.events == nil {
+			http.Error(w, "Not Found: the event log is disabled", http.StatusNotFound)
+			return
+		}
+
+		q := r.URL.Query()
+
+		var seq uint64
+		if v := q.Get("seq"); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Bad Request: invalid seq", http.StatusBadRequest)
+				return
+			}
+			seq = n
+		}
+
+		limit := defaultEventsLimit
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+				return
+			}
+			if n > maxEventsLimit {
+				n = maxEventsLimit
+			}
+			limit = n
+		}
+
+		prefix := keyPrefix(r)
+		events, more, err := s.events.Since(seq, limit, func(e event) bool {
+			return e.Prefix == prefix
+		})
+		if err != nil {
+			requestLog(r).WithError(err).Error("error reading events")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		page := eventsPage{Events: events}
+		if page.Events == nil {
+			page.Events = []event{}
+		}
+		if more && len(events) > 0 {
+			next := events[len(events)-1].Seq
+			page.Next = &next
+		}
+
+		writeJSON(w, r, http.StatusOK, page)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempEventLog(t *testing.T, maxSize int64, c codec) (*eventLog, string, func()) {
+	dir, err := ioutil.TempDir("", "todo-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "events.log")
+
+	el, err := openEventLog(path, maxSize, c)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return el, path, func() {
+		el.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func allEvents(e event) bool { return true }
+
+func TestEventLogRecord(t *testing.T) {
+	el, _, cleanup := tempEventLog(t, 0, nil)
+	defer cleanup()
+
+	for i, op := range []string{opCreate, opUpdate, opDelete} {
+		e := event{Op: op, ID: 1}
+		if op != opDelete {
+			e.Todo = &Todo{ID: 1, Title: "buy milk"}
+		}
+		seq, err := el.Record(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq != uint64(i+1) {
+			t.Errorf("expected seq %d, got %d", i+1, seq)
+		}
+	}
+
+	events, more, err := el.Since(1, 10, allEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if more {
+		t.Error("expected no more events")
+	}
+	if len(events) != 2 || events[0].Op != opUpdate || events[1].Op != opDelete {
+		t.Fatalf("expected update and delete after seq 1, got %+v", events)
+	}
+	if events[0].Todo == nil || events[0].Todo.Title != "buy milk" {
+		t.Errorf("expected the todo of the update, got %+v", events[0].Todo)
+	}
+	if events[1].Todo != nil {
+		t.Errorf("expected no todo for the delete, got %+v", events[1].Todo)
+	}
+
+	events, more, err = el.Since(0, 1, allEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !more || len(events) != 1 || events[0].Seq != 1 {
+		t.Errorf("expected the first event and more, got %+v (more %v)", events, more)
+	}
+}
+
+func TestEventLogRotate(t *testing.T) {
+	el, path, cleanup := tempEventLog(t, 2048, nil)
+	defer cleanup()
+
+	for i := 0; i < 20; i++ {
+		if _, err := el.Record(event{Op: opCreate, ID: uint64(i), Todo: &Todo{ID: uint64(i), Title: "todo"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected the log to be rotated: %s", err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() > 2048 {
+		t.Fatalf("expected the current log within its maximum size: %v", err)
+	}
+
+	events, _, err := el.Since(0, maxEventsLimit, allEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || len(events) == 20 {
+		t.Fatalf("expected only the newest events to be kept, got %d", len(events))
+	}
+	if last := events[len(events)-1].Seq; last != 20 {
+		t.Errorf("expected the last event to be 20, got %d", last)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq != events[i-1].Seq+1 {
+			t.Errorf("expected contiguous events, got %d after %d", events[i].Seq, events[i-1].Seq)
+		}
+	}
+}
+
+func TestEventLogReplay(t *testing.T) {
+	el, path, cleanup := tempEventLog(t, 256, nil)
+	defer cleanup()
+
+	for i := 0; i < 10; i++ {
+		if _, err := el.Record(event{Op: opCreate, ID: uint64(i), Todo: &Todo{ID: uint64(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	el.Close()
+
+	reopened, err := openEventLog(path, 256, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	seq, err := reopened.Record(event{Op: opDelete, ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 11 {
+		t.Errorf("expected the reopened log to continue at 11, got %d", seq)
+	}
+
+	events, _, err := reopened.Since(9, 10, allEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Seq != 10 || events[1].Seq != 11 {
+		t.Errorf("expected events 10 and 11, got %+v", events)
+	}
+}
+
+func TestEventLogEncrypted(t *testing.T) {
+	c, err := newAESCodec("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	el, path, cleanup := tempEventLog(t, 0, c)
+	defer cleanup()
+
+	if _, err := el.Record(event{Op: opCreate, ID: 1, Todo: &Todo{ID: 1, Title: "buy milk", Body: "semi-skimmed"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("buy milk")) || bytes.Contains(data, []byte("semi-skimmed")) {
+		t.Errorf("expected the todo to be encrypted in the log, got %s", data)
+	}
+
+	events, _, err := el.Since(0, 10, allEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Todo == nil || events[0].Todo.Title != "buy milk" {
+		t.Fatalf("expected the decrypted todo, got %+v", events)
+	}
+
+	other, err := newAESCodec("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	el.codec = other
+	events, _, err = el.Since(0, 10, allEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected events sealed with another key to be skipped, got %+v", events)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlOutline is a single OPML outline node. Completed todos are marked
+// with the _complete attribute understood by most outliners.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Complete bool          `xml:"_complete,attr,omitempty"`
+	Created  string        `xml:"created,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline,omitempty"`
+}
+
+func newOPMLOutline(todo *Todo) opmlOutline {
+	return opmlOutline{
+		Text:     todo.Title,
+		Complete: todo.Done,
+		Created:  todo.CreatedAt.Format(time.RFC1123Z),
+	}
+}
+
+// lastModified returns the time the most recently updated todo was changed
+func lastModified(todoList TodoList) time.Time {
+	var t time.Time
+	for _, todo := range todoList {
+		if todo.UpdatedAt.After(t) {
+			t = todo.UpdatedAt
+		}
+	}
+	return t
+}
+
+// setAttachment sets the headers for a file download of the given type
+func setAttachment(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+}
+
+func (s *server) ExportOPMLHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_export_opml")
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, _, err := s.loadTodos(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		todoList = filterTodos(todoList, filters)
+		sortTodos(todoList)
+
+		doc := opml{
+			Version: "2.0",
+			Head: opmlHead{
+				Title:       "todo",
+				DateCreated: time.Now().Format(time.RFC1123Z),
+			},
+		}
+
+		for _, todo := range todoList {
+			doc.Body.Outlines = append(doc.Body.Outlines, newOPMLOutline(todo))
+		}
+
+		data, err := xml.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			requestLog(r).WithError(err).Error("error marshaling opml")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		setAttachment(w, "text/x-opml; charset=utf-8", "todo.opml")
+		setMaxAge(w, exportMaxAge, "private")
+
+		// ServeContent answers conditional requests against Last-Modified
+		content := append([]byte(xml.Header), data...)
+		http.ServeContent(w, r, "todo.opml", lastModified(todoList), bytes.NewReader(content))
+	}
+}
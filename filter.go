@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// todoFilter reports whether a todo should be included in a list
+type todoFilter func(todo *Todo) bool
+
+// filtersFromRequest builds the filters given by the request's query
+// parameters. An invalid parameter value is returned as an error.
+func filtersFromRequest(r *http.Request) ([]todoFilter, error) {
+	return filtersFromQuery(r.URL.Query())
+}
+
+// filtersFromQuery builds the filters given by query parameters
+func filtersFromQuery(q url.Values) ([]todoFilter, error) {
+	var filters []todoFilter
+
+	if v := q.Get("color"); v != "" {
+		color, ok := normalizeColor(v)
+		if !ok {
+			return nil, fmt.Errorf("invalid color: %q", v)
+		}
+		filters = append(filters, func(todo *Todo) bool {
+			return todo.Color == color
+		})
+	}
+
+	if v := q.Get("done"); v != "" && v != "all" {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid done: %q", v)
+		}
+		filters = append(filters, func(todo *Todo) bool {
+			return todo.Done == done
+		})
+	}
+
+	if v := q.Get("priority"); v != "" {
+		p, err := parsePriority(v)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(todo *Todo) bool {
+			return todo.Priority == p
+		})
+	}
+
+	if v := q.Get("list"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid list: %q", v)
+		}
+		filters = append(filters, func(todo *Todo) bool {
+			return todo.ListID == id
+		})
+	}
+
+	if v := q.Get("tag"); v != "" {
+		tags, err := normalizeTags(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			tag := tag
+			filters = append(filters, func(todo *Todo) bool {
+				return todo.hasTag(tag)
+			})
+		}
+	}
+
+	if v := q.Get("due_before"); v != "" {
+		before, err := parseDueDate(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid due_before: %q", v)
+		}
+		filters = append(filters, func(todo *Todo) bool {
+			return !todo.DueDate.IsZero() && !todo.DueDate.After(before)
+		})
+	}
+
+	if v := q.Get("due_after"); v != "" {
+		after, err := parseDueDate(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid due_after: %q", v)
+		}
+		filters = append(filters, func(todo *Todo) bool {
+			return !todo.DueDate.IsZero() && todo.DueDate.After(after)
+		})
+	}
+
+	return filters, nil
+}
+
+// withQuery returns a relative URL of the query with key set to value, for
+// links changing a single filter in templates. Changing anything but the
+// page goes back to the first page.
+func withQuery(q url.Values, key, value string) string {
+	c := make(url.Values, len(q)+1)
+	for k, v := range q {
+		c[k] = v
+	}
+	if key != "page" {
+		c.Del("page")
+	}
+	c.Set(key, value)
+	return "?" + c.Encode()
+}
+
+// matchFilters reports whether the todo matches all of the given filters
+func matchFilters(todo *Todo, filters []todoFilter) bool {
+	for _, filter := range filters {
+		if !filter(todo) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterTodos returns the todos matching all of the given filters
+func filterTodos(todoList TodoList, filters []todoFilter) TodoList {
+	if len(filters) == 0 {
+		return todoList
+	}
+
+	var filtered TodoList
+
+	for _, todo := range todoList {
+		if matchFilters(todo, filters) {
+			filtered = append(filtered, todo)
+		}
+	}
+
+	return filtered
+}
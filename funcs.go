@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateFormat is the format dates are shown in
+const dateFormat = "2006-01-02"
+
+// templateFuncs returns the functions available to templates
+func (s *server) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"asset":        func(path string) string { return s.basePath + s.assets.URL(path) },
+		"path":         func(path string) string { return s.basePath + path },
+		"withQuery":    withQuery,
+		"formatDate":   formatDate,
+		"relativeTime": func(t time.Time) string { return relativeTime(t, s.now()) },
+		"lower":        strings.ToLower,
+		"pluralize":    pluralize,
+		"linkify":      linkify,
+		"markdown":     markdown,
+		"highlight":    highlight,
+		"priority":     priorityLabel,
+		"dueStatus":    func(t *Todo) string { return t.dueStatus(s.now()) },
+	}
+}
+
+// formatDate formats t as a date, an empty string for the zero time
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(time.Local).Format(dateFormat)
+}
+
+// relativeTime describes t relative to now in the largest whole unit, e.g.
+// "2 days ago" or "in 3 hours"
+func relativeTime(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var s string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		s = pluralize(int(d/time.Minute), "minute", "minutes")
+	case d < 24*time.Hour:
+		s = pluralize(int(d/time.Hour), "hour", "hours")
+	case d < 30*24*time.Hour:
+		s = pluralize(int(d/(24*time.Hour)), "day", "days")
+	case d < 365*24*time.Hour:
+		s = pluralize(int(d/(30*24*time.Hour)), "month", "months")
+	default:
+		s = pluralize(int(d/(365*24*time.Hour)), "year", "years")
+	}
+
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// pluralize returns n followed by the singular or plural form depending on
+// n, e.g. "1 todo" or "3 todos"
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// urlPattern matches candidate http(s) URLs in text
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// trimURL drops trailing punctuation that more likely ends the sentence
+// than the URL, keeping closing parentheses that have a matching opening one
+func trimURL(u string) string {
+	for u != "" {
+		last := u[len(u)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'", last) >= 0:
+		case last == ')' && strings.Count(u, "(") < strings.Count(u, ")"):
+		default:
+			return u
+		}
+		u = u[:len(u)-1]
+	}
+	return u
+}
+
+// linkify returns s as HTML with every http(s) URL turned into a link. All
+// of s is escaped so it is safe to include in a page, strings that do not
+// parse as a URL with a host are left as text.
+func linkify(s string) template.HTML {
+	var b strings.Builder
+
+	last := 0
+	for _, m := range urlPattern.FindAllStringIndex(s, -1) {
+		start, end := m[0], m[0]+len(trimURL(s[m[0]:m[1]]))
+
+		u, err := url.Parse(s[start:end])
+		if err != nil || u.Host == "" {
+			continue
+		}
+
+		b.WriteString(template.HTMLEscapeString(s[last:start]))
+		href := template.HTMLEscapeString(s[start:end])
+		fmt.Fprintf(&b, `<a href="%s" rel="noopener noreferrer" target="_blank">%s</a>`, href, href)
+		last = end
+	}
+	b.WriteString(template.HTMLEscapeString(s[last:]))
+
+	return template.HTML(b.String())
+}
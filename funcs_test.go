@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLinkify(t *testing.T) {
+	for _, tc := range []struct {
+		text     string
+		expected string
+	}{
+		{
+			"buy milk",
+			"buy milk",
+		},
+		{
+			"read https://example.com/post?a=1&b=2",
+			`read <a href="https://example.com/post?a=1&amp;b=2" rel="noopener noreferrer" target="_blank">https://example.com/post?a=1&amp;b=2</a>`,
+		},
+		{
+			"http://a.example.com and https://b.example.com.",
+			`<a href="http://a.example.com" rel="noopener noreferrer" target="_blank">http://a.example.com</a> and ` +
+				`<a href="https://b.example.com" rel="noopener noreferrer" target="_blank">https://b.example.com</a>.`,
+		},
+		{
+			"(see https://en.wikipedia.org/wiki/Go_(language))",
+			`(see <a href="https://en.wikipedia.org/wiki/Go_(language)" rel="noopener noreferrer" target="_blank">https://en.wikipedia.org/wiki/Go_(language)</a>)`,
+		},
+		{
+			"not a link: http:// or https://",
+			"not a link: http:// or https://",
+		},
+		{
+			"example.com or ftp://example.com",
+			"example.com or ftp://example.com",
+		},
+		{
+			`<script>alert("x")</script>`,
+			`&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;`,
+		},
+		{
+			`https://example.com/"><script>alert(1)</script>`,
+			`<a href="https://example.com/" rel="noopener noreferrer" target="_blank">https://example.com/</a>&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;`,
+		},
+		{
+			`https://example.com/'onmouseover='alert(1)`,
+			`<a href="https://example.com/&#39;onmouseover=&#39;alert(1)" rel="noopener noreferrer" target="_blank">https://example.com/&#39;onmouseover=&#39;alert(1)</a>`,
+		},
+	} {
+		if html := string(linkify(tc.text)); html != tc.expected {
+			t.Errorf("expected %q to be linkified as\n%s\ngot\n%s", tc.text, tc.expected, html)
+		}
+	}
+}
+
+func TestIndexLinkifiesTitles(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	form := url.Values{"title": {`read https://example.com <script>alert(1)</script>`}}
+	if w := serve(s, "POST", "/add", form); w.Code != 302 {
+		t.Fatalf("expected 302 adding, got %d", w.Code)
+	}
+
+	body := serve(s, "GET", "/", nil).Body.String()
+	if !strings.Contains(body, `<a href="https://example.com" rel="noopener noreferrer" target="_blank">https://example.com</a>`) {
+		t.Error("expected the URL in the title to be a link")
+	}
+	if strings.Contains(body, "<script>alert(1)</script>") {
+		t.Error("expected the title to be escaped")
+	}
+}
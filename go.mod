@@ -5,15 +5,21 @@ go 1.14
 require (
 	github.com/GeertJohan/go.rice v1.0.0
 	github.com/NYTimes/gziphandler v1.1.1
+	github.com/SherClockHolmes/webpush-go v1.2.0
+	github.com/alicebob/miniredis/v2 v2.11.4
 	github.com/daaku/go.zipexe v1.0.1 // indirect
+	github.com/go-redis/redis/v7 v7.4.0
+	github.com/graph-gophers/graphql-go v1.3.0
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/namsral/flag v1.7.4-pre
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/prologic/bitcask v0.3.5
 	github.com/rcrowley/go-metrics v0.0.0-20200313005456-10cdbea86bc0
 	github.com/sirupsen/logrus v1.6.0
 	github.com/thoas/stats v0.0.0-20190407194641-965cb2de1678
-	github.com/unrolled/logger v0.0.0-20190327162521-be1a2406c7c9
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/exp v0.0.0-20200513190911-00229845015e // indirect
 	golang.org/x/sys v0.0.0-20200720211630-cb9d2d5c5666 // indirect
+	gopkg.in/yaml.v2 v2.2.4
 )
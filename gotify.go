@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gotifyMessage is a message sent to a Gotify server
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// newGotifyNotifier returns a notifier sending messages to the Gotify
+// server at serverURL as the application with the given token
+func newGotifyNotifier(serverURL, token string) (*webhookNotifier, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid Gotify URL: %q", serverURL)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("a Gotify application token is required")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/message"
+
+	header := make(http.Header)
+	header.Set("X-Gotify-Key", token)
+
+	return &webhookNotifier{
+		url:    u.String(),
+		header: header,
+		client: &http.Client{Timeout: notifyTimeout},
+		payload: func(n notification) (interface{}, error) {
+			msg := gotifyMessage{Title: "todo " + n.Event, Message: n.Todo.Title, Priority: 4}
+			if n.Event == eventDue {
+				msg.Priority = 8
+			}
+			return msg, nil
+		},
+	}, nil
+}
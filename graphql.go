@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// graphqlPath is where GraphQL queries are posted when -graphql is set
+const graphqlPath = "/graphql"
+
+// graphqlSchema is the schema of the GraphQL endpoint. Dates are RFC3339
+// strings and priorities are their labels, like the JSON API.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	todos(done: Boolean, tag: String): [Todo!]!
+}
+
+type Mutation {
+	addTodo(title: String!): Todo!
+	toggleDone(id: ID!): Todo!
+	deleteTodo(id: ID!): Boolean!
+}
+
+type Todo {
+	id: ID!
+	title: String!
+	done: Boolean!
+	tags: [String!]!
+	body: String!
+	priority: String!
+	due: String
+	createdAt: String!
+	updatedAt: String!
+	completedAt: String
+}
+`
+
+// errGraphQLInternal is reported to GraphQL clients in place of errors
+// that are logged instead
+var errGraphQLInternal = errors.New("internal error")
+
+// graphqlRequest returns the request a GraphQL query was posted with
+func graphqlRequest(ctx context.Context) *http.Request {
+	r, _ := ctx.Value(graphqlRequestContextKey).(*http.Request)
+	return r
+}
+
+// graphqlResolver resolves the queries and mutations of the schema with
+// the same operations as the JSON API, on the todos of the request's user
+type graphqlResolver struct {
+	s *server
+}
+
+// todosArgs are the arguments of the todos query
+type todosArgs struct {
+	Done *bool
+	Tag  *string
+}
+
+// Todos returns the todos ordered by id, filtered like the index
+func (gr *graphqlResolver) Todos(ctx context.Context, args todosArgs) ([]*todoResolver, error) {
+	r := graphqlRequest(ctx)
+
+	q := url.Values{}
+	if args.Done != nil {
+		q.Set("done", strconv.FormatBool(*args.Done))
+	}
+	if args.Tag != nil {
+		q.Set("tag", *args.Tag)
+	}
+	filters, err := filtersFromQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	todoList, _, err := gr.s.loadTodos(ctx, keyPrefix(r))
+	if err != nil {
+		requestLog(r).WithError(err).Error("error listing todos")
+		return nil, errGraphQLInternal
+	}
+	sort.Slice(todoList, func(i, j int) bool {
+		return todoList[i].ID < todoList[j].ID
+	})
+
+	todos := []*todoResolver{}
+	for _, todo := range todoList {
+		if matchFilters(todo, filters) {
+			todos = append(todos, &todoResolver{todo})
+		}
+	}
+	return todos, nil
+}
+
+// AddTodo adds a todo with the given title, or with dedupe enabled
+// returns an incomplete todo with the same title
+func (gr *graphqlResolver) AddTodo(ctx context.Context, args struct{ Title string }) (*todoResolver, error) {
+	r := graphqlRequest(ctx)
+	prefix := keyPrefix(r)
+
+	u := todoUpdate{Title: &args.Title}
+	if err := u.normalize(gr.s.maxTitleLength); err != nil {
+		return nil, err
+	}
+
+	if gr.s.dedupe {
+		existing, err := gr.s.findDuplicate(ctx, prefix, *u.Title)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error checking for duplicate todo")
+			return nil, errGraphQLInternal
+		}
+		if existing != nil {
+			return &todoResolver{existing}, nil
+		}
+	}
+
+	todo, err := gr.s.createTodo(r, prefix, &u)
+	if errors.Is(err, errTooManyTodos) {
+		return nil, err
+	}
+	if err != nil {
+		requestLog(r).WithError(err).Error("error adding todo")
+		return nil, errGraphQLInternal
+	}
+	return &todoResolver{todo}, nil
+}
+
+// ToggleDone marks the todo with the given id done, or not done if it is
+func (gr *graphqlResolver) ToggleDone(ctx context.Context, args struct{ ID graphql.ID }) (*todoResolver, error) {
+	r := graphqlRequest(ctx)
+	prefix := keyPrefix(r)
+
+	id, err := strconv.ParseUint(string(args.ID), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %q", args.ID)
+	}
+
+	before, todo, err := gr.s.updateTodo(prefix, id, func(todo *Todo) error {
+		todo.toggleDone()
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, errors.New("no such todo")
+		}
+		requestLog(r).WithError(err).WithField("id", id).Error("error updating todo")
+		return nil, errGraphQLInternal
+	}
+
+	gr.s.trackTodo(before, todo)
+	gr.s.undo.Push(prefix, undoEntry{key: fmt.Sprintf("%stodo_%d", prefix, id), before: before})
+	if todo.Done {
+		gr.s.notifyAsync(r, eventCompleted, todo)
+	}
+	return &todoResolver{todo}, nil
+}
+
+// DeleteTodo moves the todo with the given id to the trash
+func (gr *graphqlResolver) DeleteTodo(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	r := graphqlRequest(ctx)
+
+	id, err := strconv.ParseUint(string(args.ID), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid id: %q", args.ID)
+	}
+
+	todo, err := gr.s.discardTodo(ctx, keyPrefix(r), id)
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return false, errors.New("no such todo")
+		}
+		requestLog(r).WithError(err).WithField("id", id).Error("error deleting todo")
+		return false, errGraphQLInternal
+	}
+
+	if todo != nil {
+		gr.s.notifyAsync(r, eventDeleted, todo)
+	}
+	return true, nil
+}
+
+// todoResolver resolves the fields of a todo
+type todoResolver struct {
+	todo *Todo
+}
+
+func (tr *todoResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(tr.todo.ID, 10))
+}
+
+func (tr *todoResolver) Title() string    { return tr.todo.Title }
+func (tr *todoResolver) Done() bool       { return tr.todo.Done }
+func (tr *todoResolver) Body() string     { return tr.todo.Body }
+func (tr *todoResolver) Priority() string { return tr.todo.Priority.String() }
+
+func (tr *todoResolver) Tags() []string {
+	if tr.todo.Tags == nil {
+		return []string{}
+	}
+	return tr.todo.Tags
+}
+
+func (tr *todoResolver) Due() *string         { return graphqlTime(tr.todo.DueDate) }
+func (tr *todoResolver) CompletedAt() *string { return graphqlTime(tr.todo.CompletedAt) }
+func (tr *todoResolver) CreatedAt() string    { return tr.todo.CreatedAt.Format(time.RFC3339) }
+func (tr *todoResolver) UpdatedAt() string    { return tr.todo.UpdatedAt.Format(time.RFC3339) }
+
+// graphqlTime formats t as RFC3339, nil for the zero time
+func graphqlTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+// GraphQLHandler executes a GraphQL query or mutation posted as JSON with
+// its query, operationName and variables. Errors of the query are returned
+// in the response's errors with 200 OK as GraphQL clients expect.
+func (s *server) GraphQLHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_graphql")
+
+		var req struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			http.Error(w, "Bad Request: invalid query", http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), graphqlRequestContextKey, r)
+		writeJSON(w, r, http.StatusOK, s.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables))
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// graphqlResult is the response to a GraphQL query
+type graphqlResult struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// execGraphQL posts a query with its variables to the GraphQL endpoint
+func execGraphQL(t *testing.T, s *server, query string, variables map[string]interface{}) graphqlResult {
+	data, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveRequest(s, newJSONRequest("POST", graphqlPath, string(data)))
+	if w.Code != 200 {
+		t.Fatalf("expected 200 executing %s, got %d: %s", query, w.Code, w.Body)
+	}
+
+	var result graphqlResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestGraphQL(t *testing.T) {
+	s := newTestServer(t, newMemoryStore(), withGraphQL(true))
+	addFeedTodo(t, s, `{"title":"buy milk","tags":["shopping"]}`)
+	addFeedTodo(t, s, `{"title":"walk the dog"}`)
+
+	result := execGraphQL(t, s, `mutation { addTodo(title: "buy eggs") { id title done tags priority due } }`, nil)
+	if len(result.Errors) > 0 {
+		t.Fatalf("expected no errors adding a todo, got %+v", result.Errors)
+	}
+	var added struct {
+		ID       string
+		Title    string
+		Done     bool
+		Tags     []string
+		Priority string
+		Due      *string
+	}
+	if err := json.Unmarshal(result.Data["addTodo"], &added); err != nil {
+		t.Fatal(err)
+	}
+	if added.Title != "buy eggs" || added.Done || len(added.Tags) != 0 || added.Priority != "none" || added.Due != nil {
+		t.Errorf("expected the added todo, got %+v", added)
+	}
+
+	result = execGraphQL(t, s, `mutation ($id: ID!) { toggleDone(id: $id) { done completedAt } }`, map[string]interface{}{"id": added.ID})
+	if string(result.Data["toggleDone"]) == "null" || len(result.Errors) > 0 {
+		t.Fatalf("expected the todo to be toggled, got %s %+v", result.Data["toggleDone"], result.Errors)
+	}
+
+	titles := func(query string) []string {
+		result := execGraphQL(t, s, query, nil)
+		if len(result.Errors) > 0 {
+			t.Fatalf("expected no errors for %s, got %+v", query, result.Errors)
+		}
+		var todos []struct{ Title string }
+		if err := json.Unmarshal(result.Data["todos"], &todos); err != nil {
+			t.Fatal(err)
+		}
+		titles := []string{}
+		for _, todo := range todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles
+	}
+	if got := titles(`{ todos { title } }`); !reflect.DeepEqual(got, []string{"buy milk", "walk the dog", "buy eggs"}) {
+		t.Errorf("expected all todos by id, got %q", got)
+	}
+	if got := titles(`{ todos(done: true) { title } }`); !reflect.DeepEqual(got, []string{"buy eggs"}) {
+		t.Errorf("expected the done todo, got %q", got)
+	}
+	if got := titles(`{ todos(done: false, tag: "shopping") { title } }`); !reflect.DeepEqual(got, []string{"buy milk"}) {
+		t.Errorf("expected the open shopping todo, got %q", got)
+	}
+
+	result = execGraphQL(t, s, fmt.Sprintf(`mutation { deleteTodo(id: %q) }`, added.ID), nil)
+	if string(result.Data["deleteTodo"]) != "true" {
+		t.Fatalf("expected the todo to be deleted, got %s %+v", result.Data["deleteTodo"], result.Errors)
+	}
+	if !s.db.Has([]byte("trash_" + added.ID)) {
+		t.Error("expected the todo to be moved to the trash")
+	}
+
+	result = execGraphQL(t, s, fmt.Sprintf(`mutation { deleteTodo(id: %q) }`, added.ID), nil)
+	if len(result.Errors) != 1 || result.Errors[0].Message != "no such todo" {
+		t.Errorf("expected no such todo deleting it again, got %+v", result.Errors)
+	}
+	if result := execGraphQL(t, s, `{ todos { nosuchfield } }`, nil); len(result.Errors) == 0 {
+		t.Error("expected an error querying an unknown field")
+	}
+}
+
+func TestGraphQLDisabled(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	w := serveRequest(s, newJSONRequest("POST", graphqlPath, `{"query":"{ todos { title } }"}`))
+	if w.Code != 404 {
+		t.Errorf("expected 404 without -graphql, got %d", w.Code)
+	}
+}
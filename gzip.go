@@ -0,0 +1,54 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+
+	"github.com/NYTimes/gziphandler"
+	log "github.com/sirupsen/logrus"
+)
+
+// compressibleTypes are the only content types that are gzipped. Images
+// and responses that are already compressed are passed through as is.
+var compressibleTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/csv",
+	"text/markdown",
+	"text/calendar",
+	"text/x-opml",
+	"text/xml",
+	"application/json",
+	"application/xml",
+	"application/atom+xml",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// validGzipLevel reports whether level is a compression level accepted by
+// gziphandler
+func validGzipLevel(level int) bool {
+	return level == gzip.DefaultCompression ||
+		(level >= gzip.BestSpeed && level <= gzip.BestCompression)
+}
+
+// newGzipHandler returns a gzip middleware compressing at the given level,
+// falling back to the default level if level is invalid
+func newGzipHandler(level int) func(http.Handler) http.Handler {
+	if !validGzipLevel(level) {
+		log.WithField("level", level).Warn("invalid gzip level, using default")
+		level = gzip.DefaultCompression
+	}
+
+	wrapper, err := gziphandler.GzipHandlerWithOpts(
+		gziphandler.CompressionLevel(level),
+		gziphandler.ContentTypes(compressibleTypes),
+	)
+	if err != nil {
+		log.WithError(err).Warn("error configuring gzip, using defaults")
+		return gziphandler.GzipHandler
+	}
+
+	return wrapper
+}
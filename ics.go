@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+const (
+	// feedSecretKey is the key of the secret calendar feed tokens are
+	// signed with, generated when first needed. Deleting it revokes every
+	// feed token.
+	feedSecretKey = "feedsecret"
+
+	// icsTimeFormat is the UTC date-time format of iCalendar
+	icsTimeFormat = "20060102T150405Z"
+
+	// icsDateFormat is the date format of iCalendar
+	icsDateFormat = "20060102"
+)
+
+// feedPaths are the feeds that accept a feed token in place of a login, as
+// calendar apps and feed readers cannot log in
+var feedPaths = map[string]bool{
+	"/todos.ics": true,
+	"/feed.atom": true,
+}
+
+// feedSecret returns the secret feed tokens are signed with, generating
+// and storing it if there is none yet
+func (s *server) feedSecret() ([]byte, error) {
+	s.feeds.Lock()
+	defer s.feeds.Unlock()
+
+	secret, err := s.db.Get([]byte(feedSecretKey))
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, err
+	}
+
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := s.db.Put([]byte(feedSecretKey), secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func signFeed(secret []byte, username string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("todos.ics:" + username))
+	return mac.Sum(nil)
+}
+
+// feedToken returns the token giving access to the calendar feed of the
+// user with the given name, which is empty in single-user mode
+func (s *server) feedToken(username string) (string, error) {
+	secret, err := s.feedSecret()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(username)) + "." +
+		base64.RawURLEncoding.EncodeToString(signFeed(secret, username)), nil
+}
+
+// feedTokenUsername returns the username the request's feed token was
+// signed for, or false if it carries no valid token
+func (s *server) feedTokenUsername(r *http.Request) (string, bool, error) {
+	parts := strings.SplitN(r.URL.Query().Get("token"), ".", 2)
+	if len(parts) != 2 {
+		return "", false, nil
+	}
+	username, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false, nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false, nil
+	}
+
+	secret, err := s.feedSecret()
+	if err != nil {
+		return "", false, err
+	}
+	if !hmac.Equal(sig, signFeed(secret, string(username))) {
+		return "", false, nil
+	}
+
+	return string(username), true, nil
+}
+
+// feedUser returns the user whose calendar feed token the request carries,
+// or nil if it carries none
+func (s *server) feedUser(r *http.Request) (*User, error) {
+	username, ok, err := s.feedTokenUsername(r)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	user, err := s.getUser(username)
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// feedURL returns the path of the request's user's feed at path, with the
+// user's feed token
+func (s *server) feedURL(r *http.Request, path string) (string, error) {
+	var username string
+	if user := userFromRequest(r); user != nil {
+		username = user.Username
+	}
+
+	token, err := s.feedToken(username)
+	if err != nil {
+		return "", err
+	}
+	return path + "?token=" + url.QueryEscape(token), nil
+}
+
+// checkFeedToken reports whether the request carries the feed token of
+// its user, replying with an error if not
+func (s *server) checkFeedToken(w http.ResponseWriter, r *http.Request) bool {
+	var username string
+	if user := userFromRequest(r); user != nil {
+		username = user.Username
+	}
+
+	tokenUsername, ok, err := s.feedTokenUsername(r)
+	if err != nil {
+		requestLog(r).WithError(err).Error("error checking feed token")
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		return false
+	}
+	if !ok || tokenUsername != username {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// icsEscape escapes text for an iCalendar property value
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeICSLine writes a content line folded at 75 octets as RFC 5545
+// requires, without splitting UTF-8 sequences. The space starting each
+// continuation line counts towards its 75 octets.
+func writeICSLine(b *bytes.Buffer, line string) {
+	for max := 75; len(line) > max; max = 74 {
+		i := max
+		for i > 0 && line[i]&0xC0 == 0x80 {
+			i--
+		}
+		b.WriteString(line[:i])
+		b.WriteString("\r\n ")
+		line = line[i:]
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+// icsPriority maps a priority to iCalendar's 1 (highest) to 9 (lowest)
+func icsPriority(p priority) int {
+	switch p {
+	case priorityHigh:
+		return 1
+	case priorityMed:
+		return 5
+	case priorityLow:
+		return 9
+	}
+	return 0
+}
+
+// icsUID returns the iCalendar UID of a todo stored under prefix
+func icsUID(r *http.Request, prefix string, todo *Todo) string {
+	if todo.UID != "" {
+		return todo.UID
+	}
+	return fmt.Sprintf("%stodo-%d@%s", prefix, todo.ID, r.Host)
+}
+
+// beginVCALENDAR writes the start of an iCalendar object
+func beginVCALENDAR(b *bytes.Buffer) {
+	writeICSLine(b, "BEGIN:VCALENDAR")
+	writeICSLine(b, "VERSION:2.0")
+	writeICSLine(b, "PRODID:-//prologic//todo "+version+"//EN")
+	writeICSLine(b, "CALSCALE:GREGORIAN")
+}
+
+// writeVTODO writes the todo as a VTODO component
+func writeVTODO(b *bytes.Buffer, todo *Todo, uid string) {
+	writeICSLine(b, "BEGIN:VTODO")
+	writeICSLine(b, "UID:"+uid)
+	writeICSLine(b, "DTSTAMP:"+todo.UpdatedAt.UTC().Format(icsTimeFormat))
+	if !todo.CreatedAt.IsZero() {
+		writeICSLine(b, "CREATED:"+todo.CreatedAt.UTC().Format(icsTimeFormat))
+	}
+	writeICSLine(b, "LAST-MODIFIED:"+todo.UpdatedAt.UTC().Format(icsTimeFormat))
+	writeICSLine(b, "SUMMARY:"+icsEscape(todo.Title))
+	if todo.Body != "" {
+		writeICSLine(b, "DESCRIPTION:"+icsEscape(todo.Body))
+	}
+	if todo.hasDueDate() {
+		// Todos due on a day are due by its end, others at a time
+		due := todo.DueDate.In(time.Local)
+		if due.Hour() == 23 && due.Minute() == 59 && due.Second() == 59 {
+			writeICSLine(b, "DUE;VALUE=DATE:"+due.Format(icsDateFormat))
+		} else {
+			writeICSLine(b, "DUE:"+due.UTC().Format(icsTimeFormat))
+		}
+	}
+	if p := icsPriority(todo.Priority); p > 0 {
+		writeICSLine(b, fmt.Sprintf("PRIORITY:%d", p))
+	}
+	if len(todo.Tags) > 0 {
+		tags := make([]string, len(todo.Tags))
+		for i, tag := range todo.Tags {
+			tags[i] = icsEscape(tag)
+		}
+		writeICSLine(b, "CATEGORIES:"+strings.Join(tags, ","))
+	}
+	if todo.Done {
+		writeICSLine(b, "STATUS:COMPLETED")
+		writeICSLine(b, "PERCENT-COMPLETE:100")
+		if !todo.CompletedAt.IsZero() {
+			writeICSLine(b, "COMPLETED:"+todo.CompletedAt.UTC().Format(icsTimeFormat))
+		}
+	} else {
+		writeICSLine(b, "STATUS:NEEDS-ACTION")
+	}
+	writeICSLine(b, "END:VTODO")
+}
+
+// CalendarHandler returns the todos as an iCalendar feed of VTODOs that
+// calendar apps can subscribe to. Apps cannot log in so the feed requires
+// the signed token of its user in ?token=, which is shown on the index.
+// Archived todos are left out.
+func (s *server) CalendarHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_ics")
+
+		if !s.checkFeedToken(w, r) {
+			return
+		}
+
+		prefix := keyPrefix(r)
+
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		sortTodos(todoList)
+
+		var b bytes.Buffer
+		beginVCALENDAR(&b)
+		writeICSLine(&b, "X-WR-CALNAME:todo")
+		for _, todo := range todoList {
+			writeVTODO(&b, todo, icsUID(r, prefix, todo))
+		}
+		writeICSLine(&b, "END:VCALENDAR")
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		setMaxAge(w, exportMaxAge, "private")
+		http.ServeContent(w, r, "todos.ics", lastModified(todoList), bytes.NewReader(b.Bytes()))
+	}
+}
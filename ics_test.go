@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// addFeedTodo adds a todo through the API from its JSON
+func addFeedTodo(t *testing.T, s *server, data string) *Todo {
+	w := serveRequest(s, newJSONRequest("POST", "/api/todos", data))
+	if w.Code != 201 {
+		t.Fatalf("expected 201 adding %s, got %d: %s", data, w.Code, w.Body)
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatal(err)
+	}
+	return &todo
+}
+
+// unfoldICS joins the folded lines of an iCalendar object, failing if any
+// line is longer than 75 octets or is not valid UTF-8 on its own
+func unfoldICS(t *testing.T, data string) []string {
+	if !strings.HasSuffix(data, "\r\n") {
+		t.Errorf("expected the object to end with CRLF, got %q", data)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("expected lines of at most 75 octets, got %d: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("expected a UTF-8 sequence not to be split: %q", line)
+		}
+		if strings.HasPrefix(line, " ") && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestWriteICSLine(t *testing.T) {
+	for _, line := range []string{
+		"SUMMARY:buy milk",
+		"DESCRIPTION:" + strings.Repeat("a", 200),
+		"DESCRIPTION:" + strings.Repeat("é", 100),
+		"SUMMARY:" + strings.Repeat("x", 67),
+	} {
+		var b bytes.Buffer
+		writeICSLine(&b, line)
+		if lines := unfoldICS(t, b.String()); len(lines) != 1 || lines[0] != line {
+			t.Errorf("expected %q to unfold into itself, got %q", line, lines)
+		}
+	}
+}
+
+func TestICSEscape(t *testing.T) {
+	if escaped := icsEscape("a\\b; c, d\r\ne\nf"); escaped != `a\\b\; c\, d\ne\nf` {
+		t.Errorf("expected the text to be escaped, got %q", escaped)
+	}
+	if s := "a\\b; c, d\ne"; icsUnescape(icsEscape(s)) != s {
+		t.Errorf("expected %q to round-trip", s)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	body := "notes; " + strings.Repeat("very long notes, ", 10) + "the end"
+	first := addFeedTodo(t, s, fmt.Sprintf(`{"title":"buy milk, eggs; bread","body":%q,"tags":["shopping","home"],"due":"2024-01-02","priority":"high","done":true}`, body))
+	second := addFeedTodo(t, s, `{"title":"walk the dog"}`)
+
+	if w := serve(s, "GET", "/todos.ics", nil); w.Code != 401 {
+		t.Errorf("expected 401 without the feed token, got %d", w.Code)
+	}
+
+	path, err := s.feedURL(httptest.NewRequest("GET", "/", nil), "/todos.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serve(s, "GET", path, nil)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 with the feed token, got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/calendar; charset=utf-8" {
+		t.Errorf("expected an iCalendar content type, got %q", ct)
+	}
+
+	var (
+		todos [][]string
+		todo  []string
+	)
+	for _, line := range unfoldICS(t, w.Body.String()) {
+		switch {
+		case line == "BEGIN:VTODO":
+			todo = []string{}
+		case line == "END:VTODO":
+			todos = append(todos, todo)
+			todo = nil
+		case todo != nil:
+			todo = append(todo, line)
+		}
+	}
+	if len(todos) != 2 {
+		t.Fatalf("expected 2 VTODOs, got %d:\n%s", len(todos), w.Body)
+	}
+
+	has := func(todo []string, prefix string) bool {
+		for _, line := range todo {
+			if strings.HasPrefix(line, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	done, open := todos[0], todos[1]
+	if has(open, "SUMMARY:buy milk") {
+		done, open = open, done
+	}
+	for _, line := range []string{
+		fmt.Sprintf("UID:todo-%d@example.com", first.ID),
+		`SUMMARY:buy milk\, eggs\; bread`,
+		"DESCRIPTION:" + icsEscape(body),
+		"DUE;VALUE=DATE:20240102",
+		"PRIORITY:1",
+		"CATEGORIES:shopping,home",
+		"STATUS:COMPLETED",
+		"PERCENT-COMPLETE:100",
+		"COMPLETED:",
+		"DTSTAMP:",
+		"LAST-MODIFIED:",
+	} {
+		if !has(done, line) {
+			t.Errorf("expected the done todo to have %s, got %q", line, done)
+		}
+	}
+	for _, line := range []string{fmt.Sprintf("UID:todo-%d@example.com", second.ID), "SUMMARY:walk the dog", "STATUS:NEEDS-ACTION"} {
+		if !has(open, line) {
+			t.Errorf("expected the open todo to have %s, got %q", line, open)
+		}
+	}
+	for _, line := range []string{"DUE", "CATEGORIES", "PRIORITY", "COMPLETED", "DESCRIPTION"} {
+		if has(open, line) {
+			t.Errorf("expected the open todo not to have %s, got %q", line, open)
+		}
+	}
+}
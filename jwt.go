@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for a malformed token or one whose
+	// signature does not match
+	ErrInvalidToken = errors.New("error: invalid token")
+
+	// ErrTokenExpired is returned for a well formed token that has expired
+	ErrTokenExpired = errors.New("error: token expired")
+)
+
+// jwtHeader is the fixed header of all tokens we issue, only HS256 is
+// supported
+var jwtHeader = base64.RawURLEncoding.EncodeToString(
+	[]byte(`{"alg":"HS256","typ":"JWT"}`),
+)
+
+// claims are the JWT claims carried by a session token
+type claims struct {
+	Subject   uint64 `json:"sub"`
+	Username  string `json:"name"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func newClaims(user *User, expiry time.Duration) *claims {
+	now := time.Now()
+	return &claims{
+		Subject:   user.ID,
+		Username:  user.Username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(expiry).Unix(),
+	}
+}
+
+func signJWT(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeJWT returns the claims as a HS256 signed JWT
+func encodeJWT(secret []byte, c *claims) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	payload := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signJWT(secret, payload), nil
+}
+
+// decodeJWT verifies the token's header and signature and returns its
+// claims if it has not yet expired
+func decodeJWT(secret []byte, token string) (*claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+
+	expected := signJWT(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var c claims
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= c.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	return &c, nil
+}
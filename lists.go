@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// maxListNameLength is the maximum length of a list's name
+const maxListNameLength = 32
+
+// errListExists is returned when naming a list like another one
+var errListExists = errors.New("list already exists")
+
+func listKey(prefix string, id uint64) []byte {
+	return []byte(fmt.Sprintf("%slist_%d", prefix, id))
+}
+
+// normalizeListName trims a list name and checks it can be used in
+// /list/:name
+func normalizeListName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if len(name) > maxListNameLength {
+		return "", fmt.Errorf("name is longer than %d characters", maxListNameLength)
+	}
+	for _, r := range name {
+		if r == '/' || unicode.IsControl(r) {
+			return "", fmt.Errorf("invalid name: %q", name)
+		}
+	}
+	return name, nil
+}
+
+// loadList returns the list with the given id under prefix, or
+// bitcask.ErrKeyNotFound if there is no such list
+func (s *server) loadList(prefix string, id uint64) (*List, error) {
+	data, err := s.db.Get(listKey(prefix, id))
+	if err != nil {
+		return nil, err
+	}
+
+	var list List
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// loadLists returns the lists under prefix ordered by name
+func (s *server) loadLists(prefix string) ([]*List, error) {
+	var lists []*List
+
+	err := s.db.Scan([]byte(prefix+"list_"), func(key []byte) error {
+		id, err := strconv.ParseUint(strings.TrimPrefix(string(key), prefix+"list_"), 10, 64)
+		if err != nil {
+			return nil
+		}
+
+		list, err := s.loadList(prefix, id)
+		if err != nil {
+			return err
+		}
+		lists = append(lists, list)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(lists, func(i, j int) bool {
+		return strings.ToLower(lists[i].Name) < strings.ToLower(lists[j].Name)
+	})
+
+	return lists, nil
+}
+
+// findList returns the list under prefix named name, ignoring case, or
+// bitcask.ErrKeyNotFound if there is none
+func (s *server) findList(prefix, name string) (*List, error) {
+	lists, err := s.loadLists(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, list := range lists {
+		if strings.EqualFold(list.Name, name) {
+			return list, nil
+		}
+	}
+
+	return nil, bitcask.ErrKeyNotFound
+}
+
+func (s *server) putList(prefix string, list *List) error {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(listKey(prefix, list.ID), data)
+}
+
+// createList adds a list named name under prefix, or returns errListExists
+// if there already is one. List ids start at 1 so a todo with a zero
+// ListID is on no list.
+func (s *server) createList(prefix, name string) (*List, error) {
+	s.lists.Lock()
+	defer s.lists.Unlock()
+
+	if _, err := s.findList(prefix, name); err == nil {
+		return nil, errListExists
+	} else if !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, err
+	}
+
+	id, err := s.allocateID(prefix + "nextlistid")
+	if err != nil {
+		return nil, err
+	}
+
+	list := newList(name)
+	list.ID = id + 1
+
+	if err := s.putList(prefix, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// renameList renames the list with the given id under prefix, or returns
+// errListExists if another list has the name
+func (s *server) renameList(prefix string, id uint64, name string) (*List, error) {
+	s.lists.Lock()
+	defer s.lists.Unlock()
+
+	list, err := s.loadList(prefix, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if other, err := s.findList(prefix, name); err == nil && other.ID != id {
+		return nil, errListExists
+	} else if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, err
+	}
+
+	list.Name = name
+	if err := s.putList(prefix, list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// deleteList deletes the list with the given id under prefix, moving its
+// todos to no list
+func (s *server) deleteList(ctx context.Context, prefix string, id uint64) error {
+	s.lists.Lock()
+	defer s.lists.Unlock()
+
+	if _, err := s.loadList(prefix, id); err != nil {
+		return err
+	}
+
+	for _, namespace := range []string{todoNamespace, archiveNamespace, trashNamespace} {
+		todoList, _, err := s.scanTodos(ctx, prefix, namespace)
+		if err != nil {
+			return err
+		}
+
+		for _, todo := range todoList {
+			if todo.ListID != id {
+				continue
+			}
+			key := fmt.Sprintf("%s%s%d", prefix, namespace, todo.ID)
+			_, _, err := s.updateTodoAt(key, func(todo *Todo) error {
+				todo.ListID = 0
+				return nil
+			})
+			if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+				return err
+			}
+		}
+	}
+
+	return s.db.Delete(listKey(prefix, id))
+}
+
+// ListHandler renders the index showing only the todos of the list named
+// in the path, e.g. /list/Work, adding new todos to that list
+func (s *server) ListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_list")
+
+		list, err := s.findList(keyPrefix(r), p.ByName("name"))
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such list", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).Error("error loading list")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		q := r.URL.Query()
+		q.Set("list", strconv.FormatUint(list.ID, 10))
+		s.renderIndex(w, r, q, list.Name)
+	}
+}
+
+// NewListHandler adds the list named by the form's name field and shows it
+func (s *server) NewListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_new_list")
+
+		name, err := normalizeListName(r.FormValue("name"))
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := s.createList(keyPrefix(r), name)
+		if err != nil && !errors.Is(err, errListExists) {
+			requestLog(r).WithError(err).Error("error adding list")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = &List{Name: name}
+		}
+
+		http.Redirect(w, r, "/list/"+url.PathEscape(list.Name), http.StatusFound)
+	}
+}
+
+type listsResponse struct {
+	Lists []*List `json:"lists"`
+}
+
+type listRequest struct {
+	Name string `json:"name"`
+}
+
+// decodeListRequest decodes and validates the name of a list from the
+// request body
+func decodeListRequest(w http.ResponseWriter, r *http.Request) (string, error) {
+	var req listRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		return "", errors.New("invalid list")
+	}
+	return normalizeListName(req.Name)
+}
+
+// ListsHandler returns the lists ordered by name
+func (s *server) ListsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_lists")
+
+		lists, err := s.loadLists(keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing lists")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		if lists == nil {
+			lists = []*List{}
+		}
+
+		writeJSON(w, r, http.StatusOK, listsResponse{Lists: lists})
+	}
+}
+
+// CreateListHandler adds a list, responding 201 Created with the list
+func (s *server) CreateListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_create_list")
+
+		name, err := decodeListRequest(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := s.createList(keyPrefix(r), name)
+		if err != nil {
+			if errors.Is(err, errListExists) {
+				http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+				return
+			}
+			requestLog(r).WithError(err).Error("error adding list")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/%d", strings.TrimSuffix(r.URL.Path, "/"), list.ID))
+		writeJSON(w, r, http.StatusCreated, list)
+	}
+}
+
+// RenameListHandler renames a list
+func (s *server) RenameListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_rename_list")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		name, err := decodeListRequest(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		list, err := s.renameList(keyPrefix(r), id, name)
+		if err != nil {
+			switch {
+			case errors.Is(err, bitcask.ErrKeyNotFound):
+				http.Error(w, "Not Found: no such list", http.StatusNotFound)
+			case errors.Is(err, errListExists):
+				http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+			default:
+				requestLog(r).WithError(err).WithField("id", id).Error("error renaming list")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, list)
+	}
+}
+
+// DeleteListHandler deletes a list keeping its todos, which are moved to
+// no list, responding 204 No Content
+func (s *server) DeleteListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_delete_list")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.deleteList(r.Context(), keyPrefix(r), id); err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such list", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("id", id).Error("error deleting list")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
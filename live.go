@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// liveBuffer is the number of events queued for a slow live client
+	// before further events are dropped for it
+	liveBuffer = 16
+
+	// liveKeepAlive is how often an idle live stream sends a comment so
+	// proxies do not close it
+	liveKeepAlive = 30 * time.Second
+
+	// liveRetry is how long browsers wait before reconnecting a live
+	// stream that was closed
+	liveRetry = 3 * time.Second
+)
+
+// broadcaster fans out changes to todos to the live streams of the user
+// they belong to
+type broadcaster struct {
+	sync.Mutex
+
+	subs   map[chan event]string
+	closed bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[chan event]string)}
+}
+
+// Subscribe returns a channel receiving the events of todos under prefix
+// and a function to stop receiving them. The channel is closed when the
+// broadcaster is.
+func (b *broadcaster) Subscribe(prefix string) (<-chan event, func()) {
+	b.Lock()
+	defer b.Unlock()
+
+	ch := make(chan event, liveBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = prefix
+
+	return ch, func() {
+		b.Lock()
+		defer b.Unlock()
+
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends e to every subscriber of its prefix without waiting for
+// them, dropping it for subscribers that are behind
+func (b *broadcaster) Publish(e event) {
+	b.Lock()
+	defer b.Unlock()
+
+	for ch, prefix := range b.subs {
+		if prefix != e.Prefix {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription so live streams return on shutdown
+func (b *broadcaster) Close() {
+	b.Lock()
+	defer b.Unlock()
+
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	b.closed = true
+}
+
+// LiveHandler streams the changes to the user's todos as server-sent
+// events named after the operation with the event as data, so open pages
+// can update without reloading
+func (s *server) LiveHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_live")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			requestLog(r).Warn("live streams unsupported: response writer does not flush")
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+			return
+		}
+
+		events, cancel := s.live.Subscribe(keyPrefix(r))
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", liveRetry.Milliseconds())
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(liveKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					requestLog(r).WithError(err).Error("error encoding event")
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Op, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+
+			flusher.Flush()
+		}
+	}
+}
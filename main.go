@@ -1,22 +1,31 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/namsral/flag"
-	"github.com/prologic/bitcask"
-)
-
-var (
-	db *bitcask.Bitcask
 )
 
 func main() {
 	var (
+		storeKind            string
 		dbpath               string
+		redisAddr            string
+		redisPassword        string
+		redisDB              int
+		namespace            string
 		bind                 string
+		maxTodos             int
 		maxItems             int
 		maxTitleLength       int
 		colorTheme           string
@@ -26,12 +35,81 @@ func main() {
 		colorCheckMark       string
 		colorXMark           string
 		colorLabel           string
+		apiKeys              string
+		multiUser            bool
+		jwtSecret            string
+		jwtExpiry            time.Duration
+		encryptionKey        string
+		gzipEnabled          bool
+		gzipLevel            int
+		undoDepth            int
+		dedupe               bool
+		confirmClear         bool
+		reminderInterval     time.Duration
+		reminderWindow       time.Duration
+		trashRetention       time.Duration
+		vapidPublicKey       string
+		vapidPrivateKey      string
+		vapidSubject         string
+		slackWebhook         string
+		slackTemplate        string
+		webhooks             string
+		ntfyURL              string
+		ntfyToken            string
+		gotifyURL            string
+		gotifyToken          string
+		notifyCreated        bool
+		webhookSecret        string
+		smtpHost             string
+		smtpPort             int
+		smtpUser             string
+		smtpPassword         string
+		smtpFrom             string
+		smtpTo               string
+		logFormat            string
+		logLevel             string
+		showVersion          bool
+		trustProxy           bool
+		metricsEnabled       bool
+		eventLogPath         string
+		eventLogMaxSize      int64
+		readTimeout          time.Duration
+		writeTimeout         time.Duration
+		idleTimeout          time.Duration
+		metricsAdmin         bool
+		timezone             string
+		indexLimit           int
+		indexSort            string
+		indexDone            string
+		tlsCert              string
+		tlsKey               string
+		autocertHosts        string
+		autocertDir          string
+		basePath             string
+		graphqlEnabled       bool
+		configPath           string
 	)
 
+	// The configuration file is parsed below rather than by the flag
+	// package, which only reads files of name value lines
+	flag.DefaultConfigFlagname = ""
+
 	fs := flag.NewFlagSet(os.Args[0], 0)
-	fs.StringVar(&dbpath, "dbpath", "todo.db", "Database path")
+	fs.StringVar(&configPath, "config", "", "path of a YAML (.yaml or .yml) or name value lines configuration file, overridden by the environment and flags")
+	fs.StringVar(&storeKind, "store", "bitcask", "where todos are stored, bitcask, sqlite or redis (sqlite:/path for a SQLite database at path)")
+	fs.StringVar(&redisAddr, "redisaddr", "localhost:6379", "address of the Redis server with -store=redis")
+	fs.StringVar(&redisPassword, "redispassword", "", "password of the Redis server")
+	fs.IntVar(&redisDB, "redisdb", 0, "Redis database number")
+	fs.StringVar(&dbpath, "dbpath", "todo.db", "Database path (:memory: for an in-memory database)")
+	fs.StringVar(&namespace, "namespace", "", "prefix of every key stored so several instances can share a database")
 	fs.StringVar(&bind, "bind", "0.0.0.0:8000", "[int]:<port> to bind to")
-	fs.IntVar(&maxItems, "maxitems", 100, "maximum number of items allowed in the todo list")
+	fs.StringVar(&basePath, "basepath", "", "path to serve the site under behind a reverse proxy, e.g. /todo")
+	fs.StringVar(&tlsCert, "tlscert", "", "path of the TLS certificate to serve HTTPS with")
+	fs.StringVar(&tlsKey, "tlskey", "", "path of the TLS private key to serve HTTPS with")
+	fs.StringVar(&autocertHosts, "autocert", "", "comma separated hostnames to serve HTTPS for with certificates from Let's Encrypt")
+	fs.StringVar(&autocertDir, "autocertdir", "autocert", "directory the certificates from Let's Encrypt are cached in")
+	fs.IntVar(&maxTodos, "maxtodos", 100, "maximum number of todos allowed on each todo list (0 for unlimited)")
+	fs.IntVar(&maxItems, "maxitems", -1, "deprecated alias of -maxtodos")
 	fs.IntVar(&maxTitleLength, "maxtitlelength", 100, "maximum valid length of a todo item's title")
 	fs.StringVar(&colorTheme, "theme", "dracula", "color theme of the todo list, or 'custom'")
 	fs.StringVar(&colorPageBackground, "pagebackground", "282a36", "page background color")
@@ -40,12 +118,112 @@ func main() {
 	fs.StringVar(&colorCheckMark, "check", "50fa7b", "check mark color")
 	fs.StringVar(&colorXMark, "x", "ff5555", "x mark color")
 	fs.StringVar(&colorLabel, "label", "ff79c6", "label color")
+	fs.StringVar(&timezone, "timezone", "", "timezone of due dates and the today view, e.g. Europe/Berlin (defaults to the system's)")
+	fs.DurationVar(&readTimeout, "readtimeout", defaultReadTimeout, "maximum time to read a request, 0 for none")
+	fs.DurationVar(&writeTimeout, "writetimeout", defaultWriteTimeout, "maximum time to handle a request and write its response, 0 for none")
+	fs.DurationVar(&idleTimeout, "idletimeout", defaultIdleTimeout, "how long idle keep-alive connections are kept open, 0 for none")
+	fs.StringVar(&eventLogPath, "eventlog", "", "path of a JSON lines log of every change to todos for sync clients")
+	fs.Int64Var(&eventLogMaxSize, "eventlogmaxsize", defaultEventLogMaxSize, "size in bytes the event log is rotated at")
+	fs.BoolVar(&metricsEnabled, "metrics", true, "serve the metrics and stats routes")
+	fs.BoolVar(&metricsAdmin, "metricsadmin", false, "serve the metrics and stats routes under /admin/, which requires an API key")
+	fs.BoolVar(&trustProxy, "trustproxy", false, "trust the X-Forwarded-Host and X-Forwarded-Proto headers of a reverse proxy")
+	fs.IntVar(&indexLimit, "indexlimit", 0, "number of todos shown on the index by default (0 for all)")
+	fs.StringVar(&indexSort, "indexsort", defaultSort, "default sort order of the index, e.g. -due")
+	fs.StringVar(&indexDone, "indexdone", "", "show only done (true) or not done (false) todos on the index by default")
+	fs.BoolVar(&graphqlEnabled, "graphql", false, "serve GraphQL queries on POST /graphql")
+	fs.StringVar(&apiKeys, "apikeys", "", "comma separated list of API keys required on /api/ routes")
+	fs.BoolVar(&multiUser, "multiuser", false, "enable user accounts with a separate todo list per user")
+	fs.StringVar(&jwtSecret, "jwtsecret", "", "secret used to sign session tokens in multi-user mode")
+	fs.DurationVar(&jwtExpiry, "jwtexpiry", 24*time.Hour, "expiry of session tokens in multi-user mode")
+	fs.StringVar(&encryptionKey, "encryptionkey", "", "encrypt stored todos with this key")
+	fs.BoolVar(&gzipEnabled, "gzip", true, "compress responses with gzip")
+	fs.IntVar(&gzipLevel, "gziplevel", -1, "gzip compression level (1-9, or -1 for the default)")
+	fs.IntVar(&undoDepth, "undodepth", defaultUndoDepth, "number of actions that can be undone, 0 to disable")
+	fs.BoolVar(&confirmClear, "confirmclear", true, "ask for confirmation before deleting a todo")
+	fs.BoolVar(&dedupe, "dedupe", false, "ignore adding a todo with the same title as an incomplete todo")
+	fs.DurationVar(&reminderInterval, "reminderinterval", defaultReminderInterval, "how often to check for due todos")
+	fs.DurationVar(&reminderWindow, "reminderwindow", 0, "how long before its due date a todo's reminder is sent")
+	fs.DurationVar(&trashRetention, "trashretention", 0, "how long deleted todos are kept in the trash before being purged, 0 to keep them forever")
+	fs.StringVar(&vapidPublicKey, "vapidpublickey", "", "VAPID public key for web push notifications")
+	fs.StringVar(&vapidPrivateKey, "vapidprivatekey", "", "VAPID private key for web push notifications")
+	fs.StringVar(&vapidSubject, "vapidsubject", "", "VAPID subject (mailto: or https: URL) for web push notifications")
+	fs.StringVar(&slackWebhook, "slackwebhook", "", "Slack incoming webhook URL to post created and completed todos to")
+	fs.StringVar(&slackTemplate, "slacktemplate", defaultSlackTemplate, "template of messages posted to Slack")
+	fs.StringVar(&webhooks, "webhooks", "", "comma separated list of URLs to post created, completed and deleted todos to")
+	fs.StringVar(&webhookSecret, "webhooksecret", "", "secret to sign the payloads posted to webhooks with")
+	fs.StringVar(&ntfyURL, "ntfyurl", "", "ntfy topic URL to send reminders for due todos to, e.g. https://ntfy.sh/mytopic")
+	fs.StringVar(&ntfyToken, "ntfytoken", "", "access token to publish to the ntfy topic with")
+	fs.StringVar(&gotifyURL, "gotifyurl", "", "URL of a Gotify server to send reminders for due todos to")
+	fs.StringVar(&gotifyToken, "gotifytoken", "", "Gotify application token")
+	fs.BoolVar(&notifyCreated, "notifycreated", false, "also send ntfy and Gotify notifications when todos are created")
+	fs.StringVar(&smtpHost, "smtphost", "", "SMTP server to send email reminders for due todos through")
+	fs.IntVar(&smtpPort, "smtpport", defaultSMTPPort, "port of the SMTP server")
+	fs.StringVar(&smtpUser, "smtpuser", "", "username to authenticate to the SMTP server with")
+	fs.StringVar(&smtpPassword, "smtppassword", "", "password to authenticate to the SMTP server with")
+	fs.StringVar(&smtpFrom, "smtpfrom", "", "sender address of email reminders")
+	fs.StringVar(&smtpTo, "smtpto", "", "comma separated list of addresses to send email reminders to")
+	fs.StringVar(&logFormat, "logformat", "text", "format of the application and access logs (text or json)")
+	fs.StringVar(&logLevel, "loglevel", "info", "minimum level of log messages (debug, info, warn, error)")
+	fs.BoolVar(&showVersion, "version", false, "print the version and exit")
 	err := fs.Parse(os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
+	if configPath != "" {
+		if err := parseConfigFile(fs, configPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	if err := configureLogging(logFormat, logLevel); err != nil {
+		log.Fatal(err)
+	}
 
-	db, err = bitcask.Open(dbpath)
+	if maxItems >= 0 {
+		log.Print("-maxitems is deprecated, use -maxtodos")
+		maxTodos = maxItems
+	}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			log.Fatalf("invalid -timezone: %s", err)
+		}
+		time.Local = loc
+	}
+
+	if multiUser && jwtSecret == "" {
+		log.Fatal("-jwtsecret is required in multi-user mode")
+	}
+
+	order, err := parseSortOrder(indexSort)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if indexDone != "" {
+		if _, err := strconv.ParseBool(indexDone); err != nil {
+			log.Fatalf("invalid -indexdone: %q", indexDone)
+		}
+	}
+	if indexLimit < 0 {
+		log.Fatalf("invalid -indexlimit: %d", indexLimit)
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		log.Fatal("-tlscert and -tlskey must be set together")
+	}
+	if autocertHosts != "" && tlsCert != "" {
+		log.Fatal("-autocert cannot be used with -tlscert")
+	}
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		log.Fatalf("invalid -basepath: %q must start with /", basePath)
+	}
+
+	db, err := openStore(storeKind, dbpath, redisConfig{addr: redisAddr, password: redisPassword, db: redisDB})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -54,7 +232,121 @@ func main() {
 	selectColorTheme(colorTheme, colorPageBackground, colorInputBackground, colorForeground,
 		colorCheckMark, colorXMark, colorLabel)
 
-	newServer(bind, maxItems, maxTitleLength).listenAndServe()
+	opts := []option{
+		withAPIKeys(splitList(apiKeys)...),
+		withGzip(gzipEnabled, gzipLevel),
+		withUndoDepth(undoDepth),
+		withDedupe(dedupe),
+		withConfirmClear(confirmClear),
+		withReminders(reminderInterval, reminderWindow),
+		withTrashRetention(trashRetention),
+		withIndexDefaults(indexLimit, order, indexDone),
+		withTrustProxy(trustProxy),
+		withBasePath(basePath),
+		withGraphQL(graphqlEnabled),
+		withMetrics(metricsEnabled, metricsAdmin),
+		withTimeouts(readTimeout, writeTimeout, idleTimeout),
+		withTLS(tlsCert, tlsKey),
+		withAutocert(splitList(autocertHosts), autocertDir),
+	}
+	if multiUser {
+		opts = append(opts, withMultiUser(jwtSecret, jwtExpiry))
+	}
+	if vapidPublicKey != "" && vapidPrivateKey != "" {
+		opts = append(opts, withPush(vapidPublicKey, vapidPrivateKey, vapidSubject))
+	}
+	if slackWebhook != "" {
+		slack, err := newSlackNotifier(slackWebhook, slackTemplate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, withNotifier(slack, eventCreated, eventCompleted))
+	}
+	phoneEvents := []string{eventDue}
+	if notifyCreated {
+		phoneEvents = append(phoneEvents, eventCreated)
+	}
+	if ntfyURL != "" {
+		ntfy, err := newNtfyNotifier(ntfyURL, ntfyToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, withNotifier(ntfy, phoneEvents...))
+	}
+	if gotifyURL != "" {
+		gotify, err := newGotifyNotifier(gotifyURL, gotifyToken)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, withNotifier(gotify, phoneEvents...))
+	}
+	if urls := splitList(webhooks); len(urls) > 0 {
+		for _, u := range urls {
+			if _, err := url.ParseRequestURI(u); err != nil {
+				log.Fatalf("invalid -webhooks URL: %q", u)
+			}
+		}
+		opts = append(opts, withWebhooks(urls, webhookSecret))
+	}
+	if smtpHost != "" {
+		if smtpFrom == "" || smtpTo == "" {
+			log.Fatal("-smtpfrom and -smtpto are required to send email reminders")
+		}
+		email := newEmailNotifier(smtpHost, smtpPort, smtpUser, smtpPassword, smtpFrom, splitList(smtpTo))
+		opts = append(opts, withNotifier(email, eventDue))
+	}
+	// The event log seals todos like the database when encryption is on
+	var eventCodec codec
+	if encryptionKey != "" {
+		c, err := newAESCodec(encryptionKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, withEncryption(c))
+		eventCodec = c
+	}
+	if eventLogPath != "" {
+		el, err := openEventLog(eventLogPath, eventLogMaxSize, eventCodec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer el.Close()
+		opts = append(opts, withEventLog(el))
+	}
+
+	srv, err := newServer(withNamespace(db, namespace), bind, maxTodos, maxTitleLength, opts...)
+	if err != nil {
+		log.Fatalf("error creating server: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		// A second signal kills the process if shutting down hangs
+		signal.Stop(signals)
+		cancel()
+	}()
+
+	if err := srv.listenAndServe(ctx); err != nil {
+		// log.Fatal skips the deferred Close
+		db.Close()
+		log.Fatal(err)
+	}
+}
+
+// splitList splits a comma separated list dropping any empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func selectColorTheme(colorTheme string, colorPageBackground string, colorInputBackground string,
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxBodyLength is the maximum length of a todo's notes
+const maxBodyLength = 4096
+
+// normalizeBody trims the notes of a todo, using \n for line breaks
+func normalizeBody(body string) (string, error) {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.TrimRightFunc(body, unicode.IsSpace)
+	body = strings.TrimLeft(body, "\n")
+	if len(body) > maxBodyLength {
+		return "", fmt.Errorf("body is longer than %d bytes", maxBodyLength)
+	}
+	return body, nil
+}
+
+var (
+	orderedItem = regexp.MustCompile(`^\d+[.)]\s+`)
+	heading     = regexp.MustCompile(`^(#{1,6})\s+`)
+)
+
+// markdown renders s, a todo's notes, as HTML. Only a subset of Markdown
+// is supported: paragraphs, headings, lists, ``` code blocks, **strong**,
+// *emphasis*, `code` and [links](https://example.com); URLs are linked as in
+// titles. Everything else, raw HTML included, is escaped and only http(s)
+// and mailto links are made, so the result is safe to include in a page.
+func markdown(s string) template.HTML {
+	var b strings.Builder
+
+	var (
+		para []string
+		list string
+	)
+	closeBlocks := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>")
+			for i, line := range para {
+				if i > 0 {
+					b.WriteString("<br />")
+				}
+				b.WriteString(markdownInline(line, true))
+			}
+			b.WriteString("</p>")
+			para = nil
+		}
+		if list != "" {
+			fmt.Fprintf(&b, "</%s>", list)
+			list = ""
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRightFunc(lines[i], unicode.IsSpace)
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			closeBlocks()
+
+		case strings.HasPrefix(trimmed, "```"):
+			closeBlocks()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre class=\"code\"><code>")
+			b.WriteString(template.HTMLEscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>")
+
+		case heading.MatchString(trimmed):
+			closeBlocks()
+			m := heading.FindStringSubmatch(trimmed)
+			level := len(m[1]) + 3
+			if level > 6 {
+				level = 6
+			}
+			fmt.Fprintf(&b, "<h%d>%s</h%d>", level, markdownInline(trimmed[len(m[0]):], true), level)
+
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			if list != "ul" {
+				closeBlocks()
+				b.WriteString("<ul>")
+				list = "ul"
+			}
+			fmt.Fprintf(&b, "<li>%s</li>", markdownInline(strings.TrimSpace(trimmed[2:]), true))
+
+		case orderedItem.MatchString(trimmed):
+			if list != "ol" {
+				closeBlocks()
+				b.WriteString("<ol>")
+				list = "ol"
+			}
+			item := trimmed[len(orderedItem.FindString(trimmed)):]
+			fmt.Fprintf(&b, "<li>%s</li>", markdownInline(item, true))
+
+		default:
+			if list != "" {
+				closeBlocks()
+			}
+			para = append(para, trimmed)
+		}
+	}
+	closeBlocks()
+
+	return template.HTML(b.String())
+}
+
+// markdownInline renders the inline Markdown of s as HTML, linking URLs and
+// [links](...) if links is set. Text between markers is escaped.
+func markdownInline(s string, links bool) string {
+	var b strings.Builder
+
+	text := 0
+	flush := func(end int) {
+		if links {
+			b.WriteString(string(linkify(s[text:end])))
+		} else {
+			b.WriteString(template.HTMLEscapeString(s[text:end]))
+		}
+	}
+
+	for i := 0; i < len(s); {
+		var (
+			html string
+			next int
+		)
+
+		switch {
+		case s[i] == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				html = "<code>" + template.HTMLEscapeString(s[i+1:i+1+end]) + "</code>"
+				next = i + 1 + end + 1
+			}
+
+		case strings.HasPrefix(s[i:], "**"):
+			if end := strings.Index(s[i+2:], "**"); end > 0 {
+				html = "<strong>" + markdownInline(s[i+2:i+2+end], links) + "</strong>"
+				next = i + 2 + end + 2
+			}
+
+		case s[i] == '*' || (s[i] == '_' && !wordBefore(s, i)):
+			if end := strings.IndexByte(s[i+1:], s[i]); end > 0 && s[i+1] != ' ' {
+				html = "<em>" + markdownInline(s[i+1:i+1+end], links) + "</em>"
+				next = i + 1 + end + 1
+			}
+
+		case s[i] == '[' && links:
+			if end := strings.Index(s[i:], "]("); end > 0 {
+				if close := strings.IndexByte(s[i+end+2:], ')'); close >= 0 {
+					label := s[i+1 : i+end]
+					href := strings.TrimSpace(s[i+end+2 : i+end+2+close])
+					if safeLink(href) {
+						html = fmt.Sprintf(`<a href="%s" rel="noopener noreferrer" target="_blank">%s</a>`,
+							template.HTMLEscapeString(href), markdownInline(label, false))
+						next = i + end + 2 + close + 1
+					}
+				}
+			}
+		}
+
+		if html == "" {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			continue
+		}
+
+		flush(i)
+		b.WriteString(html)
+		i, text = next, next
+	}
+	flush(len(s))
+
+	return b.String()
+}
+
+// wordBefore reports whether the byte before s[i] is part of a word, so
+// underscores in snake_case are not taken for emphasis
+func wordBefore(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// safeLink reports whether href is an absolute http(s) or mailto URL that
+// can be linked to
+func safeLink(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+type mergeRequest struct {
+	Into *uint64  `json:"into"`
+	From []uint64 `json:"from"`
+}
+
+type mergeResponse struct {
+	Todo    *Todo    `json:"todo"`
+	Merged  []uint64 `json:"merged"`
+	Skipped []uint64 `json:"skipped"`
+}
+
+// mergeTodo merges src into todo, appending its notes, taking the union of
+// their tags and the earliest creation time
+func mergeTodo(todo, src *Todo) {
+	switch {
+	case src.Body == "":
+	case todo.Body == "":
+		todo.Body = src.Body
+	default:
+		todo.Body += "\n\n" + src.Body
+	}
+	for _, tag := range src.Tags {
+		todo.addTag(tag)
+	}
+	if src.CreatedAt.Before(todo.CreatedAt) {
+		todo.CreatedAt = src.CreatedAt
+	}
+}
+
+// MergeHandler merges near duplicate todos: the todos in from are merged
+// into the todo into (see mergeTodo) and then deleted. Sources that do not
+// exist or are the target itself are skipped.
+func (s *server) MergeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_merge")
+
+		var req mergeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			http.Error(w, "Bad Request: invalid merge", http.StatusBadRequest)
+			return
+		}
+		if req.Into == nil {
+			http.Error(w, "Bad Request: into is required", http.StatusBadRequest)
+			return
+		}
+		into := *req.Into
+
+		prefix := keyPrefix(r)
+		res := mergeResponse{Merged: []uint64{}, Skipped: []uint64{}}
+
+		var sources []*Todo
+		for _, id := range req.From {
+			if id == into {
+				res.Skipped = append(res.Skipped, id)
+				continue
+			}
+
+			src, err := s.loadTodo(prefix, id)
+			if err != nil {
+				if errors.Is(err, bitcask.ErrKeyNotFound) {
+					requestLog(r).WithField("id", id).Warn("todo to merge not found, skipping")
+					res.Skipped = append(res.Skipped, id)
+					continue
+				}
+				requestLog(r).WithError(err).WithField("id", id).Error("error loading todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			sources = append(sources, src)
+		}
+
+		before, todo, err := s.updateTodo(prefix, into, func(todo *Todo) error {
+			for _, src := range sources {
+				mergeTodo(todo, src)
+			}
+			todo.UpdatedAt = s.now()
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("id", into).Error("error updating todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.trackTodo(before, todo)
+		s.undo.Push(prefix, undoEntry{key: fmt.Sprintf("%stodo_%d", prefix, into), before: before})
+
+		for _, src := range sources {
+			if _, err := s.deleteTodo(r.Context(), prefix, src.ID); err != nil {
+				if errors.Is(err, bitcask.ErrKeyNotFound) {
+					res.Skipped = append(res.Skipped, src.ID)
+					continue
+				}
+				requestLog(r).WithError(err).WithField("id", src.ID).Error("error deleting merged todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+			res.Merged = append(res.Merged, src.ID)
+		}
+
+		res.Todo = todo
+		w.Header().Set("ETag", etag(todo))
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
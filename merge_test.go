@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// addMergeTodo adds a todo with the given notes and tags created at created
+func addMergeTodo(t *testing.T, s *server, title, body string, tags []string, created time.Time) {
+	todo := addTestTodo(t, s, title)
+	_, _, err := s.updateTodoAt(fmt.Sprintf("todo_%d", todo.ID), func(todo *Todo) error {
+		todo.Body = body
+		todo.Tags = tags
+		todo.CreatedAt = created
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addMergeTodo(t, s, "buy milk", "semi-skimmed", []string{"errands", "home"}, testTime.Add(time.Hour))
+	addMergeTodo(t, s, "get milk", "", []string{"home"}, testTime.Add(2*time.Hour))
+	addMergeTodo(t, s, "milk!", "from the corner shop", []string{"shop", "errands"}, testTime)
+
+	w := serveRequest(s, newJSONRequest("POST", "/api/todos/merge", `{"into":0,"from":[1,2,0,7]}`))
+	if w.Code != 200 {
+		t.Fatalf("expected 200 merging, got %d", w.Code)
+	}
+
+	var res mergeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Merged, []uint64{1, 2}) {
+		t.Errorf("expected 1 and 2 to be merged, got %v", res.Merged)
+	}
+	// The target itself and missing todos are skipped
+	if !reflect.DeepEqual(res.Skipped, []uint64{0, 7}) {
+		t.Errorf("expected 0 and 7 to be skipped, got %v", res.Skipped)
+	}
+
+	todo := res.Todo
+	if todo.ID != 0 || todo.Title != "buy milk" {
+		t.Errorf("expected the target's id and title to be kept, got %+v", todo)
+	}
+	if expected := "semi-skimmed\n\nfrom the corner shop"; todo.Body != expected {
+		t.Errorf("expected the notes to be concatenated as %q, got %q", expected, todo.Body)
+	}
+	if expected := []string{"errands", "home", "shop"}; !reflect.DeepEqual(todo.Tags, expected) {
+		t.Errorf("expected the union of the tags %v, got %v", expected, todo.Tags)
+	}
+	if !todo.CreatedAt.Equal(testTime) {
+		t.Errorf("expected the earliest creation time, got %s", todo.CreatedAt)
+	}
+
+	if db.Has([]byte("todo_1")) || db.Has([]byte("todo_2")) {
+		t.Error("expected the merged todos to be deleted")
+	}
+	if n := todoGauges(s); n != 1 {
+		t.Errorf("expected 1 todo counted, got %d", n)
+	}
+}
+
+func TestMergeIntoMissingTodo(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	addTestTodo(t, s, "buy milk")
+
+	if w := serveRequest(s, newJSONRequest("POST", "/api/todos/merge", `{"into":7,"from":[0]}`)); w.Code != 404 {
+		t.Errorf("expected 404 merging into a missing todo, got %d", w.Code)
+	}
+	if _, err := s.loadTodo("", 0); err != nil {
+		t.Errorf("expected the source to be kept: %s", err)
+	}
+
+	if w := serveRequest(s, newJSONRequest("POST", "/api/todos/merge", `{"from":[0]}`)); w.Code != 400 {
+		t.Errorf("expected 400 without into, got %d", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// unmatchedRoute is the route label of requests not matching any route
+const unmatchedRoute = "unmatched"
+
+// requestMetric returns the name of the counter of requests to route that
+// were answered with status. go-metrics has no labels so they are encoded
+// into the name, e.g. requests{route="/done/:id",status="404"}.
+func requestMetric(route string, status int) string {
+	return fmt.Sprintf(`requests{route=%q,status="%d"}`, route, status)
+}
+
+// instrument wraps the handler of route counting its requests by status
+// and timing them
+func (s *server) instrument(route string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(sr, r, p)
+		s.counters.Inc(requestMetric(route, sr.status))
+		s.durations.Observe(route, time.Since(start))
+	}
+}
+
+// handle registers the handler for method and path on the router, counting
+// its requests by route and status
+func (s *server) handle(method, path string, h httprouter.Handle) {
+	s.router.Handle(method, path, s.instrument(path, h))
+}
+
+// notFound counts and answers requests not matching any route
+func (s *server) notFound() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		s.counters.Inc(requestMetric(unmatchedRoute, http.StatusNotFound))
+		http.NotFound(w, r)
+		s.durations.Observe(unmatchedRoute, time.Since(start))
+	})
+}
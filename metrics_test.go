@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	s := newTestServer(t, newMemoryStore(), withMetrics(true, false))
+	addTestTodo(t, s, "buy milk")
+
+	serve(s, "POST", "/done/7", nil)
+	serve(s, "POST", "/done/7", nil)
+	serve(s, "POST", "/done/0", nil)
+	serve(s, "GET", "/no/such/route", nil)
+
+	w := serve(s, "GET", "/debug/metrics", nil)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 getting the metrics, got %d", w.Code)
+	}
+	var metrics map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]float64{
+		`requests{route="/done/:id",status="404"}`: 2,
+		`requests{route="/done/:id",status="302"}`: 1,
+		`requests{route="unmatched",status="404"}`: 1,
+	} {
+		if n, _ := metrics[name].(float64); n != expected {
+			t.Errorf("expected %s to be %v, got %v", name, expected, metrics[name])
+		}
+	}
+
+	body := serve(s, "GET", "/metrics", nil).Body.String()
+	for _, expected := range []string{
+		`todo_requests_total{route="/done/:id",status="404"} 2`,
+		`todo_requests_total{route="unmatched",status="404"} 1`,
+		`todo_request_duration_seconds_count{route="/done/:id"} 3`,
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Errorf("expected the Prometheus metrics to contain %s, got:\n%s", expected, body)
+		}
+	}
+}
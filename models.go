@@ -1,16 +1,145 @@
 package main
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// colorPalette are the named colors a todo can be labeled with
+var colorPalette = []string{"red", "orange", "yellow", "green", "blue", "purple", "pink", "gray"}
+
+var hexColor = regexp.MustCompile(`^#?[0-9a-f]{6}$`)
+
+// normalizeColor returns the canonical form of a named palette color or a
+// hex color (with or without the leading #) and whether it is valid
+func normalizeColor(color string) (string, bool) {
+	color = strings.ToLower(strings.TrimSpace(color))
+
+	for _, c := range colorPalette {
+		if color == c {
+			return color, true
+		}
+	}
+
+	if hexColor.MatchString(color) {
+		return "#" + strings.TrimPrefix(color, "#"), true
+	}
+
+	return "", false
+}
+
+// maxTagLength is the maximum length of a tag in characters
+const maxTagLength = 32
+
+// normalizeTags returns the canonical form of the given tags, each of which
+// may itself be a comma separated list. Tags are lowercased with runs of
+// spaces replaced by "-", and empty and duplicate tags are dropped. A tag
+// longer than maxTagLength or containing anything other than letters,
+// digits, "-" and "_" is returned as an error.
+func normalizeTags(tags ...string) ([]string, error) {
+	var normalized []string
+
+	seen := make(map[string]bool)
+	for _, list := range tags {
+		for _, tag := range strings.Split(list, ",") {
+			tag = strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+			if tag == "" || seen[tag] {
+				continue
+			}
+
+			if utf8.RuneCountInString(tag) > maxTagLength {
+				return nil, fmt.Errorf("tag too long: %q", tag)
+			}
+			for _, c := range tag {
+				if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' {
+					return nil, fmt.Errorf("invalid tag: %q", tag)
+				}
+			}
+
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized, nil
+}
+
+var hashtag = regexp.MustCompile(`(^|\s)#([\p{L}\p{N}_-]+)`)
+
+// extractHashtags removes the #hashtags from a title returning the title
+// without them and the tags. A title of nothing but hashtags is kept as
+// is so the todo still has a title.
+func extractHashtags(title string) (string, []string) {
+	var tags []string
+	for _, m := range hashtag.FindAllStringSubmatch(title, -1) {
+		tags = append(tags, m[2])
+	}
+	if tags == nil {
+		return title, nil
+	}
+
+	stripped := strings.Join(strings.Fields(hashtag.ReplaceAllString(title, "$1")), " ")
+	if stripped == "" {
+		return title, tags
+	}
+	return stripped, tags
+}
+
 // Todo represents a single item on the todo list
 type Todo struct {
 	ID        uint64
 	Done      bool
 	Title     string
+	Color     string
+	Tags      []string
+	DueDate   time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// Priority is how important the todo is, priorityNone if unset
+	Priority priority
+
+	// CompletedAt is when the todo was last marked done, zero while it is
+	// not done
+	CompletedAt time.Time
+
+	// RemindedAt is when a reminder was sent for the todo's due date
+	RemindedAt time.Time
+
+	// RemindBefore is how long before its due date the todo's reminder is
+	// sent, 0 for the server's reminder window
+	RemindBefore time.Duration
+
+	// Rev is the revision of the todo, incremented every time it is
+	// stored
+	Rev int
+
+	// ArchivedAt is when the todo was moved to the archive, where it is
+	// purged once the trash retention has passed, zero on the list
+	ArchivedAt time.Time
+
+	// ListID is the id of the list the todo is on, 0 for none
+	ListID uint64
+
+	// Body holds notes on the todo in Markdown
+	Body string
+
+	// Position is the place of the todo in the list arranged by hand,
+	// from 1, or 0 if it has not been placed
+	Position int
+
+	// UID is the iCalendar UID a CalDAV client created the todo with,
+	// empty for todos created otherwise
+	UID string
+
+	// DeletedAt is when the todo was moved to the trash, where it is
+	// purged once the trash retention has passed
+	DeletedAt time.Time
 }
 
 func newTodo(title string) *Todo {
@@ -27,13 +156,129 @@ func (t *Todo) setTitle(title string) {
 }
 
 func (t *Todo) toggleDone() {
-	t.Done = !t.Done
+	t.setDone(!t.Done)
+	t.UpdatedAt = time.Now()
+}
+
+// setDone marks the todo as done or not, recording when it was completed
+func (t *Todo) setDone(done bool) {
+	if done && !t.Done {
+		t.CompletedAt = time.Now()
+	} else if !done {
+		t.CompletedAt = time.Time{}
+	}
+	t.Done = done
+}
+
+// hasDueDate reports whether the todo has a due date set
+func (t *Todo) hasDueDate() bool {
+	return !t.DueDate.IsZero()
+}
+
+// hasTag reports whether the todo is tagged with tag
+func (t *Todo) hasTag(tag string) bool {
+	for _, tt := range t.Tags {
+		if tt == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// addTag tags the todo with tag reporting whether it was not tagged already
+func (t *Todo) addTag(tag string) bool {
+	if t.hasTag(tag) {
+		return false
+	}
+	t.Tags = append(t.Tags, tag)
 	t.UpdatedAt = time.Now()
+	return true
+}
+
+// removeTag removes tag from the todo reporting whether it was tagged
+func (t *Todo) removeTag(tag string) bool {
+	if !t.hasTag(tag) {
+		return false
+	}
+	var tags []string
+	for _, tt := range t.Tags {
+		if tt != tag {
+			tags = append(tags, tt)
+		}
+	}
+	t.Tags = tags
+	t.UpdatedAt = time.Now()
+	return true
+}
+
+// isOverdue reports whether the todo is incomplete and past its due date
+func (t *Todo) isOverdue(now time.Time) bool {
+	return !t.Done && t.hasDueDate() && now.After(t.DueDate)
+}
+
+// dueStatus describes when an incomplete todo is due relative to now as
+// "overdue", "today" (by the end of now's day) or "upcoming", or returns
+// an empty string for done todos and todos without a due date
+func (t *Todo) dueStatus(now time.Time) string {
+	switch {
+	case t.Done || !t.hasDueDate():
+		return ""
+	case t.isOverdue(now):
+		return "overdue"
+	case t.DueDate.Before(endOfDay(now)):
+		return "today"
+	}
+	return "upcoming"
 }
 
 // TodoList represents a slice of todo items
 type TodoList []*Todo
 
-func (a TodoList) Len() int           { return len(a) }
-func (a TodoList) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a TodoList) Less(i, j int) bool { return a[i].ID < a[j].ID }
+func (a TodoList) Len() int      { return len(a) }
+func (a TodoList) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+
+// Less orders todos like sort=priority: by priority, highest first, then
+// by due date and then by ID. IDs are unique so the order is total and
+// never depends on the order todos were read from the database; any other
+// sort key must fall back to comparing IDs.
+func (a TodoList) Less(i, j int) bool {
+	if c := comparePriority(a[i], a[j]); c != 0 {
+		return c < 0
+	}
+	return a[i].ID < a[j].ID
+}
+
+// sortTodos sorts the todos in place into their display order
+func sortTodos(todoList TodoList) {
+	sort.Stable(todoList)
+}
+
+// User represents a user account when running in multi-user mode
+type User struct {
+	ID        uint64
+	Username  string
+	Password  []byte
+	CreatedAt time.Time
+}
+
+// List is a named group of todos, e.g. Work or Home
+type List struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created"`
+}
+
+func newList(name string) *List {
+	return &List{
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+}
+
+func newUser(username string, password []byte) *User {
+	return &User{
+		Username:  username,
+		Password:  password,
+		CreatedAt: time.Now(),
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	for _, tc := range []struct {
+		tags     []string
+		expected []string
+	}{
+		{nil, nil},
+		{[]string{""}, nil},
+		{[]string{" , ,"}, nil},
+		{[]string{"Work", "work", " work "}, []string{"work"}},
+		{[]string{"work,home", "Home"}, []string{"work", "home"}},
+		{[]string{"  side   project "}, []string{"side-project"}},
+		{[]string{"to_do", "to-do"}, []string{"to_do", "to-do"}},
+		{[]string{"Café", "CAFÉ", "日本"}, []string{"café", "日本"}},
+		{[]string{strings.Repeat("é", maxTagLength)}, []string{strings.Repeat("é", maxTagLength)}},
+	} {
+		tags, err := normalizeTags(tc.tags...)
+		if err != nil {
+			t.Errorf("expected %q to be valid, got %s", tc.tags, err)
+			continue
+		}
+		if !reflect.DeepEqual(tags, tc.expected) {
+			t.Errorf("expected %q to be normalized to %q, got %q", tc.tags, tc.expected, tags)
+		}
+	}
+}
+
+func TestNormalizeTagsInvalid(t *testing.T) {
+	for _, tag := range []string{
+		"c++",
+		"work!",
+		"<script>",
+		"a.b",
+		strings.Repeat("a", maxTagLength+1),
+	} {
+		if _, err := normalizeTags(tag); err == nil {
+			t.Errorf("expected %q to be rejected", tag)
+		}
+	}
+}
+
+func TestAddNormalizesTags(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	form := url.Values{"title": {"buy milk #Errands"}, "tags": {"Work, work", " side project"}}
+	if w := serve(s, "POST", "/add", form); w.Code != 302 {
+		t.Fatalf("expected 302 adding, got %d", w.Code)
+	}
+	serve(s, "POST", "/add", url.Values{"title": {"walk the dog"}, "tags": {"WORK"}})
+
+	if w := serve(s, "POST", "/add", url.Values{"title": {"x"}, "tags": {"c++"}}); w.Code != 400 {
+		t.Errorf("expected 400 for an invalid tag, got %d", w.Code)
+	}
+
+	w := serve(s, "GET", "/api/tags", nil)
+	if w.Code != 200 {
+		t.Fatalf("expected 200 listing tags, got %d", w.Code)
+	}
+	var res tagsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	expected := []tagCount{{"errands", 1}, {"side-project", 1}, {"work", 2}}
+	if !reflect.DeepEqual(res.Tags, expected) {
+		t.Errorf("expected %v, got %v", expected, res.Tags)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays maps the full and abbreviated names of the days of the week
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseNaturalDay parses a day relative to now such as "today",
+// "tomorrow", "friday", "next monday", "next week" or "in 3 days". A
+// weekday is always the next one after today, so on a Friday "friday" is a
+// week away, and "next" before a weekday changes nothing. It returns false
+// if s is not such a phrase.
+func parseNaturalDay(s string, now time.Time) (time.Time, bool) {
+	fields := strings.Fields(strings.ToLower(s))
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+
+	switch len(fields) {
+	case 1:
+		switch fields[0] {
+		case "today":
+			return today, true
+		case "tomorrow":
+			return today.AddDate(0, 0, 1), true
+		}
+		if wd, ok := weekdays[fields[0]]; ok {
+			return nextWeekday(today, wd), true
+		}
+	case 2:
+		if fields[0] != "next" {
+			break
+		}
+		switch fields[1] {
+		case "week":
+			return today.AddDate(0, 0, 7), true
+		case "month":
+			return today.AddDate(0, 1, 0), true
+		case "year":
+			return today.AddDate(1, 0, 0), true
+		}
+		if wd, ok := weekdays[fields[1]]; ok {
+			return nextWeekday(today, wd), true
+		}
+	case 3:
+		if fields[0] != "in" {
+			break
+		}
+		n, err := strconv.Atoi(fields[1])
+		if fields[1] == "a" || fields[1] == "an" {
+			n, err = 1, nil
+		}
+		if err != nil || n < 0 {
+			break
+		}
+		switch strings.TrimSuffix(fields[2], "s") {
+		case "day":
+			return today.AddDate(0, 0, n), true
+		case "week":
+			return today.AddDate(0, 0, 7*n), true
+		case "month":
+			return today.AddDate(0, n, 0), true
+		case "year":
+			return today.AddDate(n, 0, 0), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// nextWeekday returns the first day after today that is a wd
+func nextWeekday(today time.Time, wd time.Weekday) time.Time {
+	days := (int(wd)-int(today.Weekday())+6)%7 + 1
+	return today.AddDate(0, 0, days)
+}
+
+// parseNaturalDueDate parses a due date given as a day relative to now (see
+// parseNaturalDay), in which case the todo is due by the end of that day,
+// or in any of the formats of parseDueDate
+func parseNaturalDueDate(s string, now time.Time) (time.Time, error) {
+	if day, ok := parseNaturalDay(s, now.In(time.Local)); ok {
+		return day.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+
+	t, err := parseDueDate(strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid due date: %q", s)
+	}
+	return t, nil
+}
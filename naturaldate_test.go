@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNaturalDay(t *testing.T) {
+	// A Wednesday afternoon in Berlin, already Thursday in Tokyo
+	loc := time.FixedZone("CEST", 2*60*60)
+	now := time.Date(2020, time.July, 1, 18, 30, 0, 0, loc)
+
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2020, month, day, 0, 0, 0, 0, loc)
+	}
+
+	for phrase, expected := range map[string]time.Time{
+		"today":         day(time.July, 1),
+		"Tomorrow":      day(time.July, 2),
+		"  tomorrow ":   day(time.July, 2),
+		"friday":        day(time.July, 3),
+		"fri":           day(time.July, 3),
+		"next monday":   day(time.July, 6),
+		"monday":        day(time.July, 6),
+		"tuesday":       day(time.July, 7),
+		"wednesday":     day(time.July, 8),
+		"next week":     day(time.July, 8),
+		"next month":    day(time.August, 1),
+		"in 3 days":     day(time.July, 4),
+		"in 1 day":      day(time.July, 2),
+		"in a week":     day(time.July, 8),
+		"in 2 weeks":    day(time.July, 15),
+		"in 0 days":     day(time.July, 1),
+		"in 6 months":   time.Date(2021, time.January, 1, 0, 0, 0, 0, loc),
+		"in a year":     time.Date(2021, time.July, 1, 0, 0, 0, 0, loc),
+		"NEXT  FRIDAY ": day(time.July, 3),
+	} {
+		got, ok := parseNaturalDay(phrase, now)
+		if !ok {
+			t.Errorf("expected %q to parse", phrase)
+			continue
+		}
+		if !got.Equal(expected) {
+			t.Errorf("expected %q to be %s, got %s", phrase, expected, got)
+		}
+	}
+
+	// The day is resolved in now's timezone
+	tokyo := now.In(time.FixedZone("JST", 9*60*60))
+	if got, _ := parseNaturalDay("tomorrow", tokyo); got.Day() != 3 {
+		t.Errorf("expected tomorrow in Tokyo to be the 3rd, got %s", got)
+	}
+
+	for _, phrase := range []string{
+		"",
+		"someday",
+		"next",
+		"next tomorrow",
+		"in days",
+		"in -2 days",
+		"in 3 fortnights",
+		"last friday",
+		"2020-07-01",
+	} {
+		if _, ok := parseNaturalDay(phrase, now); ok {
+			t.Errorf("expected %q not to parse as a day", phrase)
+		}
+	}
+}
+
+func TestParseNaturalDueDate(t *testing.T) {
+	now := time.Date(2020, time.July, 1, 18, 30, 0, 0, time.Local)
+
+	due, err := parseNaturalDueDate("tomorrow", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2020, time.July, 2, 23, 59, 59, 0, time.Local); !due.Equal(expected) {
+		t.Errorf("expected a todo due tomorrow to be due by the end of the day %s, got %s", expected, due)
+	}
+
+	due, err = parseNaturalDueDate("2020-07-10T09:00:00Z", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2020, time.July, 10, 9, 0, 0, 0, time.UTC); !due.Equal(expected) {
+		t.Errorf("expected %s, got %s", expected, due)
+	}
+
+	if _, err := parseNaturalDueDate("the day after", now); err == nil || !strings.Contains(err.Error(), `"the day after"`) {
+		t.Errorf("expected an error naming the input, got %v", err)
+	}
+}
+
+func TestAddNaturalDueDate(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	s.now = func() time.Time { return time.Date(2020, time.July, 1, 12, 0, 0, 0, time.Local) }
+
+	if w := serve(s, "POST", "/add", url.Values{"title": {"buy milk"}, "due": {"in 3 days"}}); w.Code != 302 {
+		t.Fatalf("expected 302 adding, got %d", w.Code)
+	}
+	todo, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2020, time.July, 4, 23, 59, 59, 0, time.Local); !todo.DueDate.Equal(expected) {
+		t.Errorf("expected the todo to be due %s, got %s", expected, todo.DueDate)
+	}
+
+	w := serve(s, "POST", "/add", url.Values{"title": {"walk the dog"}, "due": {"<soon>"}})
+	if w.Code != 400 {
+		t.Fatalf("expected 400 for an invalid due date, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `invalid due date: "<soon>"`) {
+		t.Errorf("expected the invalid due date to be echoed, got %q", w.Body.String())
+	}
+}
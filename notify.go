@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// eventCreated is sent when a todo is added
+	eventCreated = "created"
+
+	// eventCompleted is sent when a todo is marked as done
+	eventCompleted = "completed"
+
+	// eventDeleted is sent when a todo is deleted
+	eventDeleted = "deleted"
+
+	// eventDue is sent by the reminder scheduler when a todo becomes due
+	eventDue = "due"
+
+	// notifyTimeout bounds how long delivering a notification may take
+	notifyTimeout = 10 * time.Second
+)
+
+// notification describes an event about a todo to be delivered by the
+// configured notifiers
+type notification struct {
+	// Event is what happened to the todo, e.g. "due"
+	Event string
+
+	// Prefix is the key prefix of the todo's owner, empty in single-user
+	// mode
+	Prefix string
+
+	// Actor is who caused the event, the username in multi-user mode or
+	// the client's address otherwise. Empty for scheduled events.
+	Actor string
+
+	Todo *Todo
+}
+
+// Message returns a short human readable description of the notification
+func (n notification) Message() string {
+	return fmt.Sprintf("%s: %s", n.Event, n.Todo.Title)
+}
+
+// notifier delivers notifications, e.g. as web push messages
+type notifier interface {
+	Notify(ctx context.Context, n notification) error
+}
+
+// registeredNotifier is a notifier along with the events it is sent
+type registeredNotifier struct {
+	notifier notifier
+	events   []string
+}
+
+func (rn registeredNotifier) handles(event string) bool {
+	for _, e := range rn.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// addNotifier registers a notifier for the given events
+func (s *server) addNotifier(nf notifier, events ...string) {
+	s.notifiers = append(s.notifiers, registeredNotifier{notifier: nf, events: events})
+}
+
+// notifies reports whether any notifier is registered for the event
+func (s *server) notifies(event string) bool {
+	for _, rn := range s.notifiers {
+		if rn.handles(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// notify delivers the notification with every notifier registered for its
+// event. A failing notifier is logged and does not prevent delivery by the
+// others.
+func (s *server) notify(ctx context.Context, n notification) {
+	for _, rn := range s.notifiers {
+		if !rn.handles(n.Event) {
+			continue
+		}
+		if err := rn.notifier.Notify(ctx, n); err != nil {
+			contextLog(ctx).WithError(err).WithField("event", n.Event).Error("error sending notification")
+		}
+	}
+}
+
+// notifyAsync delivers a notification about the request's todo in the
+// background so the request is never held up by slow notifiers
+func (s *server) notifyAsync(r *http.Request, event string, todo *Todo) {
+	if !s.notifies(event) {
+		return
+	}
+
+	n := notification{
+		Event:  event,
+		Prefix: keyPrefix(r),
+		Actor:  actor(r),
+		Todo:   todo,
+	}
+
+	// Keep the request id for logging but not the request's cancellation
+	ctx := context.WithValue(context.Background(), requestIDContextKey, requestIDFromContext(r.Context()))
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		defer cancel()
+		s.notify(ctx, n)
+	}()
+}
+
+// actor returns who made the request, the username of the logged in user
+// or the client's address
+func actor(r *http.Request) string {
+	if user := userFromRequest(r); user != nil {
+		return user.Username
+	}
+	return clientIP(r)
+}
+
+// clientIP returns the client's address, taken from X-Forwarded-For when
+// present like the access log does
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		return strings.TrimSpace(strings.Split(xff, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// webhookNotifier posts a JSON payload built from each notification to a
+// URL with the given headers, the basis for Slack and other webhook style
+// integrations
+type webhookNotifier struct {
+	url     string
+	header  http.Header
+	client  *http.Client
+	payload func(n notification) (interface{}, error)
+}
+
+func (wn *webhookNotifier) Notify(ctx context.Context, n notification) error {
+	payload, err := wn.payload(n)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, wn.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range wn.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+
+	return nil
+}
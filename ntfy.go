@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ntfyMessage is a message published to ntfy as JSON
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title"`
+	Message  string   `json:"message"`
+	Tags     []string `json:"tags,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+}
+
+// newNtfyNotifier returns a notifier publishing to an ntfy topic given by
+// its URL, e.g. https://ntfy.sh/mytopic, authenticating with the access
+// token if it is set
+func newNtfyNotifier(topicURL, token string) (*webhookNotifier, error) {
+	u, err := url.Parse(topicURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid ntfy topic URL: %q", topicURL)
+	}
+
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	topic := path[i+1:]
+	if topic == "" {
+		return nil, fmt.Errorf("ntfy topic URL has no topic: %q", topicURL)
+	}
+	u.Path = "/" + path[:i+1]
+
+	header := make(http.Header)
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return &webhookNotifier{
+		url:    u.String(),
+		header: header,
+		client: &http.Client{Timeout: notifyTimeout},
+		payload: func(n notification) (interface{}, error) {
+			msg := ntfyMessage{Topic: topic, Title: "todo " + n.Event, Message: n.Todo.Title}
+			if n.Event == eventDue {
+				msg.Tags = []string{"alarm_clock"}
+				msg.Priority = 4
+			}
+			return msg, nil
+		},
+	}, nil
+}
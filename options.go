@@ -0,0 +1,201 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// option is a function that configures optional behaviour of the server
+type option func(*server)
+
+// withAPIKeys sets the API keys accepted on /api/ routes in addition to any
+// keys stored in the database under the keys_ prefix
+func withAPIKeys(keys ...string) option {
+	return func(s *server) {
+		s.apiKeys = append(s.apiKeys, keys...)
+	}
+}
+
+// withMultiUser enables user accounts with todos scoped per user, sessions
+// are signed with secret and expire after expiry
+func withMultiUser(secret string, expiry time.Duration) option {
+	return func(s *server) {
+		s.multiUser = true
+		s.jwtSecret = []byte(secret)
+		s.jwtExpiry = expiry
+	}
+}
+
+// withEncryption encrypts all stored todos with the given codec
+func withEncryption(c *aesCodec) option {
+	return func(s *server) {
+		s.codec = c
+	}
+}
+
+// withGzip configures response compression at the given level, or disables
+// it entirely if enabled is false
+func withGzip(enabled bool, level int) option {
+	return func(s *server) {
+		if !enabled {
+			s.gzip = nil
+			return
+		}
+		s.gzip = newGzipHandler(level)
+	}
+}
+
+// withUndoDepth sets how many actions can be undone, 0 disables undo
+func withUndoDepth(depth int) option {
+	return func(s *server) {
+		s.undo = newUndoStack(depth)
+	}
+}
+
+// withDedupe ignores adds whose title matches an existing incomplete todo
+func withDedupe(dedupe bool) option {
+	return func(s *server) {
+		s.dedupe = dedupe
+	}
+}
+
+// withConfirmClear makes GET /clear/:id render a confirmation page posting
+// to the real delete, so following a link never deletes a todo
+func withConfirmClear(confirm bool) option {
+	return func(s *server) {
+		s.confirmClear = confirm
+	}
+}
+
+// withWebhooks posts created, completed and deleted todos to every URL,
+// signing the payloads with secret if it is set
+func withWebhooks(urls []string, secret string) option {
+	return func(s *server) {
+		s.webhooks = &webhookLog{}
+		for _, url := range urls {
+			s.addNotifier(newWebhook(url, secret, s.webhooks), eventCreated, eventCompleted, eventDeleted)
+		}
+	}
+}
+
+// withPush enables Web Push notifications signed with the given VAPID keys
+func withPush(publicKey, privateKey, subject string) option {
+	return func(s *server) {
+		s.push = newPushNotifier(s.db, publicKey, privateKey, subject)
+		s.addNotifier(s.push, eventDue)
+	}
+}
+
+// withReminders sets how often todos are checked for reminders and how
+// long before its due date a todo's reminder is sent
+func withReminders(interval, window time.Duration) option {
+	return func(s *server) {
+		if interval > 0 {
+			s.reminderInterval = interval
+		}
+		s.reminderWindow = window
+	}
+}
+
+// withTrashRetention sets how long todos are kept in the trash before being
+// purged, 0 keeps them forever
+func withTrashRetention(retention time.Duration) option {
+	return func(s *server) {
+		s.trashRetention = retention
+	}
+}
+
+// withIndexDefaults sets the number of todos shown (0 for all), the sort
+// order and the done filter ("true", "false" or "" for all) of the index
+// when the request does not give them
+func withIndexDefaults(limit int, order sortOrder, done string) option {
+	return func(s *server) {
+		s.indexLimit = limit
+		s.indexSort = order
+		s.indexDone = done
+	}
+}
+
+// withEventLog records every change to todos in the event log
+func withEventLog(el *eventLog) option {
+	return func(s *server) {
+		s.events = el
+	}
+}
+
+// withTimeouts sets the read, write and idle timeouts of the HTTP server,
+// 0 disables a timeout
+func withTimeouts(read, write, idle time.Duration) option {
+	return func(s *server) {
+		s.readTimeout = read
+		s.writeTimeout = write
+		s.idleTimeout = idle
+	}
+}
+
+// withTLS serves HTTPS with the given certificate and key files, plain
+// HTTP if they are empty
+func withTLS(cert, key string) option {
+	return func(s *server) {
+		s.tlsCert = cert
+		s.tlsKey = key
+	}
+}
+
+// withAutocert serves HTTPS with certificates for the given hosts obtained
+// from Let's Encrypt and cached in dir, plain HTTP if there are no hosts
+func withAutocert(hosts []string, dir string) option {
+	return func(s *server) {
+		if len(hosts) == 0 {
+			return
+		}
+		s.autocert = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(hosts...),
+			Cache:      autocert.DirCache(dir),
+		}
+	}
+}
+
+// withMetrics enables the metrics and stats routes, under /admin/ (which
+// requires an API key) if admin is set and /debug/ otherwise
+func withMetrics(enabled, admin bool) option {
+	return func(s *server) {
+		s.metrics = enabled
+		s.metricsAdmin = admin
+	}
+}
+
+// withTrustProxy trusts the X-Forwarded-Host and X-Forwarded-Proto headers
+// of requests, for running behind a reverse proxy
+func withTrustProxy(trust bool) option {
+	return func(s *server) {
+		s.trustProxy = trust
+	}
+}
+
+// withBasePath serves the site under path, e.g. /todo, instead of the root
+func withBasePath(path string) option {
+	return func(s *server) {
+		s.basePath = strings.TrimRight(path, "/")
+	}
+}
+
+// withGraphQL serves GraphQL queries on POST /graphql
+func withGraphQL(enabled bool) option {
+	return func(s *server) {
+		if enabled {
+			s.graphql = graphql.MustParseSchema(graphqlSchema, &graphqlResolver{s: s})
+		}
+	}
+}
+
+// withNotifier sends the given events to a notifier
+func withNotifier(nf notifier, events ...string) option {
+	return func(s *server) {
+		s.addNotifier(nf, events...)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// themeCookie is the name of the cookie holding the light/dark theme
+	themeCookie = "theme"
+
+	// sortCookie is the name of the cookie holding the preferred sort order
+	sortCookie = "sort"
+
+	// hideDoneCookie is the name of the cookie holding whether completed
+	// todos are hidden from the index
+	hideDoneCookie = "hidedone"
+
+	// defaultTheme is used when no theme has been chosen
+	defaultTheme = "light"
+
+	// prefsCookieMaxAge is how long preference cookies are kept
+	prefsCookieMaxAge = 365 * 24 * time.Hour
+)
+
+func validTheme(theme string) bool {
+	return theme == "light" || theme == "dark"
+}
+
+// themeFromRequest returns the theme chosen by the client, defaulting to
+// light when no (or an invalid) theme cookie is present
+func themeFromRequest(r *http.Request) string {
+	cookie, err := r.Cookie(themeCookie)
+	if err != nil || !validTheme(cookie.Value) {
+		return defaultTheme
+	}
+	return cookie.Value
+}
+
+func setPrefCookie(w http.ResponseWriter, name, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(prefsCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *server) ThemeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_prefs_theme")
+
+		theme := r.FormValue("theme")
+		if !validTheme(theme) {
+			http.Error(w, "Bad Request: theme must be light or dark", http.StatusBadRequest)
+			return
+		}
+
+		setPrefCookie(w, themeCookie, theme)
+
+		redirectBack(w, r)
+	}
+}
+
+// SortHandler stores the preferred sort order used when a list is requested
+// without ?sort=. An empty sort clears the preference.
+func (s *server) SortHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_prefs_sort")
+
+		value := r.FormValue("sort")
+		if value == "" {
+			http.SetCookie(w, &http.Cookie{Name: sortCookie, Path: "/", MaxAge: -1})
+			redirectWithoutSort(w, r)
+			return
+		}
+
+		order, err := parseSortOrder(value)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		setPrefCookie(w, sortCookie, order.String())
+
+		redirectWithoutSort(w, r)
+	}
+}
+
+// hideDoneFromRequest returns whether the client chose to hide completed
+// todos, and false for ok if it has not chosen
+func hideDoneFromRequest(r *http.Request) (hide, ok bool) {
+	cookie, err := r.Cookie(hideDoneCookie)
+	if err != nil {
+		return false, false
+	}
+	hide, err = strconv.ParseBool(cookie.Value)
+	return hide, err == nil
+}
+
+// HideDoneHandler stores whether completed todos are hidden when a list is
+// requested without ?done=
+func (s *server) HideDoneHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_prefs_hidedone")
+
+		hide, err := strconv.ParseBool(r.FormValue("hide"))
+		if err != nil {
+			http.Error(w, "Bad Request: hide must be true or false", http.StatusBadRequest)
+			return
+		}
+
+		setPrefCookie(w, hideDoneCookie, strconv.FormatBool(hide))
+
+		back, _ := url.Parse(backURL(r))
+		q := back.Query()
+		q.Del("done")
+		back.RawQuery = q.Encode()
+		http.Redirect(w, r, back.String(), http.StatusFound)
+	}
+}
+
+// redirectWithoutSort redirects back dropping any ?sort= and ?order= so
+// the stored preference takes effect
+func redirectWithoutSort(w http.ResponseWriter, r *http.Request) {
+	back, _ := url.Parse(backURL(r))
+	q := back.Query()
+	q.Del("sort")
+	q.Del("order")
+	back.RawQuery = q.Encode()
+
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
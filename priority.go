@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// priority is how important a todo is. It is stored and returned by the
+// API as its label so clients see "high" rather than a number.
+type priority int
+
+const (
+	priorityNone priority = iota
+	priorityLow
+	priorityMed
+	priorityHigh
+)
+
+// priorityLabels are the labels of the priorities indexed by priority
+var priorityLabels = []string{"none", "low", "med", "high"}
+
+// priorityLabel returns the label of a priority, "none" for unknown ones
+func priorityLabel(p priority) string {
+	if p < 0 || int(p) >= len(priorityLabels) {
+		return priorityLabels[priorityNone]
+	}
+	return priorityLabels[p]
+}
+
+// parsePriority parses a priority given by its label or its number, an
+// empty string being no priority
+func parsePriority(s string) (priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return priorityNone, nil
+	}
+
+	for i, label := range priorityLabels {
+		if s == label {
+			return priority(i), nil
+		}
+	}
+
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(priorityLabels) {
+		return priority(n), nil
+	}
+
+	return priorityNone, fmt.Errorf("invalid priority: %q", s)
+}
+
+func (p priority) String() string {
+	return priorityLabel(p)
+}
+
+func (p priority) MarshalText() ([]byte, error) {
+	return []byte(priorityLabel(p)), nil
+}
+
+func (p *priority) UnmarshalText(text []byte) error {
+	v, err := parsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// priorityTestTodos returns todos with tied priorities and due dates
+func priorityTestTodos() TodoList {
+	return TodoList{
+		{ID: 0, Priority: priorityLow},
+		{ID: 1, Priority: priorityHigh, DueDate: testTime.Add(24 * time.Hour)},
+		{ID: 2, Priority: priorityNone, DueDate: testTime},
+		{ID: 3, Priority: priorityHigh},
+		{ID: 4, Priority: priorityHigh, DueDate: testTime},
+		{ID: 5, Priority: priorityLow},
+		{ID: 6, Priority: priorityHigh, DueDate: testTime},
+		{ID: 7, Priority: priorityMed},
+	}
+}
+
+func TestPrioritySortTieBreaks(t *testing.T) {
+	// Highest priority first, then the earliest due date with todos
+	// without one last, then the lowest ID
+	expected := []uint64{4, 6, 1, 3, 7, 0, 5, 2}
+
+	todoList := priorityTestTodos()
+	sortTodosBy(todoList, sortOrder{key: "priority"})
+	if ids := todoIDs(todoList); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected sort=priority to give %v, got %v", expected, ids)
+	}
+
+	todoList = priorityTestTodos()
+	sort.Sort(todoList)
+	if ids := todoIDs(todoList); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected TodoList.Less to give %v, got %v", expected, ids)
+	}
+
+	// Reversing the order keeps ties in ID order
+	todoList = priorityTestTodos()
+	sortTodosBy(todoList, sortOrder{key: "priority", desc: true})
+	if ids, expected := todoIDs(todoList), []uint64{2, 0, 5, 7, 3, 1, 4, 6}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected sort=-priority to give %v, got %v", expected, ids)
+	}
+}
+
+func TestPriorityLabels(t *testing.T) {
+	for p, expected := range map[priority]string{
+		priorityNone: "none",
+		priorityLow:  "low",
+		priorityMed:  "med",
+		priorityHigh: "high",
+		priority(9):  "none",
+	} {
+		if label := priorityLabel(p); label != expected {
+			t.Errorf("expected %d to be labeled %s, got %s", p, expected, label)
+		}
+	}
+
+	for s, expected := range map[string]priority{
+		"":      priorityNone,
+		"High":  priorityHigh,
+		" med ": priorityMed,
+		"1":     priorityLow,
+	} {
+		p, err := parsePriority(s)
+		if err != nil || p != expected {
+			t.Errorf("expected %q to parse as %s, got %s, %v", s, expected, p, err)
+		}
+	}
+	for _, s := range []string{"urgent", "4", "-1"} {
+		if _, err := parsePriority(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestPriorityJSON(t *testing.T) {
+	data, err := json.Marshal(&Todo{Title: "buy milk", Priority: priorityHigh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Priority":"high"`) {
+		t.Errorf("expected the priority as its label, got %s", data)
+	}
+
+	var todo Todo
+	if err := json.Unmarshal([]byte(`{"Priority":"med"}`), &todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo.Priority != priorityMed {
+		t.Errorf("expected med, got %s", todo.Priority)
+	}
+}
+
+func TestIndexRendersPriority(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	title, priority := "buy milk", "high"
+	u := &todoUpdate{Title: &title, Priority: &priority}
+	if err := u.normalize(s.maxTitleLength); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.createTodo(newFormRequest("POST", "/", nil), "", u); err != nil {
+		t.Fatal(err)
+	}
+
+	if body := serve(s, "GET", "/", nil).Body.String(); !strings.Contains(body, "priority-high") {
+		t.Error("expected the todo to be rendered with its priority")
+	}
+}
+
+func TestIndexSortsByPriorityByDefault(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	for _, tc := range []struct{ title, priority string }{
+		{"walk the dog", "low"},
+		{"buy milk", "high"},
+		{"call mum", ""},
+	} {
+		title, priority := tc.title, tc.priority
+		u := &todoUpdate{Title: &title, Priority: &priority}
+		if err := u.normalize(s.maxTitleLength); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.createTodo(newFormRequest("POST", "/", nil), "", u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := serve(s, "GET", "/", nil).Body.String()
+	milk, dog, mum := strings.Index(body, "buy milk"), strings.Index(body, "walk the dog"), strings.Index(body, "call mum")
+	if milk < 0 || dog < 0 || mum < 0 || !(milk < dog && dog < mum) {
+		t.Errorf("expected the todos in priority order, got them at %d, %d and %d", milk, dog, mum)
+	}
+
+	// ?sort= still overrides the default
+	body = serve(s, "GET", "/?sort=id", nil).Body.String()
+	if strings.Index(body, "walk the dog") > strings.Index(body, "buy milk") {
+		t.Error("expected ?sort=id to list the todos by id")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rcrowley/go-metrics"
+)
+
+// metricsNamespace prefixes the names of all Prometheus metrics
+const metricsNamespace = "todo"
+
+// durationBuckets are the upper bounds in seconds of the buckets of the
+// request duration histograms, those of the Prometheus client libraries
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// histogram counts observations into durationBuckets
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// durations holds a request duration histogram per route
+type durations struct {
+	sync.Mutex
+
+	routes map[string]*histogram
+}
+
+func newDurations() *durations {
+	return &durations{routes: make(map[string]*histogram)}
+}
+
+// Observe records a request to route that took d
+func (ds *durations) Observe(route string, d time.Duration) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	h, ok := ds.routes[route]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		ds.routes[route] = h
+	}
+
+	seconds := d.Seconds()
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// writeTo writes the histograms in the Prometheus text format with
+// cumulative buckets
+func (ds *durations) writeTo(buf *bytes.Buffer) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	name := metricsNamespace + "_request_duration_seconds"
+	fmt.Fprintf(buf, "# HELP %s Time taken to handle requests by route.\n", name)
+	fmt.Fprintf(buf, "# TYPE %s histogram\n", name)
+
+	routes := make([]string, 0, len(ds.routes))
+	for route := range ds.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	for _, route := range routes {
+		h := ds.routes[route]
+
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "%s_bucket{route=%q,le=%q} %d\n", name, route, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket{route=%q,le=\"+Inf\"} %d\n", name, route, h.count)
+		fmt.Fprintf(buf, "%s_sum{route=%q} %g\n", name, route, h.sum)
+		fmt.Fprintf(buf, "%s_count{route=%q} %d\n", name, route, h.count)
+	}
+}
+
+// metricName turns the name of a go-metrics metric into a Prometheus
+// metric name and its labels, if any, e.g. requests{route="/"} into
+// todo_requests and {route="/"}
+func metricName(name string) (string, string) {
+	var labels string
+	if i := strings.IndexByte(name, '{'); i >= 0 {
+		name, labels = name[:i], name[i:]
+	}
+	return metricsNamespace + "_" + invalidMetricChars.ReplaceAllString(name, "_"), labels
+}
+
+// PrometheusHandler serves the counters and gauges, the request duration
+// histograms and the number of open and completed todos in the Prometheus
+// text exposition format
+func (s *server) PrometheusHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		type sample struct {
+			labels string
+			value  int64
+		}
+		var (
+			types   = make(map[string]string)
+			samples = make(map[string][]sample)
+		)
+
+		s.counters.r.Each(func(name string, m interface{}) {
+			metric, labels := metricName(name)
+			switch m := m.(type) {
+			case metrics.Counter:
+				metric += "_total"
+				types[metric] = "counter"
+				samples[metric] = append(samples[metric], sample{labels, m.Count()})
+			case metrics.Gauge:
+				types[metric] = "gauge"
+				samples[metric] = append(samples[metric], sample{labels, m.Value()})
+			}
+		})
+
+		names := make([]string, 0, len(types))
+		for name := range types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var buf bytes.Buffer
+
+		for _, name := range names {
+			fmt.Fprintf(&buf, "# TYPE %s %s\n", name, types[name])
+			list := samples[name]
+			sort.Slice(list, func(i, j int) bool { return list[i].labels < list[j].labels })
+			for _, sample := range list {
+				fmt.Fprintf(&buf, "%s%s %d\n", name, sample.labels, sample.value)
+			}
+		}
+
+		todos := metricsNamespace + "_todos"
+		fmt.Fprintf(&buf, "# HELP %s Number of todos by state.\n", todos)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", todos)
+		fmt.Fprintf(&buf, "%s{state=\"open\"} %d\n", todos, s.counters.Value("todos_pending"))
+		fmt.Fprintf(&buf, "%s{state=\"completed\"} %d\n", todos, s.counters.Value("todos_completed"))
+
+		s.durations.writeTo(&buf)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// forwardedHeaders takes the host and scheme of requests from the
+// X-Forwarded-Host and X-Forwarded-Proto headers set by a reverse proxy so
+// redirects and links use the address clients connected to. It must only
+// be used behind a proxy that sets (or strips) these headers as otherwise
+// clients could spoof them.
+func forwardedHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host := firstForwarded(r.Header.Get("X-Forwarded-Host")); host != "" {
+			r.Host = host
+		}
+
+		switch proto := strings.ToLower(firstForwarded(r.Header.Get("X-Forwarded-Proto"))); proto {
+		case "http", "https":
+			r.URL.Scheme = proto
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// firstForwarded returns the first value of a comma separated forwarding
+// header, which was set by the proxy closest to the client
+func firstForwarded(value string) string {
+	return strings.TrimSpace(strings.Split(value, ",")[0])
+}
+
+// requestScheme returns the scheme the client used for the request
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// originURL returns the scheme and host the client used for the request
+func originURL(r *http.Request) string {
+	return requestScheme(r) + "://" + r.Host
+}
+
+// baseURL returns the scheme, host and base path the client used for the
+// request, for building absolute URLs
+func baseURL(r *http.Request) string {
+	return originURL(r) + basePath(r)
+}
+
+// basePath returns the path the site is served under, or an empty string
+// when it is served from the root
+func basePath(r *http.Request) string {
+	path, _ := r.Context().Value(basePathContextKey).(string)
+	return path
+}
+
+// stripBasePath serves the site under the base path set with -basepath,
+// for a reverse proxy passing on the requests for a path of another site.
+// Requests outside it are not found. The base path is removed from the
+// path and Referer of requests and added to the Location of redirects, so
+// routes and handlers see the same paths as when served from the root.
+func (s *server) stripBasePath(next http.Handler) http.Handler {
+	if s.basePath == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == s.basePath {
+			http.Redirect(w, r, s.basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, s.basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		r2 := r.WithContext(context.WithValue(r.Context(), basePathContextKey, s.basePath))
+		u := *r.URL
+		u.Path = strings.TrimPrefix(r.URL.Path, s.basePath)
+		u.RawPath = strings.TrimPrefix(r.URL.RawPath, s.basePath)
+		r2.URL = &u
+
+		if ref, err := url.Parse(r.Referer()); err == nil && strings.HasPrefix(ref.Path, s.basePath+"/") {
+			ref.Path = strings.TrimPrefix(ref.Path, s.basePath)
+			ref.RawPath = ""
+			r2.Header = r.Header.Clone()
+			r2.Header.Set("Referer", ref.String())
+		}
+
+		next.ServeHTTP(&basePathWriter{ResponseWriter: w, basePath: s.basePath}, r2)
+	})
+}
+
+// basePathWriter adds the base path to the Location of redirects to paths
+// of the site
+type basePathWriter struct {
+	http.ResponseWriter
+	basePath string
+}
+
+func (bw *basePathWriter) WriteHeader(status int) {
+	if loc := bw.Header().Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+		bw.Header().Set("Location", bw.basePath+loc)
+	}
+	bw.ResponseWriter.WriteHeader(status)
+}
+
+func (bw *basePathWriter) Flush() {
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (bw *basePathWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := bw.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response does not implement http.Hijacker")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	rice "github.com/GeertJohan/go.rice"
+	webpush "github.com/SherClockHolmes/webpush-go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxSubscriptionSize bounds the size of a push subscription request body
+const maxSubscriptionSize = 4096
+
+// pushSubscriptionKey returns the key a user's push subscription is stored
+// under, derived from its endpoint so re-subscribing is idempotent
+func pushSubscriptionKey(prefix, endpoint string) []byte {
+	sum := sha256.Sum256([]byte(endpoint))
+	return []byte(fmt.Sprintf("%spush_%s", prefix, hex.EncodeToString(sum[:16])))
+}
+
+// pushNotifier delivers notifications as Web Push messages to all of the
+// todo owner's subscriptions using VAPID
+type pushNotifier struct {
+	db         store
+	publicKey  string
+	privateKey string
+	subject    string
+
+	// client is used to talk to push services, nil uses the default client
+	client webpush.HTTPClient
+}
+
+func newPushNotifier(db store, publicKey, privateKey, subject string) *pushNotifier {
+	return &pushNotifier{
+		db:         db,
+		publicKey:  publicKey,
+		privateKey: privateKey,
+		subject:    subject,
+	}
+}
+
+type pushMessage struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func (p *pushNotifier) Notify(ctx context.Context, n notification) error {
+	message, err := json.Marshal(pushMessage{Title: "todo", Body: n.Message()})
+	if err != nil {
+		return err
+	}
+
+	var keys [][]byte
+	err = p.db.Scan([]byte(n.Prefix+"push_"), func(key []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		var sub webpush.Subscription
+
+		data, err := p.db.Get(key)
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(data, &sub); err != nil {
+			contextLog(ctx).WithError(err).WithField("key", string(key)).Warn("invalid push subscription")
+			continue
+		}
+
+		res, err := webpush.SendNotificationWithContext(ctx, message, &sub, &webpush.Options{
+			HTTPClient:      p.client,
+			Subscriber:      p.subject,
+			VAPIDPublicKey:  p.publicKey,
+			VAPIDPrivateKey: p.privateKey,
+			TTL:             60 * 60,
+		})
+		if err != nil {
+			contextLog(ctx).WithError(err).WithField("key", string(key)).Error("error sending push notification")
+			continue
+		}
+		res.Body.Close()
+
+		// The push service tells us when a subscription has expired or
+		// been revoked by the browser, prune it so we stop sending to it.
+		if res.StatusCode == http.StatusGone || res.StatusCode == http.StatusNotFound {
+			contextLog(ctx).WithField("key", string(key)).Info("pruning expired push subscription")
+			if err := p.db.Delete(key); err != nil {
+				contextLog(ctx).WithError(err).WithField("key", string(key)).Error("error deleting push subscription")
+			}
+		} else if res.StatusCode >= 400 {
+			contextLog(ctx).WithField("status", res.StatusCode).Warn("push service rejected notification")
+		}
+	}
+
+	return nil
+}
+
+func (s *server) PushKeyHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		writeJSON(w, r, http.StatusOK, map[string]string{"publicKey": s.push.publicKey})
+	}
+}
+
+func (s *server) PushSubscribeHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_push_subscribe")
+
+		var sub webpush.Subscription
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxSubscriptionSize)
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+			http.Error(w, "Bad Request: invalid subscription", http.StatusBadRequest)
+			return
+		}
+
+		u, err := url.Parse(sub.Endpoint)
+		if err != nil || u.Scheme != "https" || u.Host == "" || sub.Keys.Auth == "" || sub.Keys.P256dh == "" {
+			http.Error(w, "Bad Request: invalid subscription", http.StatusBadRequest)
+			return
+		}
+
+		data, err := json.Marshal(&sub)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error marshaling push subscription")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		key := pushSubscriptionKey(keyPrefix(r), sub.Endpoint)
+		if err := s.db.Put(key, data); err != nil {
+			requestLog(r).WithError(err).Error("error storing push subscription")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (s *server) ServiceWorkerHandler() httprouter.Handle {
+	box := rice.MustFindBox("static/js")
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		data, err := box.Bytes("sw.js")
+		if err != nil {
+			requestLog(r).WithError(err).Error("error loading service worker")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Browsers check for service worker updates against the HTTP
+		// cache so it must always be revalidated
+		w.Header().Set("Content-Type", "application/javascript")
+		setNoCache(w)
+		w.Write(data)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+)
+
+// testPushService stands in for a browser's push service, answering every
+// push with status
+type testPushService struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	status int
+	pushes []*http.Request
+}
+
+func newTestPushService() *testPushService {
+	ps := &testPushService{status: http.StatusCreated}
+	ps.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+
+		ps.pushes = append(ps.pushes, r)
+		w.WriteHeader(ps.status)
+	}))
+	return ps
+}
+
+// received returns the pushes received so far
+func (ps *testPushService) received() []*http.Request {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return append([]*http.Request(nil), ps.pushes...)
+}
+
+// testSubscription returns a subscription to the push service with the
+// keys a browser would generate
+func testSubscription(t *testing.T, endpoint string) string {
+	_, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf(`{"endpoint":%q,"keys":{"p256dh":%q,"auth":%q}}`,
+		endpoint,
+		base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), x, y)),
+		base64.RawURLEncoding.EncodeToString(auth),
+	)
+}
+
+// addDueTodo adds a todo due at due
+func addDueTodo(t *testing.T, s *server, title string, due time.Time) *Todo {
+	todo := addTestTodo(t, s, title)
+	_, todo, err := s.updateTodoAt(fmt.Sprintf("todo_%d", todo.ID), func(todo *Todo) error {
+		todo.DueDate = due
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+func TestPushSubscribeAndNotify(t *testing.T) {
+	ps := newTestPushService()
+	defer ps.Close()
+
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newMemoryStore()
+	s := newTestServer(t, db, withPush(publicKey, privateKey, "mailto:admin@example.com"))
+	s.push.client = ps.Client()
+
+	sub := testSubscription(t, ps.URL+"/push/1")
+	if w := serveRequest(s, newJSONRequest("POST", "/push/subscribe", sub)); w.Code != 201 {
+		t.Fatalf("expected 201 subscribing, got %d", w.Code)
+	}
+	key := pushSubscriptionKey("", ps.URL+"/push/1")
+	if !db.Has(key) {
+		t.Fatal("expected the subscription to be stored")
+	}
+
+	addDueTodo(t, s, "buy milk", testTime)
+	s.sendReminders(context.Background(), testTime)
+
+	pushes := ps.received()
+	if len(pushes) != 1 {
+		t.Fatalf("expected 1 push, got %d", len(pushes))
+	}
+	if auth := pushes[0].Header.Get("Authorization"); !strings.HasPrefix(auth, "vapid ") {
+		t.Errorf("expected a VAPID authorization, got %q", auth)
+	}
+	if enc := pushes[0].Header.Get("Content-Encoding"); enc != "aes128gcm" {
+		t.Errorf("expected an encrypted payload, got %q", enc)
+	}
+
+	// A reminder is only sent once
+	s.sendReminders(context.Background(), testTime.Add(time.Hour))
+	if n := len(ps.received()); n != 1 {
+		t.Errorf("expected no more pushes, got %d", n)
+	}
+}
+
+func TestPushPrunesExpiredSubscriptions(t *testing.T) {
+	ps := newTestPushService()
+	defer ps.Close()
+	ps.status = http.StatusGone
+
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := newMemoryStore()
+	s := newTestServer(t, db, withPush(publicKey, privateKey, "mailto:admin@example.com"))
+	s.push.client = ps.Client()
+
+	if w := serveRequest(s, newJSONRequest("POST", "/push/subscribe", testSubscription(t, ps.URL+"/push/1"))); w.Code != 201 {
+		t.Fatalf("expected 201 subscribing, got %d", w.Code)
+	}
+
+	addDueTodo(t, s, "buy milk", testTime)
+	s.sendReminders(context.Background(), testTime)
+
+	if db.Has(pushSubscriptionKey("", ps.URL+"/push/1")) {
+		t.Error("expected the expired subscription to be pruned")
+	}
+}
+
+func TestPushSubscribeInvalid(t *testing.T) {
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, newMemoryStore(), withPush(publicKey, privateKey, "mailto:admin@example.com"))
+
+	for _, body := range []string{
+		`garbage`,
+		`{"endpoint":"http://push.example.com/1","keys":{"p256dh":"x","auth":"y"}}`,
+		`{"endpoint":"https://push.example.com/1","keys":{}}`,
+	} {
+		if w := serveRequest(s, newJSONRequest("POST", "/push/subscribe", body)); w.Code != 400 {
+			t.Errorf("expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type quickAddResponse struct {
+	Todo  *Todo    `json:"todo"`
+	Todos TodoList `json:"todos"`
+}
+
+// QuickAddHandler adds a todo from a JSON body like PATCH /api/todos/:id
+// takes (only the title is required) and returns it along with the whole
+// list in the user's sort order, so quick entry clients need only a
+// single request. With dedupe enabled an incomplete todo with the same
+// title is returned instead of adding another.
+func (s *server) QuickAddHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_quickadd")
+
+		prefix := keyPrefix(r)
+
+		var u todoUpdate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&u); err != nil {
+			http.Error(w, "Bad Request: invalid todo", http.StatusBadRequest)
+			return
+		}
+		if u.Title == nil {
+			http.Error(w, "Bad Request: title is required", http.StatusBadRequest)
+			return
+		}
+		u.Done = nil
+		if err := u.normalize(s.maxTitleLength); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		order, err := sortOrderFromRequest(r, s.indexSort)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var todo *Todo
+		if s.dedupe {
+			todo, err = s.findDuplicate(r.Context(), prefix, *u.Title)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error checking for duplicate todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		status := http.StatusOK
+		if todo == nil {
+			todo, err = s.createTodo(r, prefix, &u)
+			if errors.Is(err, errTooManyTodos) {
+				http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				requestLog(r).WithError(err).Error("error adding todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			status = http.StatusCreated
+		}
+
+		todoList, _, err := s.loadTodos(r.Context(), prefix)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		sortTodosBy(todoList, order)
+		if todoList == nil {
+			todoList = TodoList{}
+		}
+
+		writeJSON(w, r, status, quickAddResponse{Todo: todo, Todos: todoList})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// localPath returns the path and query of u if it refers to this site,
+// either as an absolute path or as an absolute URL starting with base (the
+// scheme and host of the site). Anything that could lead elsewhere, such as
+// //host or /\host, is rejected.
+func localPath(u, base string) (string, bool) {
+	if u == "" {
+		return "", false
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", false
+	}
+
+	if parsed.Scheme != "" || parsed.Host != "" {
+		if parsed.Scheme+"://"+parsed.Host != base {
+			return "", false
+		}
+	}
+
+	path := parsed.EscapedPath()
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "", false
+	}
+	if parsed.RawQuery != "" {
+		path += "?" + parsed.RawQuery
+	}
+
+	return path, true
+}
+
+// backURL returns where to send the user after a change: the return_to form
+// field or the Referer if either is a local path, otherwise the index
+func backURL(r *http.Request) string {
+	if path, ok := localPath(r.FormValue("return_to"), ""); ok {
+		return path
+	}
+	if path, ok := localPath(r.Referer(), originURL(r)); ok {
+		return path
+	}
+	return "/"
+}
+
+// redirectBack redirects to the page the user made a change from so the
+// filters and sort of the list they were looking at are kept
+func redirectBack(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, backURL(r), http.StatusFound)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/prologic/bitcask"
+)
+
+const (
+	// redisTimeout bounds how long connecting to and each command sent to
+	// Redis may take
+	redisTimeout = 5 * time.Second
+
+	// redisPoolSize is the number of Redis connections kept open
+	redisPoolSize = 8
+
+	// redisMaxRetries is how often a command failing on a broken
+	// connection, e.g. after Redis restarted, is retried on another
+	redisMaxRetries = 3
+
+	// redisScanCount is the number of keys asked for by each SCAN
+	redisScanCount = 1000
+)
+
+// redisStore is a store kept in Redis so several instances of todo can
+// share their todos
+type redisStore struct {
+	client *redis.Client
+}
+
+// newRedisStore returns a store using the Redis server at addr, checking
+// that it can be reached
+func newRedisStore(addr, password string, db int) (*redisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     password,
+		DB:           db,
+		DialTimeout:  redisTimeout,
+		ReadTimeout:  redisTimeout,
+		WriteTimeout: redisTimeout,
+		PoolSize:     redisPoolSize,
+		MaxRetries:   redisMaxRetries,
+	})
+
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &redisStore{client: client}, nil
+}
+
+func (rs *redisStore) Get(key []byte) ([]byte, error) {
+	value, err := rs.client.Get(string(key)).Bytes()
+	if err == redis.Nil {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (rs *redisStore) Has(key []byte) bool {
+	n, err := rs.client.Exists(string(key)).Result()
+	return err == nil && n > 0
+}
+
+func (rs *redisStore) Put(key, value []byte) error {
+	return rs.client.Set(string(key), value, 0).Err()
+}
+
+func (rs *redisStore) Delete(key []byte) error {
+	return rs.client.Del(string(key)).Err()
+}
+
+// Incr atomically increments the counter at key returning its new value
+func (rs *redisStore) Incr(key []byte) (uint64, error) {
+	n, err := rs.client.Incr(string(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(n), nil
+}
+
+// redisGlobEscaper escapes the characters special to SCAN's MATCH patterns
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// keys returns every key starting with prefix in sorted order using SCAN
+func (rs *redisStore) keys(prefix string) ([]string, error) {
+	var keys []string
+
+	iter := rs.client.Scan(0, redisGlobEscaper.Replace(prefix)+"*", redisScanCount).Iterator()
+	for iter.Next() {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	// SCAN may return a key more than once
+	sort.Strings(keys)
+	unique := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+
+	return unique, nil
+}
+
+func (rs *redisStore) Scan(prefix []byte, f func(key []byte) error) error {
+	keys, err := rs.keys(string(prefix))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := f([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *redisStore) Fold(f func(key []byte) error) error {
+	return rs.Scan(nil, f)
+}
+
+func (rs *redisStore) Close() error {
+	return rs.client.Close()
+}
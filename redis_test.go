@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prologic/bitcask"
+)
+
+func newTestRedisStore(t *testing.T) (*redisStore, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := newRedisStore(mr.Addr(), "", 0)
+	if err != nil {
+		mr.Close()
+		t.Fatal(err)
+	}
+
+	return rs, mr
+}
+
+func TestRedisStoreGetPutDelete(t *testing.T) {
+	rs, mr := newTestRedisStore(t)
+	defer mr.Close()
+	defer rs.Close()
+
+	if _, err := rs.Get([]byte("todo_1")); !errors.Is(err, bitcask.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound for a missing key, got %v", err)
+	}
+	if rs.Has([]byte("todo_1")) {
+		t.Error("expected a missing key not to exist")
+	}
+
+	if err := rs.Put([]byte("todo_1"), []byte(`{"title":"buy milk"}`)); err != nil {
+		t.Fatal(err)
+	}
+	value, err := rs.Get([]byte("todo_1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != `{"title":"buy milk"}` {
+		t.Errorf("expected the stored value, got %q", value)
+	}
+	if !rs.Has([]byte("todo_1")) {
+		t.Error("expected the stored key to exist")
+	}
+
+	if err := rs.Delete([]byte("todo_1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.Get([]byte("todo_1")); !errors.Is(err, bitcask.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound after deleting, got %v", err)
+	}
+}
+
+func TestRedisStoreScan(t *testing.T) {
+	rs, mr := newTestRedisStore(t)
+	defer mr.Close()
+	defer rs.Close()
+
+	for _, key := range []string{"todo_2", "todo_1", "user_alice", "todo*_3", "nextid"} {
+		if err := rs.Put([]byte(key), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var keys []string
+	err := rs.Scan([]byte("todo_"), func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"todo_1", "todo_2"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	keys = nil
+	err = rs.Fold(func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 5 {
+		t.Errorf("expected every key, got %v", keys)
+	}
+}
+
+func TestRedisStoreIncr(t *testing.T) {
+	rs, mr := newTestRedisStore(t)
+	defer mr.Close()
+	defer rs.Close()
+
+	for i := uint64(1); i <= 3; i++ {
+		n, err := rs.Incr([]byte("nextid"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != i {
+			t.Errorf("expected %d, got %d", i, n)
+		}
+	}
+}
+
+func TestRedisStoreRestart(t *testing.T) {
+	rs, mr := newTestRedisStore(t)
+	defer mr.Close()
+	defer rs.Close()
+
+	if err := rs.Put([]byte("todo_1"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pooled connections are broken by the restart
+	mr.Close()
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rs.Get([]byte("todo_1")); err != nil {
+		t.Errorf("expected the first command after a restart to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+type renumberResult struct {
+	Todos      int `json:"todos"`
+	Renumbered int `json:"renumbered"`
+}
+
+// storedTodo is the key of a todo in one of the namespaces todos are kept in
+type storedTodo struct {
+	namespace string
+	id        uint64
+}
+
+// renumberTodos reassigns the todos of every todo list, archived and
+// trashed ones included, contiguous ids from 1 in the order of their
+// current ids and sets each list's nextid to follow them. Todos are moved
+// to their new key before their old key is deleted, and in an order that
+// never moves one onto a todo yet to be moved, so no todo is overwritten
+// and an interrupted renumbering loses nothing (repairIDs fixes nextid on
+// start).
+func (s *server) renumberTodos(ctx context.Context) (renumberResult, error) {
+	var res renumberResult
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+	s.ids.Lock()
+	defer s.ids.Unlock()
+
+	todos := make(map[string][]storedTodo)
+	err := s.db.Fold(func(key []byte) error {
+		m := storedKeyPattern.FindSubmatch(key)
+		if m == nil {
+			return nil
+		}
+		id, err := strconv.ParseUint(string(m[3]), 10, 64)
+		if err != nil {
+			return nil
+		}
+		prefix := string(m[1])
+		todos[prefix] = append(todos[prefix], storedTodo{namespace: string(m[2]) + "_", id: id})
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	for prefix, list := range todos {
+		sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+		res.Todos += len(list)
+
+		// The todos with ids 0, 1, ... up to the first gap move up by one
+		// and the rest down or not at all. The ones moving down go first,
+		// lowest first, then the ones moving up, highest first.
+		up := 0
+		for up < len(list) && list[up].id == uint64(up) {
+			up++
+		}
+		var order []int
+		for i := up; i < len(list); i++ {
+			order = append(order, i)
+		}
+		for i := up - 1; i >= 0; i-- {
+			order = append(order, i)
+		}
+
+		for _, i := range order {
+			st := list[i]
+
+			newID := uint64(i + 1)
+			if newID == st.id {
+				continue
+			}
+
+			key := fmt.Sprintf("%s%s%d", prefix, st.namespace, st.id)
+			todo, err := s.loadTodoAt(key)
+			if err != nil {
+				return res, fmt.Errorf("error loading todo %d: %w", st.id, err)
+			}
+			todo.ID = newID
+
+			if err := s.putTodo(fmt.Sprintf("%s%s%d", prefix, st.namespace, newID), todo); err != nil {
+				return res, err
+			}
+			if err := s.removeTodo(key); err != nil {
+				return res, err
+			}
+
+			contextLog(ctx).WithFields(log.Fields{
+				"prefix": prefix,
+				"was":    st.id,
+				"id":     newID,
+			}).Info("renumbered todo")
+			res.Renumbered++
+		}
+
+		if err := s.writeCounter(prefix+"nextid", uint64(len(list)+1)); err != nil {
+			return res, err
+		}
+
+		// Undo entries refer to todos by their old keys
+		s.undo.Clear(prefix)
+	}
+
+	return res, nil
+}
+
+// RenumberHandler compacts the ids of all todos, see renumberTodos. Ids
+// clients hold on to become invalid, so it must be confirmed with
+// ?confirm=true. Other instances sharing the store must not be adding
+// todos while it runs.
+func (s *server) RenumberHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_admin_renumber")
+
+		if confirm, _ := strconv.ParseBool(r.FormValue("confirm")); !confirm {
+			http.Error(w, "Bad Request: renumbering changes the ids of todos, pass confirm=true", http.StatusBadRequest)
+			return
+		}
+
+		res, err := s.renumberTodos(r.Context())
+		if err != nil {
+			requestLog(r).WithError(err).Error("error renumbering todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		requestLog(r).WithFields(log.Fields{
+			"todos":      res.Todos,
+			"renumbered": res.Renumbered,
+		}).Warn("renumbered todos")
+
+		writeJSON(w, r, http.StatusOK, res)
+	}
+}
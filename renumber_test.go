@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// renumberedTodo is where a todo is expected after renumbering
+type renumberedTodo struct {
+	key   string
+	id    uint64
+	title string
+}
+
+func TestRenumberTodos(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		prepare  func(t *testing.T, s *server)
+		expected []renumberedTodo
+	}{
+		{"contiguous", func(t *testing.T, s *server) {}, []renumberedTodo{
+			{"todo_1", 1, "todo 0"},
+			{"todo_2", 2, "todo 1"},
+			{"todo_3", 3, "todo 2"},
+			{"todo_4", 4, "todo 3"},
+			{"todo_5", 5, "todo 4"},
+		}},
+		{"gaps", func(t *testing.T, s *server) {
+			for _, key := range []string{"todo_1", "todo_3"} {
+				if err := s.removeTodo(key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			archive := func(todo *Todo) error { return nil }
+			if _, _, err := s.moveTodo("", 4, todoNamespace, archiveNamespace, archive); err != nil {
+				t.Fatal(err)
+			}
+		}, []renumberedTodo{
+			{"todo_1", 1, "todo 0"},
+			{"todo_2", 2, "todo 2"},
+			{"archive_3", 3, "todo 4"},
+		}},
+	} {
+		s := newTestServer(t, newMemoryStore())
+		for i := 0; i < 5; i++ {
+			addTestTodo(t, s, fmt.Sprintf("todo %d", i))
+		}
+		tc.prepare(t, s)
+
+		res, err := s.renumberTodos(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Todos != len(tc.expected) {
+			t.Errorf("%s: expected %d todos, got %+v", tc.name, len(tc.expected), res)
+		}
+
+		for _, e := range tc.expected {
+			todo, err := s.loadTodoAt(e.key)
+			if err != nil {
+				t.Errorf("%s: expected a todo at %s: %v", tc.name, e.key, err)
+				continue
+			}
+			if todo.ID != e.id || todo.Title != e.title {
+				t.Errorf("%s: expected %d %q at %s, got %d %q", tc.name, e.id, e.title, e.key, todo.ID, todo.Title)
+			}
+		}
+		if _, err := s.loadTodoAt("todo_0"); err == nil {
+			t.Errorf("%s: expected no todo with id 0", tc.name)
+		}
+
+		// The next todo follows the renumbered ones
+		if todo := addTestTodo(t, s, "next"); todo.ID != uint64(len(tc.expected)+1) {
+			t.Errorf("%s: expected the next todo to get id %d, got %d", tc.name, len(tc.expected)+1, todo.ID)
+		}
+	}
+}
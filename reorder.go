@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// reorderTodos moves the todos with the given ids into that order, keeping
+// the places in the list they take between them so a page or a filtered
+// list can be reordered on its own. Every todo is then given its place in
+// the list as its position. Ids of todos that do not exist are ignored.
+func (s *server) reorderTodos(ctx context.Context, prefix string, ids []uint64) error {
+	todoList, _, err := s.loadTodos(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	sortTodosBy(todoList, sortOrder{key: "position"})
+
+	byID := make(map[uint64]*Todo)
+	for _, todo := range todoList {
+		byID[todo.ID] = todo
+	}
+
+	var reordered TodoList
+	moved := make(map[uint64]bool)
+	for _, id := range ids {
+		if todo, ok := byID[id]; ok && !moved[id] {
+			reordered = append(reordered, todo)
+			moved[id] = true
+		}
+	}
+
+	next := 0
+	for i, todo := range todoList {
+		if moved[todo.ID] {
+			todoList[i] = reordered[next]
+			next++
+		}
+	}
+
+	for i, todo := range todoList {
+		position := i + 1
+		if todo.Position == position {
+			continue
+		}
+		_, _, err := s.updateTodo(prefix, todo.ID, func(todo *Todo) error {
+			todo.Position = position
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReorderHandler arranges the todos by hand, taking their ids in the new
+// order like the bulk API does. Reordering is not recorded for undo.
+func (s *server) ReorderHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_reorder")
+
+		ids, err := readIDs(w, r)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid ids", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.reorderTodos(r.Context(), keyPrefix(r), ids); err != nil {
+			requestLog(r).WithError(err).Error("error reordering todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
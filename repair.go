@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// repairIDs makes sure the next id of every todo list is greater than the
+// id of any of its todos, archived and deleted ones included. An unclean
+// shutdown can leave a stale nextid behind which would make new todos
+// overwrite existing ones.
+func (s *server) repairIDs() error {
+	maxIDs := make(map[string]uint64)
+
+	err := s.db.Fold(func(key []byte) error {
+		m := storedKeyPattern.FindSubmatch(key)
+		if m == nil {
+			return nil
+		}
+
+		id, err := strconv.ParseUint(string(m[3]), 10, 64)
+		if err != nil {
+			return nil
+		}
+
+		prefix := string(m[1])
+		if max, ok := maxIDs[prefix]; !ok || id > max {
+			maxIDs[prefix] = id
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.ids.Lock()
+	defer s.ids.Unlock()
+
+	for prefix, max := range maxIDs {
+		key := prefix + "nextid"
+
+		next, err := s.readCounter(key)
+		if err != nil {
+			log.WithError(err).WithField("key", key).Warn("invalid next id, resetting it")
+		} else if next > max {
+			continue
+		}
+
+		if err := s.writeCounter(key, max+1); err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"key":   key,
+			"was":   next,
+			"fixed": max + 1,
+		}).Warn("repaired stale next id")
+	}
+
+	return nil
+}
+
+// migrateArchived moves todos archived before the archive had a namespace
+// of its own, which were kept on the list with ArchivedAt set, into the
+// archive
+func (s *server) migrateArchived() error {
+	var keys [][]byte
+
+	err := s.db.Fold(func(key []byte) error {
+		if todoKeyPattern.Match(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		var todo Todo
+
+		data, err := s.db.Get(key)
+		if err != nil {
+			continue
+		}
+		if err := s.codec.Unmarshal(data, &todo); err != nil || todo.ArchivedAt.IsZero() {
+			continue
+		}
+
+		m := todoKeyPattern.FindSubmatch(key)
+		archiveKey := fmt.Sprintf("%sarchive_%s", m[1], m[2])
+		if err := s.db.Put([]byte(archiveKey), data); err != nil {
+			return err
+		}
+		if err := s.db.Delete(key); err != nil {
+			return err
+		}
+
+		log.WithField("key", string(key)).Info("moved archived todo to the archive")
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// putTestCounter stores an id counter like writeCounter does
+func putTestCounter(t *testing.T, db store, key string, n uint64) {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	if err := db.Put([]byte(key), buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// putTestTodos stores todos under the given keys
+func putTestTodos(t *testing.T, db store, keys ...string) {
+	for i, key := range keys {
+		data, err := json.Marshal(&Todo{Title: fmt.Sprintf("todo %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put([]byte(key), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRepairIDs(t *testing.T) {
+	db := newMemoryStore()
+
+	putTestTodos(t, db, "todo_0", "todo_4", "trash_9", "user_1_todo_2", "user_1_archive_7", "user_2_todo_3", "user_3_todo_5")
+	putTestCounter(t, db, "nextid", 2)
+	putTestCounter(t, db, "user_1_nextid", 8)
+	if err := db.Put([]byte("user_3_nextid"), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, db)
+
+	for key, expected := range map[string]uint64{
+		// Stale, repaired past the todo in the trash
+		"nextid": 10,
+		// Already past the archived todo, left alone
+		"user_1_nextid": 8,
+		// Missing
+		"user_2_nextid": 4,
+		// Invalid
+		"user_3_nextid": 6,
+	} {
+		next, err := s.readCounter(key)
+		if err != nil {
+			t.Errorf("expected %s to be valid, got %s", key, err)
+			continue
+		}
+		if next != expected {
+			t.Errorf("expected %s to be %d, got %d", key, expected, next)
+		}
+	}
+
+	if todo := addTestTodo(t, s, "new"); todo.ID != 10 {
+		t.Errorf("expected the new todo to get id 10, got %d", todo.ID)
+	}
+	if todo, err := s.loadTodo("", 4); err != nil || todo.Title != "todo 1" {
+		t.Errorf("expected todo 4 not to be overwritten, got %+v, %v", todo, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultReminderInterval is how often the scheduler checks for todos
+	// needing a reminder or due to be purged
+	defaultReminderInterval = time.Minute
+)
+
+// schedules reports whether there is any background work to schedule
+func (s *server) schedules() bool {
+	return s.notifies(eventDue) || s.trashRetention > 0
+}
+
+// runScheduler sends reminders and purges the trash every
+// reminderInterval until ctx is done
+func (s *server) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(s.reminderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := s.now()
+			if s.notifies(eventDue) {
+				s.sendReminders(ctx, now)
+			}
+			if s.trashRetention > 0 {
+				s.purgeTrash(ctx, now)
+			}
+		}
+	}
+}
+
+// sendReminders sends a single "due" notification for every incomplete
+// todo of every user that is due within its RemindBefore (or the
+// reminderWindow if it has none) of now, or is already overdue, and
+// records that it was sent so it is never repeated
+func (s *server) sendReminders(ctx context.Context, now time.Time) {
+	var keys [][]byte
+
+	err := s.db.Fold(func(key []byte) error {
+		if todoKeyPattern.Match(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		contextLog(ctx).WithError(err).Error("error listing todos for reminders")
+		return
+	}
+
+	for _, key := range keys {
+		todo, ok := s.markReminded(ctx, key, now)
+		if !ok {
+			continue
+		}
+
+		prefix := string(key[:strings.Index(string(key), "todo_")])
+		s.notify(ctx, notification{Event: eventDue, Prefix: prefix, Todo: todo})
+	}
+}
+
+// markReminded records that a reminder is being sent for the todo at key
+// and returns it if the todo needs a reminder at now
+func (s *server) markReminded(ctx context.Context, key []byte, now time.Time) (*Todo, bool) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	var todo Todo
+
+	data, err := s.db.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	if err := s.codec.Unmarshal(data, &todo); err != nil {
+		return nil, false
+	}
+
+	if todo.Done || !todo.hasDueDate() || !todo.RemindedAt.IsZero() {
+		return nil, false
+	}
+	window := s.reminderWindow
+	if todo.RemindBefore > 0 {
+		window = todo.RemindBefore
+	}
+	if now.Before(todo.DueDate.Add(-window)) {
+		return nil, false
+	}
+
+	todo.RemindedAt = now
+
+	if err := s.putTodo(string(key), &todo); err != nil {
+		contextLog(ctx).WithError(err).WithField("key", string(key)).Error("error storing todo")
+		return nil, false
+	}
+
+	return &todo, true
+}
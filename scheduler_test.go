@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNotifier records the titles of the todos it is notified about
+type testNotifier struct {
+	sync.Mutex
+
+	titles []string
+}
+
+func (tn *testNotifier) Notify(ctx context.Context, n notification) error {
+	tn.Lock()
+	defer tn.Unlock()
+
+	tn.titles = append(tn.titles, n.Todo.Title)
+	return nil
+}
+
+// notified returns and forgets the titles notified so far in sorted order
+func (tn *testNotifier) notified() []string {
+	tn.Lock()
+	defer tn.Unlock()
+
+	titles := tn.titles
+	tn.titles = nil
+	sort.Strings(titles)
+	return titles
+}
+
+func TestRemindersUseEachTodosOffset(t *testing.T) {
+	tn := &testNotifier{}
+	s := newTestServer(t, newMemoryStore(),
+		withReminders(time.Minute, time.Hour),
+		withNotifier(tn, eventDue),
+	)
+	s.now = func() time.Time { return testTime }
+
+	due := testTime.Add(48 * time.Hour)
+	for _, todo := range []struct{ title, remind string }{
+		{"two days before", "2d"},
+		{"six hours before", "6h"},
+		{"default window", ""},
+		{"90 minutes before", "90m"},
+	} {
+		form := url.Values{"title": {todo.title}, "due": {due.Format(time.RFC3339)}, "remind": {todo.remind}}
+		if w := serve(s, "POST", "/add", form); w.Code != 302 {
+			t.Fatalf("expected 302 adding %q, got %d", todo.title, w.Code)
+		}
+	}
+	addTestTodo(t, s, "no due date")
+
+	for _, step := range []struct {
+		at       time.Duration
+		expected []string
+	}{
+		{0, []string{"two days before"}},
+		{24 * time.Hour, nil},
+		{42 * time.Hour, []string{"six hours before"}},
+		{46*time.Hour + 29*time.Minute, nil},
+		{46*time.Hour + 30*time.Minute, []string{"90 minutes before"}},
+		{47 * time.Hour, []string{"default window"}},
+		// Reminders are never repeated, even once overdue
+		{72 * time.Hour, nil},
+	} {
+		s.sendReminders(context.Background(), testTime.Add(step.at))
+		if titles := tn.notified(); !reflect.DeepEqual(titles, step.expected) {
+			t.Errorf("expected reminders for %q after %s, got %q", step.expected, step.at, titles)
+		}
+	}
+}
+
+func TestRemindersSkipDoneTodos(t *testing.T) {
+	tn := &testNotifier{}
+	s := newTestServer(t, newMemoryStore(), withReminders(time.Minute, time.Hour), withNotifier(tn, eventDue))
+
+	addDueTodo(t, s, "buy milk", testTime)
+	serve(s, "POST", "/done/0", nil)
+
+	s.sendReminders(context.Background(), testTime)
+	if titles := tn.notified(); titles != nil {
+		t.Errorf("expected no reminder for a done todo, got %q", titles)
+	}
+}
+
+func TestInvalidRemind(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	for _, remind := range []string{"soon", "-1h", "2days", "1.5d"} {
+		form := url.Values{"title": {"buy milk"}, "due": {"2020-07-02"}, "remind": {remind}}
+		if w := serve(s, "POST", "/add", form); w.Code != 400 {
+			t.Errorf("expected 400 for remind %q, got %d", remind, w.Code)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// searchTerms splits a search query into lowercased terms
+func searchTerms(q string) [][]rune {
+	var terms [][]rune
+	for _, field := range strings.Fields(q) {
+		terms = append(terms, []rune(strings.ToLower(field)))
+	}
+	return terms
+}
+
+// lowerRunes lowercases s rune by rune so indexes into the result are
+// indexes into []rune(s)
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// indexRunes returns the index of the first occurrence of term in s at or
+// after start, or -1
+func indexRunes(s, term []rune, start int) int {
+	for i := start; i+len(term) <= len(s); i++ {
+		match := true
+		for j, r := range term {
+			if s[i+j] != r {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// atWordStart reports whether index i of s starts a word
+func atWordStart(s []rune, i int) bool {
+	return i == 0 || !(unicode.IsLetter(s[i-1]) || unicode.IsDigit(s[i-1]))
+}
+
+// searchScore scores how well a todo matches all of the terms, 0 if it
+// does not match them all. Matches in the title score higher than matches
+// in the notes and those higher than matches in tags, matches at the start
+// of a word higher than within one and earlier matches higher than later
+// ones.
+func searchScore(todo *Todo, terms [][]rune) int {
+	title := lowerRunes(todo.Title)
+	body := lowerRunes(todo.Body)
+
+	score := 0
+	for _, term := range terms {
+		best := 0
+
+		for i := indexRunes(title, term, 0); i >= 0; i = indexRunes(title, term, i+1) {
+			s := 100
+			if atWordStart(title, i) {
+				s += 50
+			}
+			if i == 0 {
+				s += 25
+			}
+			if i < 20 {
+				s += 20 - i
+			}
+			if s > best {
+				best = s
+			}
+		}
+
+		for i := indexRunes(body, term, 0); i >= 0; i = indexRunes(body, term, i+1) {
+			s := 20
+			if atWordStart(body, i) {
+				s += 5
+			}
+			if s > best {
+				best = s
+			}
+		}
+
+		for _, tag := range todo.Tags {
+			if i := indexRunes([]rune(tag), term, 0); i >= 0 && best < 10 {
+				best = 10
+				if i == 0 {
+					best += 5
+				}
+			}
+		}
+
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+
+	return score
+}
+
+// searchTodos returns the todos matching every term of q ordered by score
+func searchTodos(todoList TodoList, q string) TodoList {
+	terms := searchTerms(q)
+
+	var results TodoList
+	scores := make(map[uint64]int)
+	for _, todo := range todoList {
+		if score := searchScore(todo, terms); score > 0 {
+			scores[todo.ID] = score
+			results = append(results, todo)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := scores[results[i].ID], scores[results[j].ID]
+		if a != b {
+			return a > b
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	return results
+}
+
+// highlight returns s as HTML with every match of the terms of q wrapped
+// in <mark>. All of s is escaped.
+func highlight(s, q string) template.HTML {
+	runes := []rune(s)
+	lower := lowerRunes(s)
+
+	marked := make([]bool, len(runes))
+	for _, term := range searchTerms(q) {
+		for i := indexRunes(lower, term, 0); i >= 0; i = indexRunes(lower, term, i+1) {
+			for j := i; j < i+len(term); j++ {
+				marked[j] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && marked[j] == marked[i] {
+			j++
+		}
+		text := template.HTMLEscapeString(string(runes[i:j]))
+		if marked[i] {
+			b.WriteString("<mark>" + text + "</mark>")
+		} else {
+			b.WriteString(text)
+		}
+		i = j
+	}
+
+	return template.HTML(b.String())
+}
+
+// loadSearch returns the todos matching the request's ?q= and filters,
+// ranked by how well they match
+func (s *server) loadSearch(r *http.Request, filters []todoFilter) (TodoList, int, error) {
+	todoList, skipped, err := s.loadTodos(r.Context(), keyPrefix(r))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return searchTodos(filterTodos(todoList, filters), r.URL.Query().Get("q")), skipped, nil
+}
+
+// SearchHandler shows the todos matching ?q=, best matches first, with the
+// matches highlighted
+func (s *server) SearchHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_search")
+
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, skipped, err := s.loadSearch(r, filters)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := &templateContext{
+			Title:       "search",
+			Search:      q,
+			TodoList:    todoList,
+			Total:       len(todoList),
+			Skipped:     skipped,
+			Colors:      colorPalette,
+			Priorities:  priorityLabels,
+			Query:       r.URL.Query(),
+			SortOptions: sortOptions,
+		}
+
+		s.render("index", w, r, ctx)
+	}
+}
+
+// SearchAPIHandler returns the todos matching ?q=, best matches first
+func (s *server) SearchAPIHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_search")
+
+		if strings.TrimSpace(r.URL.Query().Get("q")) == "" {
+			http.Error(w, "Bad Request: q is required", http.StatusBadRequest)
+			return
+		}
+
+		filters, err := filtersFromRequest(r)
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		todoList, _, err := s.loadSearch(r, filters)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		if todoList == nil {
+			todoList = TodoList{}
+		}
+
+		writeJSON(w, r, http.StatusOK, todosPage{Todos: todoList})
+	}
+}
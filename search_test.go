@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchScoresNotes(t *testing.T) {
+	todoList := TodoList{
+		{ID: 0, Title: "call mum", Tags: []string{"milk"}},
+		{ID: 1, Title: "walk the dog", Body: "and pick up some milk"},
+		{ID: 2, Title: "buy milk"},
+		{ID: 3, Title: "water the plants", Body: "buttermilk for the roses"},
+		{ID: 4, Title: "call dad"},
+	}
+
+	// Title matches rank above matches in the notes, those above tag
+	// matches and matches at the start of a word above ones within one
+	if ids, expected := todoIDs(searchTodos(todoList, "milk")), []uint64{2, 1, 3, 0}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	// Every term must match in the title, notes or tags
+	if ids, expected := todoIDs(searchTodos(todoList, "dog milk")), []uint64{1}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+}
@@ -1,26 +1,32 @@
 package main
 
 import (
-	"encoding/binary"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
 	"net/http"
-	"sort"
+	"net/url"
 	"strconv"
+	"sync"
+	"time"
 
 	rice "github.com/GeertJohan/go.rice"
-	"github.com/NYTimes/gziphandler"
+	graphql "github.com/graph-gophers/graphql-go"
 	"github.com/julienschmidt/httprouter"
 	"github.com/prologic/bitcask"
 	"github.com/rcrowley/go-metrics"
 	"github.com/rcrowley/go-metrics/exp"
 	log "github.com/sirupsen/logrus"
 	"github.com/thoas/stats"
-	"github.com/unrolled/logger"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 type counters struct {
+	sync.Mutex
+
 	r metrics.Registry
 }
 
@@ -47,141 +53,541 @@ func (c *counters) DecBy(name string, n int64) {
 	metrics.GetOrRegisterCounter(name, c.r).Dec(n)
 }
 
+func (c *counters) Set(name string, value int64) {
+	metrics.GetOrRegisterGauge(name, c.r).Update(value)
+}
+
+func (c *counters) Value(name string) int64 {
+	return metrics.GetOrRegisterGauge(name, c.r).Value()
+}
+
+func (c *counters) Adjust(name string, delta int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	g := metrics.GetOrRegisterGauge(name, c.r)
+	g.Update(g.Value() + delta)
+}
+
 type server struct {
+	db             store
+	ids            sync.Mutex
+	adds           sync.Mutex
+	writes         sync.Mutex
+	accounts       sync.Mutex
+	lists          sync.Mutex
+	feeds          sync.Mutex
+	counts         sync.Mutex
 	bind           string
 	templates      *templates
+	assets         *assets
 	router         *httprouter.Router
 	maxItems       int
 	maxTitleLength int
 
-	// Logger
-	logger *logger.Logger
+	// Number of todos on each list by key prefix, see countTodos
+	todoCounts map[string]int
+
+	// Encoding of stored todos
+	codec codec
+
+	// API keys accepted on /api/ routes
+	apiKeys []string
+
+	// Multi-user mode
+	multiUser bool
+	jwtSecret []byte
+	jwtExpiry time.Duration
+
+	// Whether adding a duplicate of an incomplete todo is ignored
+	dedupe bool
+
+	// Recent actions that can be undone
+	undo *undoStack
+
+	// Notifications and due date reminders
+	notifiers        []registeredNotifier
+	push             *pushNotifier
+	webhooks         *webhookLog
+	reminderInterval time.Duration
+	reminderWindow   time.Duration
+	trashRetention   time.Duration
+	now              func() time.Time
+
+	// Ask for confirmation on GET /clear/:id instead of deleting
+	confirmClear bool
+
+	// Log of changes to todos for sync clients, nil if disabled
+	events *eventLog
+
+	// Changes to todos sent to open pages
+	live *broadcaster
+
+	// HTTP server timeouts
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+
+	// Metrics and stats routes, served under /admin/ instead of /debug/
+	// if metricsAdmin is set
+	metrics      bool
+	metricsAdmin bool
+
+	// Trust X-Forwarded-Host and X-Forwarded-Proto from a reverse proxy
+	trustProxy bool
+
+	// Path the site is served under, e.g. /todo, empty for the root
+	basePath string
+
+	// Schema of the GraphQL endpoint, nil unless it is enabled
+	graphql *graphql.Schema
+
+	// Certificate and key files to serve HTTPS with
+	tlsCert string
+	tlsKey  string
+
+	// Obtains certificates from Let's Encrypt instead
+	autocert *autocert.Manager
+
+	// Index defaults
+	indexLimit int
+	indexSort  sortOrder
+	indexDone  string
+
+	// Response compression, nil if disabled
+	gzip func(http.Handler) http.Handler
 
 	// Stats/Metrics
-	counters *counters
-	stats    *stats.Stats
+	counters  *counters
+	durations *durations
+	stats     *stats.Stats
+}
+
+const (
+	// defaultReadTimeout bounds reading a whole request including its body
+	defaultReadTimeout = 10 * time.Second
+
+	// defaultWriteTimeout bounds handling a request and writing the
+	// response
+	defaultWriteTimeout = 30 * time.Second
+
+	// defaultIdleTimeout is how long idle keep-alive connections are kept
+	defaultIdleTimeout = 2 * time.Minute
+
+	// shutdownTimeout is how long requests in flight are given to finish
+	// when shutting down
+	shutdownTimeout = 10 * time.Second
+)
+
+func (s *server) render(name string, w http.ResponseWriter, r *http.Request, ctx *templateContext) {
+	s.renderStatus(name, http.StatusOK, w, r, ctx)
 }
 
-func (s *server) render(name string, w http.ResponseWriter, ctx interface{}) {
+// renderStatus renders the named template like render, responding with the
+// given status once the headers are set
+func (s *server) renderStatus(name string, status int, w http.ResponseWriter, r *http.Request, ctx *templateContext) {
+	ctx.Theme = themeFromRequest(r)
+	ctx.User = userFromRequest(r)
+	ctx.Push = s.push != nil
+	ctx.ConfirmClear = s.confirmClear
+	ctx.SearchBox = !s.multiUser || ctx.User != nil
+	ctx.CSRF = csrfTokenFromRequest(r)
+	ctx.Flash = flashFromRequest(w, r)
+	if ctx.SearchBox {
+		lists, err := s.loadLists(keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing lists")
+		}
+		ctx.Lists = lists
+	}
+
 	buf, err := s.templates.Exec(name, ctx)
 	if err != nil {
-		log.WithError(err).Error("error rending template")
+		requestLog(r).WithError(err).Error("error rending template")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
+	setNoCache(w)
+	w.WriteHeader(status)
+
 	_, err = buf.WriteTo(w)
 	if err != nil {
-		log.WithError(err).Error("error writing response")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		requestLog(r).WithError(err).Error("error writing response")
 	}
 }
 
 type templateContext struct {
-	TodoList []*Todo
+	Title       string
+	Search      string
+	TodoList    []*Todo
+	Total       int
+	Skipped     int
+	Colors      []string
+	Priorities  []string
+	Query       url.Values
+	Limit       int
+	Page        int
+	Pages       int
+	PrevPage    int
+	NextPage    int
+	Done        string
+	Sort        string
+	SortOptions []string
+	Push        bool
+	User        *User
+	Theme       string
+	Error       string
+
+	// Todo and ReturnTo are the todo to confirm deleting and where to go
+	// afterwards
+	Todo     *Todo
+	ReturnTo string
+
+	ConfirmClear bool
+
+	// SearchBox is whether the header shows the search box, which it
+	// does on every page but the login page
+	SearchBox bool
+
+	// Live is whether the list follows changes made elsewhere
+	Live bool
+
+	// CSRF is the token every form must post
+	CSRF string
+
+	// Lists are all lists for the switcher and List the one shown, if any
+	Lists []*List
+	List  *List
+
+	// Flash describes the change just made, which can be undone
+	Flash string
+
+	// Tokens are the user's API tokens and NewToken the one just
+	// generated, shown only once
+	Tokens   []*apiToken
+	NewToken string
+
+	// HiddenDone is the number of completed todos hidden from the list
+	HiddenDone int
+
+	// CalendarURL and FeedURL are the paths of the user's calendar and
+	// activity feeds
+	CalendarURL string
+	FeedURL     string
 }
 
 func (s *server) IndexHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		s.counters.Inc("n_index")
 
-		var todoList TodoList
+		s.renderIndex(w, r, r.URL.Query(), "")
+	}
+}
 
-		err := db.Fold(func(key []byte) error {
-			if string(key) == "nextid" {
-				return nil
-			}
+// TagHandler renders the index showing only the todos tagged with the tag
+// in the path, e.g. /tag/work
+func (s *server) TagHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_tag")
 
-			var todo Todo
+		tags, err := normalizeTags(p.ByName("name"))
+		if err != nil || len(tags) != 1 {
+			http.Error(w, "Bad Request: invalid tag", http.StatusBadRequest)
+			return
+		}
 
-			data, err := db.Get(key)
-			if err != nil {
-				log.WithError(err).WithField("key", string(key)).Error("error getting todo")
-				return err
-			}
+		q := r.URL.Query()
+		q.Set("tag", tags[0])
+		s.renderIndex(w, r, q, "#"+tags[0])
+	}
+}
 
-			err = json.Unmarshal(data, &todo)
-			if err != nil {
-				return err
+// indexPage is the index as returned to scripts asking for JSON
+type indexPage struct {
+	Todos TodoList `json:"todos"`
+	Total int      `json:"total"`
+	Page  int      `json:"page"`
+	Pages int      `json:"pages"`
+}
+
+// renderIndex renders the todo list filtered, sorted and limited by the
+// query q, or returns it as JSON to scripts
+func (s *server) renderIndex(w http.ResponseWriter, r *http.Request, q url.Values, title string) {
+	if _, ok := q["done"]; !ok {
+		if hide, ok := hideDoneFromRequest(r); ok {
+			if hide {
+				q.Set("done", "false")
 			}
-			todoList = append(todoList, &todo)
-			return nil
-		})
+		} else if s.indexDone != "" {
+			q.Set("done", s.indexDone)
+		}
+	}
+
+	filters, err := filtersFromQuery(q)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := sortOrderFromRequest(r, s.indexSort)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := s.indexLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			http.Error(w, "Bad Request: invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var list *List
+	if v := q.Get("list"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
 		if err != nil {
-			log.WithError(err).Error("error listing todos")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Bad Request: invalid list", http.StatusBadRequest)
 			return
 		}
+		list, err = s.loadList(keyPrefix(r), id)
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such list", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).Error("error loading list")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+	}
 
-		sort.Sort(todoList)
+	todoList, skipped, err := s.loadTodos(r.Context(), keyPrefix(r))
+	if err != nil {
+		requestLog(r).WithError(err).Error("error listing todos")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		ctx := &templateContext{
-			TodoList: todoList,
+	// Completed todos hidden by showing only open ones are counted as
+	// those matching every other filter but not the list
+	var hiddenDone int
+	if q.Get("done") == "false" {
+		all := url.Values{}
+		for k, v := range q {
+			all[k] = v
 		}
+		all.Del("done")
+		allFilters, _ := filtersFromQuery(all)
+		hiddenDone = len(filterTodos(todoList, allFilters))
+	}
 
-		s.render("index", w, ctx)
+	todoList = filterTodos(todoList, filters)
+	if q.Get("done") == "false" {
+		hiddenDone -= len(todoList)
+	}
+
+	sortTodosBy(todoList, order)
+	if order.key != "position" {
+		overdueFirst(todoList, s.now())
+	}
+
+	// Pages are limit todos long, the last page is shown for pages past
+	// the end
+	total := len(todoList)
+	page, pages := 1, 1
+	if limit > 0 {
+		pages = (total + limit - 1) / limit
+		if pages < 1 {
+			pages = 1
+		}
+		if v := q.Get("page"); v != "" {
+			page, err = strconv.Atoi(v)
+			if err != nil || page < 1 {
+				http.Error(w, "Bad Request: invalid page", http.StatusBadRequest)
+				return
+			}
+			if page > pages {
+				page = pages
+			}
+		}
+
+		start := (page - 1) * limit
+		end := start + limit
+		if end > total {
+			end = total
+		}
+		todoList = todoList[start:end]
+	}
+
+	if wantsJSON(r) {
+		if todoList == nil {
+			todoList = TodoList{}
+		}
+		writeJSON(w, r, http.StatusOK, indexPage{Todos: todoList, Total: total, Page: page, Pages: pages})
+		return
+	}
+
+	ctx := &templateContext{
+		Title:       title,
+		TodoList:    todoList,
+		Total:       total,
+		Skipped:     skipped,
+		Colors:      colorPalette,
+		Priorities:  priorityLabels,
+		Query:       q,
+		Limit:       limit,
+		Page:        page,
+		Pages:       pages,
+		PrevPage:    page - 1,
+		Done:        q.Get("done"),
+		HiddenDone:  hiddenDone,
+		Sort:        order.String(),
+		SortOptions: sortOptions,
+		Live:        true,
+		List:        list,
+	}
+	if page < pages {
+		ctx.NextPage = page + 1
 	}
+
+	ctx.CalendarURL, err = s.feedURL(r, "/todos.ics")
+	if err != nil {
+		requestLog(r).WithError(err).Warn("error signing calendar feed url")
+	}
+	ctx.FeedURL, err = s.feedURL(r, "/feed.atom")
+	if err != nil {
+		requestLog(r).WithError(err).Warn("error signing activity feed url")
+	}
+
+	s.render("index", w, r, ctx)
 }
 
 func (s *server) AddHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		s.counters.Inc("n_add")
 
-		var nextID uint64
-		rawNextID, err := db.Get([]byte("nextid"))
-		if err != nil {
-			if err != bitcask.ErrKeyNotFound {
-				log.WithError(err).Error("error getting nextid")
+		prefix := keyPrefix(r)
+
+		titleString, hashtags := extractHashtags(r.FormValue("title"))
+		if len(titleString) > s.maxTitleLength {
+			titleString = titleString[:s.maxTitleLength]
+		}
+
+		if s.dedupe || r.FormValue("dedupe") == "true" {
+			existing, err := s.findDuplicate(r.Context(), prefix, titleString)
+			if err != nil {
+				requestLog(r).WithError(err).Error("error checking for duplicate todo")
 				http.Error(w, "Internal Error", http.StatusInternalServerError)
 				return
 			}
-		} else {
-			nextID = binary.BigEndian.Uint64(rawNextID)
+			if existing != nil {
+				requestLog(r).WithField("id", existing.ID).Info("not adding duplicate todo")
+				if wantsJSON(r) {
+					w.Header().Set("ETag", etag(existing))
+					writeJSON(w, r, http.StatusOK, existing)
+					return
+				}
+				redirectBack(w, r)
+				return
+			}
 		}
 
-		if db.Len() > s.maxItems {
-			log.Error("error adding item - max number of items reached")
-			http.Redirect(w, r, "/", http.StatusFound)
+		todo := newTodo(titleString)
+
+		body, err := normalizeBody(r.FormValue("body"))
+		if err != nil {
+			requestLog(r).WithError(err).Warn("invalid body")
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		todo.Body = body
 
-		titleString := r.FormValue("title")
-		if len(titleString) > s.maxTitleLength {
-			titleString = titleString[:s.maxTitleLength]
+		if color := r.FormValue("color"); color != "" {
+			var ok bool
+			if todo.Color, ok = normalizeColor(color); !ok {
+				requestLog(r).WithField("color", color).Warn("invalid color")
+				http.Error(w, "Bad Request: invalid color", http.StatusBadRequest)
+				return
+			}
 		}
 
-		todo := newTodo(titleString)
-		todo.ID = nextID
-
-		data, err := json.Marshal(&todo)
+		tags, err := normalizeTags(append(r.Form["tags"], hashtags...)...)
 		if err != nil {
-			log.WithError(err).Error("error serializing todo")
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			requestLog(r).WithError(err).Warn("invalid tags")
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		todo.Tags = tags
+
+		if due := r.FormValue("due"); due != "" {
+			todo.DueDate, err = parseNaturalDueDate(due, s.now())
+			if err != nil {
+				requestLog(r).WithError(err).WithField("due", due).Warn("invalid due date")
+				http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
-		key := fmt.Sprintf("todo_%d", nextID)
+		if remind := r.FormValue("remind"); remind != "" {
+			todo.RemindBefore, err = parseRemindBefore(remind)
+			if err != nil {
+				requestLog(r).WithError(err).Warn("invalid remind")
+				http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
-		err = db.Put([]byte(key), data)
+		todo.Priority, err = parsePriority(r.FormValue("priority"))
 		if err != nil {
-			log.WithError(err).Error("error storing todo")
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			requestLog(r).WithError(err).Warn("invalid priority")
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		buf := make([]byte, 8)
-		nextID++
-		binary.BigEndian.PutUint64(buf, nextID)
-		err = db.Put([]byte("nextid"), buf)
+		if v := r.FormValue("list"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err == nil {
+				_, err = s.loadList(prefix, id)
+			}
+			if err != nil {
+				requestLog(r).WithError(err).WithField("list", v).Warn("invalid list")
+				http.Error(w, "Bad Request: invalid list", http.StatusBadRequest)
+				return
+			}
+			todo.ListID = id
+		}
+
+		key, err := s.addTodo(prefix, todo)
+		if errors.Is(err, errTooManyTodos) {
+			requestLog(r).Warn("error adding item - max number of items reached")
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
-			log.WithError(err).Error("error storing nextid")
+			requestLog(r).WithError(err).Error("error adding todo")
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
 
-		http.Redirect(w, r, "/", http.StatusFound)
+		s.undo.Push(prefix, undoEntry{key: key})
+		s.notifyAsync(r, eventCreated, todo)
+
+		if wantsJSON(r) {
+			w.Header().Set("Location", fmt.Sprintf("/api/todos/%d", todo.ID))
+			w.Header().Set("ETag", etag(todo))
+			writeJSON(w, r, http.StatusCreated, todo)
+			return
+		}
+
+		redirectBack(w, r)
 	}
 }
 
+// DoneHandler toggles whether a todo is done, or sets it to the state given
+// by done=true or done=false so repeating the request changes nothing
 func (s *server) DoneHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		s.counters.Inc("n_done")
@@ -194,57 +600,96 @@ func (s *server) DoneHandler() httprouter.Handle {
 		}
 
 		if id == "" {
-			log.WithField("id", id).Warn("no id specified to mark as done")
+			requestLog(r).WithField("id", id).Warn("no id specified to mark as done")
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
 
 		i, err := strconv.ParseInt(id, 10, 64)
 		if err != nil {
-			log.WithError(err).Error("error parsing id")
+			requestLog(r).WithError(err).Error("error parsing id")
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
 
-		var todo Todo
-
-		key := fmt.Sprintf("todo_%d", i)
-		data, err := db.Get([]byte(key))
-		if err != nil {
-			log.WithError(err).WithField("key", key).Error("error retriving todo")
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			return
+		var done *bool
+		if v := r.FormValue("done"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "Bad Request: invalid done", http.StatusBadRequest)
+				return
+			}
+			done = &b
 		}
 
-		err = json.Unmarshal(data, &todo)
+		key := fmt.Sprintf("%stodo_%d", keyPrefix(r), i)
+		before, todo, err := s.updateTodo(keyPrefix(r), uint64(i), func(todo *Todo) error {
+			if err := checkRevision(r, todo); err != nil {
+				return err
+			}
+			if done == nil {
+				todo.toggleDone()
+				return nil
+			}
+			if todo.Done == *done {
+				return errUnchanged
+			}
+			todo.setDone(*done)
+			todo.UpdatedAt = time.Now()
+			return nil
+		})
+		unchanged := errors.Is(err, errUnchanged)
+		if unchanged {
+			todo, err = s.loadTodo(keyPrefix(r), uint64(i))
+		}
 		if err != nil {
-			log.WithError(err).WithField("key", key).Error("error unmarshaling todo")
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("key", key).Warn("todo not found")
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, errConflict) {
+				http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+				return
+			}
+			requestLog(r).WithError(err).WithField("key", key).Error("error updating todo")
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
 
-		todo.toggleDone()
-
-		data, err = json.Marshal(&todo)
-		if err != nil {
-			log.WithError(err).WithField("key", key).Error("error marshaling todo")
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
-			return
+		if !unchanged {
+			s.trackTodo(before, todo)
+			s.undo.Push(keyPrefix(r), undoEntry{key: key, before: before})
+			if todo.Done {
+				s.notifyAsync(r, eventCompleted, todo)
+			}
 		}
 
-		err = db.Put([]byte(key), data)
-		if err != nil {
-			log.WithError(err).WithField("key", key).Error("error storing todo")
-			http.Error(w, "Internal Error", http.StatusInternalServerError)
+		if wantsJSON(r) {
+			w.Header().Set("ETag", etag(todo))
+			writeJSON(w, r, http.StatusOK, todo)
 			return
 		}
 
-		http.Redirect(w, r, "/", http.StatusFound)
+		if !unchanged {
+			if todo.Done {
+				s.setFlash(w, "done")
+			} else {
+				s.setFlash(w, "undone")
+			}
+		}
+		redirectBack(w, r)
 	}
 }
 
 func (s *server) ClearHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		// httprouter cannot route /clear/completed alongside /clear/:id
+		if p.ByName("id") == "completed" {
+			s.ClearCompletedHandler()(w, r, p)
+			return
+		}
+
 		s.counters.Inc("n_clear")
 
 		var id string
@@ -255,27 +700,67 @@ func (s *server) ClearHandler() httprouter.Handle {
 		}
 
 		if id == "" {
-			log.WithField("id", id).Warn("no id specified to mark as done")
+			requestLog(r).WithField("id", id).Warn("no id specified to mark as done")
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
 
 		i, err := strconv.ParseInt(id, 10, 64)
 		if err != nil {
-			log.WithError(err).Error("error parsing id")
+			requestLog(r).WithError(err).Error("error parsing id")
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
 
-		key := fmt.Sprintf("todo_%d", i)
-		err = db.Delete([]byte(key))
+		// Following a link only ever asks for confirmation, deleting takes
+		// a form posting the CSRF token. Scripts are given the todo instead.
+		if r.Method == http.MethodGet {
+			todo, err := s.loadTodo(keyPrefix(r), uint64(i))
+			if err != nil {
+				if errors.Is(err, bitcask.ErrKeyNotFound) {
+					http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+					return
+				}
+				requestLog(r).WithError(err).WithField("id", i).Error("error loading todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+
+			if wantsJSON(r) {
+				w.Header().Set("ETag", etag(todo))
+				writeJSON(w, r, http.StatusOK, todo)
+				return
+			}
+
+			s.render("confirm", w, r, &templateContext{Title: "clear", Todo: todo, ReturnTo: backURL(r)})
+			return
+		}
+
+		// Todos are moved to the trash, from where they can be restored
+		// until they are purged
+		todo, err := s.discardTodo(r.Context(), keyPrefix(r), uint64(i))
 		if err != nil {
-			log.WithError(err).WithField("key", key).Error("error deleting todo")
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("id", i).Warn("todo not found")
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("id", i).Error("error deleting todo")
 			http.Error(w, "Internal Error", http.StatusInternalServerError)
 			return
 		}
 
-		http.Redirect(w, r, "/", http.StatusFound)
+		if todo != nil {
+			s.notifyAsync(r, eventDeleted, todo)
+		}
+
+		if wantsJSON(r) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		s.setFlash(w, "trashed")
+		redirectBack(w, r)
 	}
 }
 
@@ -290,74 +775,330 @@ func (s *server) statsHandler() httprouter.Handle {
 	}
 }
 
-func (s *server) listenAndServe() {
-	log.Fatal(
-		http.ListenAndServe(
-			s.bind,
-			s.logger.Handler(
-				s.stats.Handler(
-					gziphandler.GzipHandler(
-						s.router,
+// handler returns the server's routes wrapped in its middleware
+func (s *server) handler() http.Handler {
+	var handler http.Handler = s.router
+	if s.gzip != nil {
+		handler = s.gzip(handler)
+	}
+
+	handler = requestID(
+		withVersion(
+			accessLog(
+				s.stripBasePath(
+					s.stats.Handler(
+						s.apiAuth(
+							s.caldavAuth(
+								s.adminAuth(
+									s.sessionAuth(
+										s.csrfProtect(
+											handler,
+										),
+									),
+								),
+							),
+						),
 					),
 				),
 			),
 		),
 	)
+	if s.trustProxy {
+		handler = forwardedHeaders(handler)
+	}
+
+	return handler
 }
 
-func (s *server) initRoutes() {
-	s.router.Handler("GET", "/debug/metrics", exp.ExpHandler(s.counters.r))
-	s.router.GET("/debug/stats", s.statsHandler())
+// listenAndServe serves requests until ctx is done, then stops accepting
+// connections and waits up to shutdownTimeout for the requests in flight
+// (and the scheduler) to finish so the database can be closed cleanly
+func (s *server) listenAndServe(ctx context.Context) error {
+	var wg sync.WaitGroup
+	if s.schedules() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runScheduler(ctx)
+		}()
+	}
 
-	s.router.ServeFiles(
-		"/css/*filepath",
-		rice.MustFindBox("static/css").HTTPBox(),
-	)
+	srv := &http.Server{
+		Addr:         s.bind,
+		Handler:      s.handler(),
+		ReadTimeout:  s.readTimeout,
+		WriteTimeout: s.writeTimeout,
+		IdleTimeout:  s.idleTimeout,
+	}
+	srv.RegisterOnShutdown(s.live.Close)
+	if s.autocert != nil {
+		// Also answers the tls-alpn-01 challenges of Let's Encrypt
+		srv.TLSConfig = s.autocert.TLSConfig()
+	} else if s.tlsCert != "" {
+		srv.TLSConfig = &tls.Config{}
+	}
+	if srv.TLSConfig != nil {
+		// Only TLS 1.2 and later, the cipher suites Go picks for them are
+		// all secure
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		srv.TLSConfig.CurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256}
+	}
 
-	s.router.ServeFiles(
-		"/icons/*filepath",
-		rice.MustFindBox("static/icons").HTTPBox(),
-	)
+	errs := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errs <- srv.ListenAndServeTLS(s.tlsCert, s.tlsKey)
+			return
+		}
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
 
-	s.router.GET("/", s.IndexHandler())
-	s.router.POST("/add", s.AddHandler())
+	log.Info("shutting down")
 
-	s.router.GET("/done/:id", s.DoneHandler())
-	s.router.POST("/done/:id", s.DoneHandler())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	s.router.GET("/clear/:id", s.ClearHandler())
-	s.router.POST("/clear/:id", s.ClearHandler())
+	err := srv.Shutdown(shutdownCtx)
+	wg.Wait()
+	return err
 }
 
-func newServer(bind string, maxItems int, maxTitleLength int) *server {
+func (s *server) initRoutes() error {
+	s.router.NotFound = s.notFound()
+
+	if s.metrics {
+		prefix := "/debug/"
+		if s.metricsAdmin {
+			prefix = "/admin/"
+		}
+		s.router.Handler("GET", prefix+"metrics", exp.ExpHandler(s.counters.r))
+		s.handle("GET", prefix+"stats", s.statsHandler())
+
+		if s.metricsAdmin {
+			s.router.GET("/admin/prometheus", s.PrometheusHandler())
+		} else {
+			s.router.GET("/metrics", s.PrometheusHandler())
+		}
+	}
+
+	s.handle("GET", "/healthz", s.HealthHandler())
+	s.handle("GET", "/admin/keys", s.KeysHandler())
+	s.handle("POST", "/admin/renumber", s.RenumberHandler())
+	s.handle("POST", "/admin/diff", s.DiffHandler())
+	s.handle("GET", "/admin/webhooks", s.WebhooksHandler())
+
+	for _, dir := range []string{"css", "icons", "js"} {
+		box, err := rice.FindBox("static/" + dir)
+		if err != nil {
+			return fmt.Errorf("error finding static/%s: %w", dir, err)
+		}
+		s.handle("GET", "/"+dir+"/*filepath", s.assets.Handler("/"+dir+"/", box))
+	}
+
+	if s.multiUser {
+		s.handle("GET", "/login", s.LoginHandler())
+		s.handle("POST", "/login", s.LoginHandler())
+		s.handle("POST", "/register", s.RegisterHandler())
+		s.handle("POST", "/logout", s.LogoutHandler())
+		s.handle("GET", "/settings", s.SettingsHandler())
+		s.handle("POST", "/settings/tokens", s.CreateTokenHandler())
+		s.handle("POST", "/settings/tokens/:id/revoke", s.RevokeTokenHandler())
+	}
+
+	s.handle("POST", "/prefs/theme", s.ThemeHandler())
+	s.handle("POST", "/prefs/sort", s.SortHandler())
+	s.handle("POST", "/prefs/hidedone", s.HideDoneHandler())
+	s.handle("POST", "/reorder", s.ReorderHandler())
+
+	s.handle("GET", "/", s.IndexHandler())
+	s.handle("POST", "/add", s.AddHandler())
+	s.handle("GET", "/today", s.TodayHandler())
+	s.handle("GET", "/todos.ics", s.CalendarHandler())
+	s.handle("GET", "/feed.atom", s.AtomHandler())
+	if s.graphql != nil {
+		s.handle("POST", graphqlPath, s.GraphQLHandler())
+	}
+
+	s.handle("GET", "/.well-known/caldav", s.CalDAVWellKnownHandler())
+	s.handle("PROPFIND", "/.well-known/caldav", s.CalDAVWellKnownHandler())
+	for _, path := range []string{caldavPath, caldavCalendarPath, caldavCalendarPath + ":name"} {
+		s.handle("OPTIONS", path, s.CalDAVOptionsHandler())
+		s.handle("PROPFIND", path, s.CalDAVPropfindHandler())
+	}
+	s.handle("REPORT", caldavCalendarPath, s.CalDAVReportHandler())
+	s.handle("GET", caldavCalendarPath+":name", s.CalDAVGetHandler())
+	s.handle("PUT", caldavCalendarPath+":name", s.CalDAVPutHandler())
+	s.handle("DELETE", caldavCalendarPath+":name", s.CalDAVDeleteHandler())
+	s.handle("GET", "/tag/:name", s.TagHandler())
+	s.handle("GET", "/list/:name", s.ListHandler())
+	s.handle("POST", "/lists", s.NewListHandler())
+	s.handle("GET", "/search", s.SearchHandler())
+
+	s.handle("POST", "/done/:id", s.DoneHandler())
+	s.handle("POST", "/bulk", s.BulkHandler())
+
+	s.handle("GET", "/clear/:id", s.ClearHandler())
+	s.handle("POST", "/clear/:id", s.ClearHandler())
+
+	s.handle("GET", "/edit/:id", s.EditHandler())
+	s.handle("POST", "/edit/:id", s.EditHandler())
+
+	s.handle("GET", "/archive", s.ArchiveListHandler())
+	s.handle("GET", "/trash", s.TrashListHandler())
+	s.handle("POST", "/trash/:id/restore", s.TrashRestoreHandler())
+	s.handle("POST", "/trash/:id/delete", s.TrashDeleteHandler())
+	s.handle("POST", "/archive/:id", s.ArchiveHandler())
+	s.handle("POST", "/archive/:id/delete", s.ArchiveDeleteHandler())
+	s.handle("POST", "/restore/:id", s.RestoreHandler())
+
+	s.handle("POST", "/undo", s.UndoHandler())
+
+	s.handle("GET", "/live", s.LiveHandler())
+
+	if s.push != nil {
+		// The service worker must be served from the root to control
+		// the whole site
+		s.handle("GET", "/sw.js", s.ServiceWorkerHandler())
+		s.handle("GET", "/push/key", s.PushKeyHandler())
+		s.handle("POST", "/push/subscribe", s.PushSubscribeHandler())
+	}
+
+	s.handle("GET", "/export", s.ExportHandler())
+	s.handle("POST", "/import", s.ImportHandler())
+	s.handle("GET", "/export.opml", s.ExportOPMLHandler())
+	s.handle("GET", "/export.csv", s.ExportCSVHandler())
+	s.handle("POST", "/import.csv", s.ImportCSVHandler())
+
+	s.handle("GET", "/api/count", s.CountHandler())
+	s.handle("GET", "/api/analytics", s.AnalyticsHandler())
+	s.handle("POST", "/api/quickadd", s.QuickAddHandler())
+	s.handle("GET", "/api/events/since", s.EventsHandler())
+	s.handle("GET", "/api/today", s.TodayAPIHandler())
+	s.handle("GET", "/api/search", s.SearchAPIHandler())
+	s.handle("GET", "/api/tags", s.TagsHandler())
+	s.handle("GET", "/api/lists", s.ListsHandler())
+	s.handle("POST", "/api/lists", s.CreateListHandler())
+	s.handle("PATCH", "/api/lists/:id", s.RenameListHandler())
+	s.handle("DELETE", "/api/lists/:id", s.DeleteListHandler())
+	s.handle("POST", "/api/tags/add", s.BulkTagHandler(true))
+	s.handle("POST", "/api/tags/remove", s.BulkTagHandler(false))
+
+	// The todos resource is served both unversioned and as v1
+	for _, prefix := range []string{"/api", "/api/v1"} {
+		s.handle("GET", prefix+"/todos", s.ListTodosHandler())
+		s.handle("POST", prefix+"/todos", s.CreateTodoHandler())
+		s.handle("GET", prefix+"/todos/:id", s.GetTodoHandler())
+		s.handle("PUT", prefix+"/todos/:id", s.UpdateTodoHandler())
+		s.handle("PATCH", prefix+"/todos/:id", s.UpdateTodoHandler())
+		s.handle("DELETE", prefix+"/todos/:id", s.DeleteTodoHandler())
+		s.handle("DELETE", prefix+"/todos", s.BulkDeleteHandler())
+		s.handle("POST", prefix+"/todos/delete", s.BulkDeleteHandler())
+		s.handle("POST", prefix+"/todos/merge", s.MergeHandler())
+		s.handle("POST", prefix+"/todos/bulk", s.BulkAPIHandler())
+	}
+
+	return nil
+}
+
+func newServer(db store, bind string, maxItems int, maxTitleLength int, opts ...option) (*server, error) {
 	server := &server{
+		db:             db,
 		bind:           bind,
 		router:         httprouter.New(),
 		templates:      newTemplates("base"),
+		assets:         newAssets(),
 		maxItems:       maxItems,
+		todoCounts:     make(map[string]int),
 		maxTitleLength: maxTitleLength,
-
-		// Logger
-		logger: logger.New(logger.Options{
-			Prefix:               "todo",
-			RemoteAddressHeaders: []string{"X-Forwarded-For"},
-		}),
+		codec:          jsonCodec{},
+		gzip:           newGzipHandler(gzip.DefaultCompression),
+		undo:           newUndoStack(defaultUndoDepth),
+		live:           newBroadcaster(),
+		metrics:        true,
+		readTimeout:    defaultReadTimeout,
+		writeTimeout:   defaultWriteTimeout,
+		idleTimeout:    defaultIdleTimeout,
+
+		// Notifications
+		reminderInterval: defaultReminderInterval,
+		now:              time.Now,
+		indexSort:        sortOrder{key: defaultSort},
 
 		// Stats/Metrics
-		counters: newCounters(),
-		stats:    stats.New(),
+		counters:  newCounters(),
+		durations: newDurations(),
+		stats:     stats.New(),
 	}
 
 	// Templates
-	box := rice.MustFindBox("templates")
-
-	indexTemplate := template.New("index")
-	template.Must(indexTemplate.Parse(box.MustString("index.html")))
-	template.Must(indexTemplate.Parse(box.MustString("base.html")))
+	box, err := rice.FindBox("templates")
+	if err != nil {
+		return nil, fmt.Errorf("error finding templates: %w", err)
+	}
+	funcs := server.templateFuncs()
 
+	indexTemplate, err := parseTemplate(box, "index", funcs, "index.html", "base.html")
+	if err != nil {
+		return nil, err
+	}
 	server.templates.Add("index", indexTemplate)
 
-	server.initRoutes()
+	loginTemplate, err := parseTemplate(box, "login", funcs, "login.html", "base.html")
+	if err != nil {
+		return nil, err
+	}
+	server.templates.Add("login", loginTemplate)
+
+	confirmTemplate, err := parseTemplate(box, "confirm", funcs, "confirm.html", "base.html")
+	if err != nil {
+		return nil, err
+	}
+	server.templates.Add("confirm", confirmTemplate)
+
+	editTemplate, err := parseTemplate(box, "edit", funcs, "edit.html", "base.html")
+	if err != nil {
+		return nil, err
+	}
+	server.templates.Add("edit", editTemplate)
+
+	archiveTemplate, err := parseTemplate(box, "archive", funcs, "archive.html", "base.html")
+	if err != nil {
+		return nil, err
+	}
+	server.templates.Add("archive", archiveTemplate)
+
+	trashTemplate, err := parseTemplate(box, "trash", funcs, "trash.html", "base.html")
+	if err != nil {
+		return nil, err
+	}
+	server.templates.Add("trash", trashTemplate)
+
+	settingsTemplate, err := parseTemplate(box, "settings", funcs, "settings.html", "base.html")
+	if err != nil {
+		return nil, err
+	}
+	server.templates.Add("settings", settingsTemplate)
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	if err := server.initRoutes(); err != nil {
+		return nil, err
+	}
+	if err := server.migrateArchived(); err != nil {
+		return nil, fmt.Errorf("error migrating archived todos: %w", err)
+	}
+	if err := server.repairIDs(); err != nil {
+		return nil, fmt.Errorf("error checking ids: %w", err)
+	}
+	server.initGauges()
 
-	return server
+	return server, nil
 }
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTime is a fixed time for tests to start from
+var testTime = time.Date(2020, time.July, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestServer returns a server storing its todos in db
+func newTestServer(t *testing.T, db store, opts ...option) *server {
+	s, err := newServer(db, "127.0.0.1:0", 0, 100, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// todoGauges returns the number of todos on the list as tracked by the
+// pending/completed gauges
+func todoGauges(s *server) int64 {
+	return s.counters.Value("todos_pending") + s.counters.Value("todos_completed")
+}
+
+// addTestTodo adds a todo with the given title to the list
+func addTestTodo(t *testing.T, s *server, title string) *Todo {
+	todo, err := s.createTodo(httptest.NewRequest("POST", "/", nil), "", &todoUpdate{Title: &title})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return todo
+}
+
+// newFormRequest returns a request to target, posting form if it is not nil
+func newFormRequest(method, target string, form url.Values) *http.Request {
+	if form == nil {
+		return httptest.NewRequest(method, target, nil)
+	}
+
+	r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// newJSONRequest returns a request to target sending body as JSON
+func newJSONRequest(method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+// serve sends a request to the server's routes, posting form if it is not
+// nil
+func serve(s *server, method, target string, form url.Values) *httptest.ResponseRecorder {
+	return serveRequest(s, newFormRequest(method, target, form))
+}
+
+// serveRequest sends r to the server's routes
+func serveRequest(s *server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestIndexSkipsCorruptedRecords(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+	addTestTodo(t, s, "walk the dog")
+	if err := db.Put([]byte("todo_5"), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"/", "/search?q=milk"} {
+		w := serve(s, "GET", target, nil)
+		if w.Code != 200 {
+			t.Fatalf("expected 200 for %s, got %d", target, w.Code)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, "buy") {
+			t.Errorf("expected %s to list the other todos", target)
+		}
+		if !strings.Contains(body, "1 records skipped due to corruption") {
+			t.Errorf("expected %s to warn about the skipped record", target)
+		}
+	}
+
+	todoList, skipped, err := s.loadTodos(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todoList) != 2 || skipped != 1 {
+		t.Errorf("expected 2 todos and 1 skipped, got %d and %d", len(todoList), skipped)
+	}
+}
+
+func TestMissingTodoNotFound(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	addTestTodo(t, s, "buy milk")
+
+	for _, tc := range []struct {
+		method, target string
+		form           url.Values
+		json           string
+	}{
+		{"POST", "/done/7", nil, ""},
+		{"GET", "/clear/7", nil, ""},
+		{"POST", "/clear/7", nil, ""},
+		{"GET", "/edit/7", nil, ""},
+		{"POST", "/edit/7", url.Values{"title": {"walk the dog"}}, ""},
+		{"POST", "/archive/7", nil, ""},
+		{"POST", "/archive/7/delete", nil, ""},
+		{"POST", "/restore/7", nil, ""},
+		{"POST", "/trash/7/restore", nil, ""},
+		{"POST", "/trash/7/delete", nil, ""},
+		{"GET", "/api/todos/7", nil, ""},
+		{"PUT", "/api/todos/7", nil, `{"title":"walk the dog"}`},
+		{"PATCH", "/api/todos/7", nil, `{"title":"walk the dog"}`},
+		{"DELETE", "/api/todos/7", nil, ""},
+	} {
+		r := newFormRequest(tc.method, tc.target, tc.form)
+		if tc.json != "" {
+			r = newJSONRequest(tc.method, tc.target, tc.json)
+		}
+		r.Header.Set("If-Match", `"1"`)
+		if w := serveRequest(s, r); w.Code != 404 {
+			t.Errorf("expected 404 for %s %s, got %d", tc.method, tc.target, w.Code)
+		}
+	}
+
+	if w := serve(s, "POST", "/done/0", nil); w.Code != 302 {
+		t.Errorf("expected 302 for an existing todo, got %d", w.Code)
+	}
+}
+
+// isDone reports whether the todo with the given id is done
+func isDone(t *testing.T, s *server, id uint64) bool {
+	todo, err := s.loadTodo("", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return todo.Done
+}
+
+func TestDoneToggles(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	addTestTodo(t, s, "buy milk")
+
+	for _, expected := range []bool{true, false, true} {
+		if w := serve(s, "POST", "/done/0", nil); w.Code != 302 {
+			t.Fatalf("expected 302 toggling, got %d", w.Code)
+		}
+		if done := isDone(t, s, 0); done != expected {
+			t.Errorf("expected done to be toggled to %t, got %t", expected, done)
+		}
+	}
+}
+
+func TestDoneSetsExplicitState(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	addTestTodo(t, s, "buy milk")
+
+	for _, done := range []string{"true", "true", "false", "false", "true"} {
+		if w := serve(s, "POST", "/done/0", url.Values{"done": {done}}); w.Code != 302 {
+			t.Fatalf("expected 302 setting done=%s, got %d", done, w.Code)
+		}
+		if isDone(t, s, 0) != (done == "true") {
+			t.Errorf("expected done to be %s", done)
+		}
+	}
+
+	// Repeating a request changes nothing, not even the revision
+	before, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFormRequest("POST", "/done/0", url.Values{"done": {"true"}})
+	r.Header.Set("Accept", "application/json")
+	if w := serveRequest(s, r); w.Code != 200 {
+		t.Fatalf("expected 200 repeating done=true, got %d", w.Code)
+	}
+	after, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Rev != before.Rev || !after.CompletedAt.Equal(before.CompletedAt) {
+		t.Errorf("expected a repeated request to leave the todo unchanged, got %+v", after)
+	}
+
+	if w := serve(s, "POST", "/done/0", url.Values{"done": {"maybe"}}); w.Code != 400 {
+		t.Errorf("expected 400 for an invalid done, got %d", w.Code)
+	}
+}
+
+func TestMaxTodos(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	s.maxItems = 3
+
+	// Concurrent adds cannot take the list over the limit
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = make(map[int]int)
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := serve(s, "POST", "/add", url.Values{"title": {"buy milk"}})
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[302] != 3 || codes[403] != 7 {
+		t.Errorf("expected 3 todos added and 7 refused, got %v", codes)
+	}
+	if n := s.countTodos(""); n != 3 {
+		t.Errorf("expected 3 todos on the list, got %d", n)
+	}
+
+	// Each user has a limit of their own
+	for i := 0; i < 3; i++ {
+		if _, err := s.addTodo("user_1_", newTodo("walk the dog")); err != nil {
+			t.Fatalf("expected another user to add todos, got %v", err)
+		}
+	}
+	if _, err := s.addTodo("user_1_", newTodo("walk the dog")); err != errTooManyTodos {
+		t.Errorf("expected errTooManyTodos, got %v", err)
+	}
+
+	res := importTodos(t, s, "/import", "application/json", `[{"Title":"call mum"}]`)
+	if res.Imported != 0 || len(res.Errors) != 1 || res.Errors[0].Error != errTooManyTodos.Error() {
+		t.Errorf("expected the import to be refused, got %+v", res)
+	}
+
+	// Removing a todo makes room for another
+	if _, err := s.discardTodo(context.Background(), "user_1_", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.addTodo("user_1_", newTodo("walk the dog")); err != nil {
+		t.Errorf("expected a todo to be added after one was removed, got %v", err)
+	}
+
+	// The counts are taken from the existing todos on startup
+	s = newTestServer(t, s.db)
+	if n := s.countTodos(""); n != 3 {
+		t.Errorf("expected 3 todos counted on startup, got %d", n)
+	}
+	if n := s.countTodos("user_1_"); n != 3 {
+		t.Errorf("expected 3 todos counted for the user on startup, got %d", n)
+	}
+}
+
+func TestAutocertHosts(t *testing.T) {
+	if s := newTestServer(t, newMemoryStore(), withAutocert(nil, t.Name())); s.autocert != nil {
+		t.Error("expected plain HTTP without hosts")
+	}
+
+	s := newTestServer(t, newMemoryStore(), withAutocert([]string{"todo.example.com"}, t.Name()))
+	if s.autocert == nil {
+		t.Fatal("expected certificates from Let's Encrypt")
+	}
+	if err := s.autocert.HostPolicy(context.Background(), "todo.example.com"); err != nil {
+		t.Errorf("expected a certificate for the host, got %v", err)
+	}
+	if err := s.autocert.HostPolicy(context.Background(), "evil.example.com"); err == nil {
+		t.Error("expected no certificate for other hosts")
+	}
+}
+
+func TestIndexInvalidList(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+
+	if w := serve(s, "GET", "/?list=abc", nil); w.Code != 400 {
+		t.Errorf("expected 400 for an invalid list, got %d", w.Code)
+	}
+	if w := serve(s, "GET", "/?list=0", nil); w.Code != 404 {
+		t.Errorf("expected 404 for a missing list, got %d", w.Code)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	s := newTestServer(t, newMemoryStore(), withBasePath("/todo/"))
+	h := s.handler()
+
+	send := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send(httptest.NewRequest("GET", "/todo", nil))
+	if w.Code != 301 || w.Header().Get("Location") != "/todo/" {
+		t.Errorf("expected a redirect to /todo/, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := send(httptest.NewRequest("GET", "/healthz", nil)); w.Code != 404 {
+		t.Errorf("expected 404 outside the base path, got %d", w.Code)
+	}
+
+	w = send(httptest.NewRequest("GET", "/todo/", nil))
+	if w.Code != 200 {
+		t.Fatalf("expected 200 for the index, got %d", w.Code)
+	}
+	for _, link := range []string{`action="/todo/add"`, `href="/todo/css/todo.css?v=`, `<meta name="base-path" content="/todo" />`} {
+		if !strings.Contains(w.Body.String(), link) {
+			t.Errorf("expected the index to contain %s", link)
+		}
+	}
+
+	r := newFormRequest("POST", "/todo/add", url.Values{"title": {"buy milk"}})
+	r.Header.Set("Referer", "http://example.com/todo/today")
+	if w := send(r); w.Code != 302 || w.Header().Get("Location") != "/todo/today" {
+		t.Errorf("expected a redirect back to /todo/today, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := send(newFormRequest("POST", "/todo/add", url.Values{"title": {"walk the dog"}})); w.Header().Get("Location") != "/todo/" {
+		t.Errorf("expected a redirect to /todo/, got %q", w.Header().Get("Location"))
+	}
+	if n := todoGauges(s); n != 2 {
+		t.Errorf("expected 2 todos added, got %d", n)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"text/template"
+)
+
+// defaultSlackTemplate is the default message posted to Slack, it is
+// executed with the notification
+const defaultSlackTemplate = `{{ if eq .Event "completed" }}:white_check_mark:{{ else }}:memo:{{ end }} ` +
+	`*{{ .Todo.Title }}* {{ .Event }}{{ if .Actor }} by {{ .Actor }}{{ end }}`
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// newSlackNotifier returns a notifier posting messages rendered with the
+// given template to a Slack incoming webhook
+func newSlackNotifier(url, text string) (*webhookNotifier, error) {
+	tmpl, err := template.New("slack").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: notifyTimeout},
+		payload: func(n notification) (interface{}, error) {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, n); err != nil {
+				return nil, err
+			}
+			return slackMessage{Text: buf.String()}, nil
+		},
+	}, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestSlack stands in for a Slack incoming webhook, sending the text of
+// every message posted to it on the returned channel
+func newTestSlack(t *testing.T) (*httptest.Server, <-chan string) {
+	messages := make(chan string, 10)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("expected a JSON message: %s", err)
+		}
+		messages <- msg.Text
+	}))
+
+	return ts, messages
+}
+
+// nextMessage waits for the next message posted to Slack
+func nextMessage(t *testing.T, messages <-chan string) string {
+	select {
+	case text := <-messages:
+		return text
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a message to be posted to Slack")
+		return ""
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	ts, messages := newTestSlack(t)
+	defer ts.Close()
+
+	slack, err := newSlackNotifier(ts.URL, defaultSlackTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, newMemoryStore(), withNotifier(slack, eventCreated, eventCompleted))
+
+	if w := serve(s, "POST", "/add", url.Values{"title": {"buy milk"}}); w.Code != 302 {
+		t.Fatalf("expected 302 adding, got %d", w.Code)
+	}
+	if text, expected := nextMessage(t, messages), ":memo: *buy milk* created by 192.0.2.1"; text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+
+	if w := serve(s, "POST", "/done/0", nil); w.Code != 302 {
+		t.Fatalf("expected 302 marking done, got %d", w.Code)
+	}
+	if text, expected := nextMessage(t, messages), ":white_check_mark: *buy milk* completed by 192.0.2.1"; text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+
+	// Deleting is not posted
+	serve(s, "POST", "/clear/0", nil)
+	select {
+	case text := <-messages:
+		t.Errorf("expected no message for a delete, got %q", text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSlackTemplate(t *testing.T) {
+	ts, messages := newTestSlack(t)
+	defer ts.Close()
+
+	slack, err := newSlackNotifier(ts.URL, `{{ .Actor }} {{ .Event }} {{ .Todo.Title }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, newMemoryStore(), withNotifier(slack, eventCreated))
+
+	r := newFormRequest("POST", "/add", url.Values{"title": {"buy milk"}})
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	serveRequest(s, r)
+
+	if text, expected := nextMessage(t, messages), "203.0.113.7 created buy milk"; text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+
+	if _, err := newSlackNotifier(ts.URL, `{{ .Todo.Title`); err == nil {
+		t.Error("expected an invalid template to be rejected")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultSort is the order todos are listed in when none is chosen
+const defaultSort = "priority"
+
+// sortKeys compares two todos by each supported sort key returning a
+// negative number, zero or a positive number like strings.Compare
+var sortKeys = map[string]func(a, b *Todo) int{
+	"id": func(a, b *Todo) int {
+		return compareUint64(a.ID, b.ID)
+	},
+	"title": func(a, b *Todo) int {
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	},
+	"created": func(a, b *Todo) int {
+		return compareTime(a.CreatedAt, b.CreatedAt)
+	},
+	"updated": func(a, b *Todo) int {
+		return compareTime(a.UpdatedAt, b.UpdatedAt)
+	},
+	"due":      compareDue,
+	"priority": comparePriority,
+	// Todos arranged by hand first, the others by ID
+	"position": func(a, b *Todo) int {
+		switch {
+		case a.Position == 0 && b.Position == 0:
+			return 0
+		case a.Position == 0:
+			return 1
+		case b.Position == 0:
+			return -1
+		}
+		return compareInt(a.Position, b.Position)
+	},
+	"done": func(a, b *Todo) int {
+		switch {
+		case a.Done == b.Done:
+			return 0
+		case b.Done:
+			return -1
+		}
+		return 1
+	},
+}
+
+// sortOptions lists the sort orders offered in the UI
+var sortOptions = []string{"id", "-id", "title", "-title", "due", "-due", "created", "-created", "updated", "-updated", "done", "-done", "priority", "-priority", "position", "-position"}
+
+// compareDue orders todos by due date, todos without one last
+func compareDue(a, b *Todo) int {
+	switch {
+	case !a.hasDueDate() && !b.hasDueDate():
+		return 0
+	case !a.hasDueDate():
+		return 1
+	case !b.hasDueDate():
+		return -1
+	}
+	return compareTime(a.DueDate, b.DueDate)
+}
+
+// comparePriority orders todos by priority, highest first, ties broken by
+// due date like compareDue
+func comparePriority(a, b *Todo) int {
+	if c := compareInt(int(b.Priority), int(a.Priority)); c != 0 {
+		return c
+	}
+	return compareDue(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// sortOrder is a sort key and direction, written as the key for ascending
+// order or the key prefixed with "-" for descending order, e.g. "-due"
+type sortOrder struct {
+	key  string
+	desc bool
+}
+
+func (o sortOrder) String() string {
+	if o.desc {
+		return "-" + o.key
+	}
+	return o.key
+}
+
+// parseSortOrder parses a sort order validating its key
+func parseSortOrder(s string) (sortOrder, error) {
+	order := sortOrder{key: strings.TrimPrefix(s, "-"), desc: strings.HasPrefix(s, "-")}
+	if _, ok := sortKeys[order.key]; !ok {
+		return sortOrder{}, fmt.Errorf("invalid sort: %q", s)
+	}
+	return order, nil
+}
+
+// sortOrderFromRequest returns the sort order given by the ?sort= query
+// parameter, falling back to the sort preference cookie and then to def.
+// The direction can also be given by ?order=asc or ?order=desc. Only
+// invalid query parameters are returned as an error, an invalid cookie is
+// ignored.
+func sortOrderFromRequest(r *http.Request, def sortOrder) (sortOrder, error) {
+	order, err := requestedSortOrder(r, def)
+	if err != nil {
+		return sortOrder{}, err
+	}
+
+	switch dir := r.URL.Query().Get("order"); dir {
+	case "":
+	case "asc", "desc":
+		order.desc = dir == "desc"
+	default:
+		return sortOrder{}, fmt.Errorf("invalid order: %q", dir)
+	}
+
+	return order, nil
+}
+
+// requestedSortOrder returns the sort order of ?sort=, the cookie or def
+func requestedSortOrder(r *http.Request, def sortOrder) (sortOrder, error) {
+	if s := r.URL.Query().Get("sort"); s != "" {
+		return parseSortOrder(s)
+	}
+
+	if cookie, err := r.Cookie(sortCookie); err == nil {
+		if order, err := parseSortOrder(cookie.Value); err == nil {
+			return order, nil
+		}
+	}
+
+	return def, nil
+}
+
+// overdueFirst moves the overdue todos to the top of the list keeping the
+// order of the todos otherwise
+func overdueFirst(todoList TodoList, now time.Time) {
+	sort.SliceStable(todoList, func(i, j int) bool {
+		return todoList[i].isOverdue(now) && !todoList[j].isOverdue(now)
+	})
+}
+
+// sortTodosBy sorts the todos in place by the given order. Todos comparing
+// equal fall back to being ordered by ID so the order stays total.
+func sortTodosBy(todoList TodoList, order sortOrder) {
+	compare := sortKeys[order.key]
+
+	sort.SliceStable(todoList, func(i, j int) bool {
+		c := compare(todoList[i], todoList[j])
+		if c == 0 {
+			return todoList[i].ID < todoList[j].ID
+		}
+		if order.desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testTodoList returns todos with many ties between them on every sort key
+func testTodoList() TodoList {
+	var todoList TodoList
+	for i := uint64(0); i < 12; i++ {
+		todo := &Todo{
+			ID:        i,
+			Title:     []string{"Buy milk", "buy milk", "walk the dog"}[i%3],
+			Done:      i%2 == 0,
+			Priority:  priority(i % 4),
+			Position:  int(i % 3),
+			CreatedAt: testTime.Add(time.Duration(i%2) * time.Hour),
+			UpdatedAt: testTime,
+		}
+		if i%3 != 0 {
+			todo.DueDate = testTime.Add(time.Duration(i%2) * 24 * time.Hour)
+		}
+		todoList = append(todoList, todo)
+	}
+	return todoList
+}
+
+func todoIDs(todoList TodoList) []uint64 {
+	ids := make([]uint64, len(todoList))
+	for i, todo := range todoList {
+		ids[i] = todo.ID
+	}
+	return ids
+}
+
+func TestSortIsIndependentOfInputOrder(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for _, option := range sortOptions {
+		order, err := parseSortOrder(option)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		todoList := testTodoList()
+		sortTodosBy(todoList, order)
+		expected := todoIDs(todoList)
+
+		for n := 0; n < 20; n++ {
+			rnd.Shuffle(len(todoList), func(i, j int) { todoList.Swap(i, j) })
+			sortTodosBy(todoList, order)
+			if ids := todoIDs(todoList); !reflect.DeepEqual(ids, expected) {
+				t.Fatalf("expected sorting by %s to give %v, got %v", option, expected, ids)
+			}
+		}
+	}
+}
+
+func TestSortTiesBrokenByID(t *testing.T) {
+	todoList := TodoList{
+		{ID: 3, Title: "b"},
+		{ID: 1, Title: "a"},
+		{ID: 2, Title: "A"},
+		{ID: 0, Title: "b"},
+	}
+
+	sortTodosBy(todoList, sortOrder{key: "title"})
+	if ids, expected := todoIDs(todoList), []uint64{1, 2, 0, 3}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	// Ties stay in ID order in descending order too
+	sortTodosBy(todoList, sortOrder{key: "title", desc: true})
+	if ids, expected := todoIDs(todoList), []uint64{0, 3, 1, 2}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+}
+
+func TestSortTodosIsIndependentOfInputOrder(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	todoList := testTodoList()
+	sortTodos(todoList)
+	expected := todoIDs(todoList)
+
+	for n := 0; n < 20; n++ {
+		rnd.Shuffle(len(todoList), func(i, j int) { todoList.Swap(i, j) })
+		sortTodos(todoList)
+		if ids := todoIDs(todoList); !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("expected %v, got %v", expected, ids)
+		}
+	}
+}
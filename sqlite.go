@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prologic/bitcask"
+)
+
+// sqliteSchema creates the table every key is stored in. Keys are text so
+// the database can be queried by hand, e.g. with json_extract on todos.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS kv (
+	key TEXT PRIMARY KEY,
+	value BLOB NOT NULL
+) WITHOUT ROWID`
+
+// sqliteStore is a store kept in a SQLite database file
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// newSQLiteStore opens (or creates) the SQLite database at path
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single connection serializes writes, which SQLite would otherwise
+	// fail with "database is locked", and keeps a :memory: database from
+	// being opened once per connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteStore{db: db}, nil
+}
+
+func (ss *sqliteStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := ss.db.QueryRow("SELECT value FROM kv WHERE key = ?", string(key)).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (ss *sqliteStore) Has(key []byte) bool {
+	var n int
+	err := ss.db.QueryRow("SELECT 1 FROM kv WHERE key = ?", string(key)).Scan(&n)
+	return err == nil
+}
+
+func (ss *sqliteStore) Put(key, value []byte) error {
+	_, err := ss.db.Exec("INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)", string(key), value)
+	return err
+}
+
+func (ss *sqliteStore) Delete(key []byte) error {
+	_, err := ss.db.Exec("DELETE FROM kv WHERE key = ?", string(key))
+	return err
+}
+
+// keys returns the keys starting with prefix in sorted order like bitcask.
+// The rows are read before Scan calls f so f may access the store over the
+// only connection.
+func (ss *sqliteStore) keys(prefix string) ([]string, error) {
+	rows, err := ss.db.Query("SELECT key FROM kv WHERE key >= ? ORDER BY key", prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (ss *sqliteStore) Scan(prefix []byte, f func(key []byte) error) error {
+	keys, err := ss.keys(string(prefix))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := f([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ss *sqliteStore) Fold(f func(key []byte) error) error {
+	return ss.Scan(nil, f)
+}
+
+func (ss *sqliteStore) Close() error {
+	return ss.db.Close()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prologic/bitcask"
+)
+
+func TestSQLiteStoreGetPutDelete(t *testing.T) {
+	ss, err := newSQLiteStore(memoryDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	if _, err := ss.Get([]byte("todo_1")); !errors.Is(err, bitcask.ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound for a missing key, got %v", err)
+	}
+	if ss.Has([]byte("todo_1")) {
+		t.Error("expected a missing key not to exist")
+	}
+
+	if err := ss.Put([]byte("todo_1"), []byte(`{"title":"buy milk"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Put([]byte("todo_1"), []byte(`{"title":"buy oat milk"}`)); err != nil {
+		t.Fatal(err)
+	}
+	value, err := ss.Get([]byte("todo_1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != `{"title":"buy oat milk"}` {
+		t.Errorf("expected the stored value, got %q", value)
+	}
+	if !ss.Has([]byte("todo_1")) {
+		t.Error("expected the stored key to exist")
+	}
+
+	if err := ss.Delete([]byte("todo_1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.Get([]byte("todo_1")); !errors.Is(err, bitcask.ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound after deleting, got %v", err)
+	}
+}
+
+func TestSQLiteStoreScan(t *testing.T) {
+	ss, err := newSQLiteStore(memoryDBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	for _, key := range []string{"todo_2", "todo_1", "user_alice", "todo%_3", "nextid"} {
+		if err := ss.Put([]byte(key), []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Scan and Fold may be used to access the store while they iterate
+	var keys []string
+	err = ss.Scan([]byte("todo_"), func(key []byte) error {
+		keys = append(keys, string(key))
+		_, err := ss.Get(key)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"todo_1", "todo_2"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	keys = nil
+	err = ss.Fold(func(key []byte) error {
+		keys = append(keys, string(key))
+		return ss.Delete(key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"nextid", "todo%_3", "todo_1", "todo_2", "user_alice"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected every key in order, got %v", keys)
+	}
+}
+
+func TestSQLiteStoreServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "todo.sqlite")
+
+	db, err := openStore("sqlite:"+path, "todo.db", redisConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, db)
+	first := addTestTodo(t, s, "buy milk")
+	addTestTodo(t, s, "walk the dog")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = openStore("sqlite", path, redisConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s = newTestServer(t, db)
+
+	todo, err := s.loadTodo("", first.ID)
+	if err != nil {
+		t.Fatalf("expected the todo to be persisted, got %v", err)
+	}
+	if todo.Title != "buy milk" {
+		t.Errorf("expected the persisted todo, got %+v", todo)
+	}
+	if n := todoGauges(s); n != 2 {
+		t.Errorf("expected 2 todos after reopening, got %d", n)
+	}
+	if third := addTestTodo(t, s, "call mum"); third.ID <= first.ID+1 {
+		t.Errorf("expected ids to continue after reopening, got %d", third.ID)
+	}
+}
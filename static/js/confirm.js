@@ -0,0 +1,34 @@
+(function () {
+    // Links with data-confirm lead to a confirmation page for clients
+    // without JavaScript. Ask here instead and post the change directly.
+    document.addEventListener("click", function (e) {
+        var link = e.target.closest("a[data-confirm]");
+        if (!link) {
+            return;
+        }
+        e.preventDefault();
+
+        if (!window.confirm(link.getAttribute("data-confirm"))) {
+            return;
+        }
+
+        var form = document.createElement("form");
+        form.method = "POST";
+        form.action = link.href;
+
+        var csrf = document.createElement("input");
+        csrf.type = "hidden";
+        csrf.name = "csrf";
+        csrf.value = document.querySelector("meta[name=csrf-token]").content;
+        form.appendChild(csrf);
+
+        var returnTo = document.createElement("input");
+        returnTo.type = "hidden";
+        returnTo.name = "return_to";
+        returnTo.value = window.location.pathname + window.location.search;
+        form.appendChild(returnTo);
+
+        document.body.appendChild(form);
+        form.submit();
+    });
+})();
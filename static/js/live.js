@@ -0,0 +1,45 @@
+(function () {
+    // Reload the list in place whenever a todo is changed elsewhere, in
+    // another tab or by another client
+    var list = document.getElementById("todo-list");
+    if (!list || !window.EventSource) {
+        return;
+    }
+
+    var pending = false;
+
+    function refresh() {
+        if (pending) {
+            return;
+        }
+        pending = true;
+
+        // Changes often come in bursts, e.g. bulk updates and imports
+        window.setTimeout(function () {
+            fetch(window.location.href, { credentials: "same-origin" })
+                .then(function (resp) {
+                    return resp.ok ? resp.text() : null;
+                })
+                .then(function (html) {
+                    pending = false;
+                    if (!html) {
+                        return;
+                    }
+                    var doc = new DOMParser().parseFromString(html, "text/html");
+                    var fresh = doc.getElementById("todo-list");
+                    if (fresh) {
+                        list.replaceWith(fresh);
+                        list = fresh;
+                    }
+                })
+                .catch(function () {
+                    pending = false;
+                });
+        }, 250);
+    }
+
+    var source = new EventSource(document.querySelector("meta[name=base-path]").content + "/live");
+    ["create", "update", "delete"].forEach(function (op) {
+        source.addEventListener(op, refresh);
+    });
+})();
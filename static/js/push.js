@@ -0,0 +1,46 @@
+(function () {
+    var button = document.getElementById("push-subscribe");
+    if (!button || !("serviceWorker" in navigator) || !("PushManager" in window)) {
+        return;
+    }
+
+    function urlBase64ToUint8Array(base64String) {
+        var padding = "=".repeat((4 - base64String.length % 4) % 4);
+        var base64 = (base64String + padding).replace(/-/g, "+").replace(/_/g, "/");
+        var raw = window.atob(base64);
+        var output = new Uint8Array(raw.length);
+        for (var i = 0; i < raw.length; i++) {
+            output[i] = raw.charCodeAt(i);
+        }
+        return output;
+    }
+
+    var base = document.querySelector("meta[name=base-path]").content;
+
+    button.addEventListener("click", function () {
+        navigator.serviceWorker.register(base + "/sw.js").then(function (registration) {
+            return fetch(base + "/push/key").then(function (res) {
+                return res.json();
+            }).then(function (key) {
+                return registration.pushManager.subscribe({
+                    userVisibleOnly: true,
+                    applicationServerKey: urlBase64ToUint8Array(key.publicKey)
+                });
+            });
+        }).then(function (subscription) {
+            return fetch(base + "/push/subscribe", {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                    "X-CSRF-Token": document.querySelector("meta[name=csrf-token]").content
+                },
+                body: JSON.stringify(subscription)
+            });
+        }).then(function () {
+            button.textContent = "notifications on";
+            button.disabled = true;
+        }).catch(function (err) {
+            console.error("error subscribing to push notifications", err);
+        });
+    });
+})();
@@ -0,0 +1,67 @@
+(function () {
+    // Todos are dragged by their rows to arrange the list by hand when it
+    // is sorted by position. Live updates replace the list, so the events
+    // are handled on the document.
+    var dragged = null;
+
+    function rowOf(target) {
+        return target.closest ? target.closest("#todo-list [data-id]") : null;
+    }
+
+    document.addEventListener("dragstart", function (e) {
+        var row = rowOf(e.target);
+        if (!row) {
+            return;
+        }
+        dragged = row;
+        row.classList.add("dragging");
+        e.dataTransfer.effectAllowed = "move";
+        e.dataTransfer.setData("text/plain", row.getAttribute("data-id"));
+    });
+
+    document.addEventListener("dragover", function (e) {
+        if (!dragged) {
+            return;
+        }
+        var row = rowOf(e.target);
+        if (!row) {
+            return;
+        }
+        e.preventDefault();
+        if (row === dragged) {
+            return;
+        }
+        var rect = row.getBoundingClientRect();
+        var after = e.clientY > rect.top + rect.height / 2;
+        row.parentNode.insertBefore(dragged, after ? row.nextSibling : row);
+    });
+
+    document.addEventListener("drop", function (e) {
+        if (dragged) {
+            e.preventDefault();
+        }
+    });
+
+    document.addEventListener("dragend", function () {
+        if (!dragged) {
+            return;
+        }
+        dragged.classList.remove("dragging");
+        dragged = null;
+
+        var ids = Array.prototype.map.call(document.querySelectorAll("#todo-list [data-id]"), function (row) {
+            return Number(row.getAttribute("data-id"));
+        });
+        fetch(document.querySelector("meta[name=base-path]").content + "/reorder", {
+            method: "POST",
+            credentials: "same-origin",
+            headers: {
+                "Content-Type": "application/json",
+                "X-CSRF-Token": document.querySelector("meta[name=csrf-token]").content
+            },
+            body: JSON.stringify({ ids: ids })
+        }).catch(function (err) {
+            console.error("error reordering todos", err);
+        });
+    });
+})();
@@ -0,0 +1,14 @@
+self.addEventListener("push", function (event) {
+    var data = event.data ? event.data.json() : {};
+    event.waitUntil(
+        self.registration.showNotification(data.title || "todo", {
+            body: data.body || "",
+            icon: "icons/android-chrome-192x192.png"
+        })
+    );
+});
+
+self.addEventListener("notificationclick", function (event) {
+    event.notification.close();
+    event.waitUntil(clients.openWindow(self.registration.scope));
+});
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prologic/bitcask"
+)
+
+// memoryDBPath is the database path selecting the in-memory store
+const memoryDBPath = ":memory:"
+
+// redisConfig configures the Redis store
+type redisConfig struct {
+	addr     string
+	password string
+	db       int
+}
+
+// store is a key/value store todos, users and settings are kept in.
+// Missing keys are reported with bitcask.ErrKeyNotFound by every
+// implementation.
+type store interface {
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) bool
+	Put(key, value []byte) error
+	Delete(key []byte) error
+
+	// Scan calls f with every key starting with prefix
+	Scan(prefix []byte, f func(key []byte) error) error
+
+	// Fold calls f with every key
+	Fold(f func(key []byte) error) error
+
+	Close() error
+}
+
+// openStore opens the given kind of store, either "bitcask" using the
+// database at path (or an empty in-memory store if path is memoryDBPath),
+// "sqlite" using the database file at path or "redis". A path given with the
+// kind, as in "sqlite:/var/lib/todo/todo.sqlite", takes precedence.
+func openStore(kind, path string, rc redisConfig) (store, error) {
+	if i := strings.Index(kind, ":"); i >= 0 {
+		kind, path = kind[:i], kind[i+1:]
+	}
+
+	switch kind {
+	case "bitcask":
+		if path == memoryDBPath {
+			return newMemoryStore(), nil
+		}
+
+		db, err := newBitcaskStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "sqlite":
+		db, err := newSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "redis":
+		db, err := newRedisStore(rc.addr, rc.password, rc.db)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+
+	return nil, fmt.Errorf("unknown store: %q", kind)
+}
+
+// bitcaskStore is a store persisted to disk by bitcask
+type bitcaskStore struct {
+	*bitcask.Bitcask
+}
+
+func newBitcaskStore(path string) (*bitcaskStore, error) {
+	db, err := bitcask.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &bitcaskStore{db}, nil
+}
+
+// memoryStore is a store held in memory and lost when closed, for tests and
+// throwaway instances
+type memoryStore struct {
+	sync.RWMutex
+
+	data map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{data: make(map[string][]byte)}
+}
+
+func (m *memoryStore) Get(key []byte) ([]byte, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *memoryStore) Has(key []byte) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	_, ok := m.data[string(key)]
+	return ok
+}
+
+func (m *memoryStore) Put(key, value []byte) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *memoryStore) Delete(key []byte) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.data, string(key))
+	return nil
+}
+
+// keys returns the keys starting with prefix in sorted order like bitcask.
+// Scan and Fold call f on a copy of the keys without holding the lock so
+// f may access the store.
+func (m *memoryStore) keys(prefix string) []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	var keys []string
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *memoryStore) Scan(prefix []byte, f func(key []byte) error) error {
+	for _, key := range m.keys(string(prefix)) {
+		if err := f([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Fold(f func(key []byte) error) error {
+	return m.Scan(nil, f)
+}
+
+func (m *memoryStore) Close() error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.data = make(map[string][]byte)
+	return nil
+}
+
+// namespacedStore scopes every key of another store by a namespace prefix
+// so several independent todo instances (or test runs) can share a single
+// database. Keys passed to and from it never include the namespace.
+type namespacedStore struct {
+	store
+	namespace []byte
+}
+
+// namespacedCounterStore is a namespacedStore of a store with atomic
+// counters
+type namespacedCounterStore struct {
+	*namespacedStore
+}
+
+func (ns namespacedCounterStore) Incr(key []byte) (uint64, error) {
+	return ns.store.(counterStore).Incr(ns.key(key))
+}
+
+// withNamespace scopes db by namespace, returning db itself if the
+// namespace is empty
+func withNamespace(db store, namespace string) store {
+	if namespace == "" {
+		return db
+	}
+
+	ns := &namespacedStore{store: db, namespace: []byte(namespace)}
+	if _, ok := db.(counterStore); ok {
+		return namespacedCounterStore{ns}
+	}
+	return ns
+}
+
+func (ns *namespacedStore) key(key []byte) []byte {
+	return append(append([]byte{}, ns.namespace...), key...)
+}
+
+func (ns *namespacedStore) Get(key []byte) ([]byte, error) {
+	return ns.store.Get(ns.key(key))
+}
+
+func (ns *namespacedStore) Has(key []byte) bool {
+	return ns.store.Has(ns.key(key))
+}
+
+func (ns *namespacedStore) Put(key, value []byte) error {
+	return ns.store.Put(ns.key(key), value)
+}
+
+func (ns *namespacedStore) Delete(key []byte) error {
+	return ns.store.Delete(ns.key(key))
+}
+
+func (ns *namespacedStore) Scan(prefix []byte, f func(key []byte) error) error {
+	return ns.store.Scan(ns.key(prefix), func(key []byte) error {
+		return f(key[len(ns.namespace):])
+	})
+}
+
+func (ns *namespacedStore) Fold(f func(key []byte) error) error {
+	return ns.store.Fold(func(key []byte) error {
+		if !bytes.HasPrefix(key, ns.namespace) {
+			return nil
+		}
+		return f(key[len(ns.namespace):])
+	})
+}
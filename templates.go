@@ -7,6 +7,8 @@ import (
 	"io"
 	"log"
 	"sync"
+
+	rice "github.com/GeertJohan/go.rice"
 )
 
 type templateMap map[string]*template.Template
@@ -18,6 +20,24 @@ type templates struct {
 	templates templateMap
 }
 
+// parseTemplate parses a template named name from the given files of box.
+// Errors name the file that could not be loaded or parsed.
+func parseTemplate(box *rice.Box, name string, funcs template.FuncMap, files ...string) (*template.Template, error) {
+	t := template.New(name).Funcs(funcs)
+
+	for _, file := range files {
+		text, err := box.String(file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading template %s: %w", file, err)
+		}
+		if _, err := t.Parse(text); err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %w", file, err)
+		}
+	}
+
+	return t, nil
+}
+
 func newTemplates(base string) *templates {
 	return &templates{
 		base:      base,
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// endOfDay returns the start of the day after t in t's location
+func endOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+}
+
+// dueTodayFilter matches incomplete todos due by the end of now's day,
+// which includes every overdue todo
+func dueTodayFilter(now time.Time) todoFilter {
+	end := endOfDay(now)
+	return func(todo *Todo) bool {
+		return !todo.Done && todo.hasDueDate() && todo.DueDate.Before(end)
+	}
+}
+
+// loadToday returns the incomplete todos due today or overdue, ordered by
+// due date. Today is the current day in the local timezone.
+func (s *server) loadToday(r *http.Request) (TodoList, int, error) {
+	todoList, skipped, err := s.loadTodos(r.Context(), keyPrefix(r))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	todoList = filterTodos(todoList, []todoFilter{dueTodayFilter(s.now().In(time.Local))})
+	sortTodosBy(todoList, sortOrder{key: "due"})
+
+	return todoList, skipped, nil
+}
+
+// TodayHandler shows the todos that need doing today
+func (s *server) TodayHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_today")
+
+		todoList, skipped, err := s.loadToday(r)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ctx := &templateContext{
+			Title:       "today",
+			TodoList:    todoList,
+			Total:       len(todoList),
+			Skipped:     skipped,
+			Colors:      colorPalette,
+			Priorities:  priorityLabels,
+			Query:       r.URL.Query(),
+			Sort:        "due",
+			SortOptions: sortOptions,
+		}
+
+		s.render("index", w, r, ctx)
+	}
+}
+
+// TodayAPIHandler returns the todos that need doing today
+func (s *server) TodayAPIHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.counters.Inc("n_api_today")
+
+		todoList, _, err := s.loadToday(r)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+		if todoList == nil {
+			todoList = TodoList{}
+		}
+
+		writeJSON(w, r, http.StatusOK, todosPage{Todos: todoList})
+	}
+}
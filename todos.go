@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prologic/bitcask"
+	log "github.com/sirupsen/logrus"
+)
+
+// todoKeyPattern matches the keys of all todos on the list, including
+// those scoped to a user in multi-user mode
+var todoKeyPattern = regexp.MustCompile(`^(user_[0-9]+_)?todo_([0-9]+)$`)
+
+// archiveKeyPattern matches the keys of all archived todos
+var archiveKeyPattern = regexp.MustCompile(`^(user_[0-9]+_)?archive_([0-9]+)$`)
+
+// trashKeyPattern matches the keys of all todos in the trash
+var trashKeyPattern = regexp.MustCompile(`^(user_[0-9]+_)?trash_([0-9]+)$`)
+
+// storedKeyPattern matches the keys of all todos whether they are on the
+// list, archived or in the trash, with the prefix, the namespace and the
+// id. A todo keeps its id in every namespace so ids must be unique across
+// all of them.
+var storedKeyPattern = regexp.MustCompile(`^(user_[0-9]+_)?(todo|archive|trash)_([0-9]+)$`)
+
+// Namespaces of the keys todos are stored under: todos on the list are
+// kept at todo_<id>, archived ones at archive_<id> and deleted ones at
+// trash_<id>
+const (
+	todoNamespace    = "todo_"
+	archiveNamespace = "archive_"
+	trashNamespace   = "trash_"
+)
+
+// trackTodo updates the pending/completed gauges for a todo on the list
+// changing state from before to after. A nil before means the todo was
+// added to the list and a nil after means it was removed from it.
+func (s *server) trackTodo(before, after *Todo) {
+	if before != nil {
+		if before.Done {
+			s.counters.Adjust("todos_completed", -1)
+		} else {
+			s.counters.Adjust("todos_pending", -1)
+		}
+	}
+	if after != nil {
+		if after.Done {
+			s.counters.Adjust("todos_completed", 1)
+		} else {
+			s.counters.Adjust("todos_pending", 1)
+		}
+	}
+}
+
+// errTooManyTodos is returned adding a todo to a list that already holds
+// the maximum number of todos
+var errTooManyTodos = errors.New("maximum number of todos reached")
+
+// countTodo adjusts the number of todos on the list under prefix by delta
+func (s *server) countTodo(prefix string, delta int) {
+	s.counts.Lock()
+	defer s.counts.Unlock()
+
+	s.todoCounts[prefix] += delta
+}
+
+// countTodos returns the number of todos on the list under the given key
+// prefix so the item limit applies to each user on their own. The counts
+// are kept up to date as todos are stored and removed rather than scanned.
+func (s *server) countTodos(prefix string) int {
+	s.counts.Lock()
+	defer s.counts.Unlock()
+
+	return s.todoCounts[prefix]
+}
+
+// addTodo stores a new todo under the given key prefix with the next id,
+// returning its key, or errTooManyTodos when the list is full. Adds are
+// serialized so concurrent ones cannot take the list over the limit.
+func (s *server) addTodo(prefix string, todo *Todo) (string, error) {
+	s.adds.Lock()
+	defer s.adds.Unlock()
+
+	if s.maxItems > 0 && s.countTodos(prefix) >= s.maxItems {
+		return "", errTooManyTodos
+	}
+
+	id, err := s.allocateID(prefix + "nextid")
+	if err != nil {
+		return "", fmt.Errorf("error allocating id: %w", err)
+	}
+	todo.ID = id
+
+	key := fmt.Sprintf("%s%s%d", prefix, todoNamespace, todo.ID)
+	if err := s.putTodo(key, todo); err != nil {
+		return "", fmt.Errorf("error storing todo: %w", err)
+	}
+
+	s.trackTodo(nil, todo)
+	return key, nil
+}
+
+// initGauges sets the pending/completed gauges and the number of todos on
+// each list from a single pass over all todos in the database so they
+// reflect the existing data on startup
+func (s *server) initGauges() {
+	var keys [][]byte
+
+	err := s.db.Fold(func(key []byte) error {
+		if todoKeyPattern.Match(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("error initializing gauges")
+		return
+	}
+
+	counts := make(map[string]int)
+
+	var pending, completed int64
+	for _, key := range keys {
+		var todo Todo
+
+		counts[string(todoKeyPattern.FindSubmatch(key)[1])]++
+
+		data, err := s.db.Get(key)
+		if err != nil {
+			continue
+		}
+		if err := s.codec.Unmarshal(data, &todo); err != nil {
+			continue
+		}
+
+		if todo.Done {
+			completed++
+		} else {
+			pending++
+		}
+	}
+
+	s.counters.Set("todos_pending", pending)
+	s.counters.Set("todos_completed", completed)
+
+	s.counts.Lock()
+	s.todoCounts = counts
+	s.counts.Unlock()
+}
+
+// parseDueDate parses a due date given either as RFC3339 or as a plain
+// 2006-01-02 date, in which case the todo is due by the end of that day
+func parseDueDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// parseRemindBefore parses how long before its due date a todo's reminder
+// is sent, as a duration like 90m or 1h30m or a number of days like 2d
+func parseRemindBefore(s string) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid remind: %q", s)
+	}
+	return d, nil
+}
+
+// loadTodos returns all todos on the list stored under the given key
+// prefix along with the number of records that were skipped because they
+// could not be read or decoded. A single corrupted record is logged and
+// skipped rather than failing the whole list.
+func (s *server) loadTodos(ctx context.Context, prefix string) (TodoList, int, error) {
+	return s.scanTodos(ctx, prefix, todoNamespace)
+}
+
+// loadArchived returns all archived todos stored under the given key prefix
+// like loadTodos
+func (s *server) loadArchived(ctx context.Context, prefix string) (TodoList, int, error) {
+	return s.scanTodos(ctx, prefix, archiveNamespace)
+}
+
+// loadTrash returns all todos in the trash under the given key prefix like
+// loadTodos
+func (s *server) loadTrash(ctx context.Context, prefix string) (TodoList, int, error) {
+	return s.scanTodos(ctx, prefix, trashNamespace)
+}
+
+// scanTodos returns the todos stored under the given key prefix in the
+// given namespace, skipping corrupted records
+func (s *server) scanTodos(ctx context.Context, prefix, namespace string) (TodoList, int, error) {
+	var (
+		todoList TodoList
+		skipped  int
+	)
+
+	err := s.db.Scan([]byte(prefix+namespace), func(key []byte) error {
+		var todo Todo
+
+		data, err := s.db.Get(key)
+		if err != nil {
+			contextLog(ctx).WithError(err).WithField("key", string(key)).Error("error getting todo, skipping")
+			skipped++
+			return nil
+		}
+
+		err = s.codec.Unmarshal(data, &todo)
+		if err != nil {
+			contextLog(ctx).WithError(err).WithField("key", string(key)).Error("error unmarshaling todo, skipping")
+			skipped++
+			return nil
+		}
+
+		todoList = append(todoList, &todo)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return todoList, skipped, nil
+}
+
+// normalizeTitle returns the form of a title used to detect duplicates
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.TrimSpace(title))
+}
+
+// findDuplicate returns an incomplete todo under the given key prefix
+// whose normalized title matches title, or nil if there is none. Completed
+// todos never count as duplicates.
+func (s *server) findDuplicate(ctx context.Context, prefix, title string) (*Todo, error) {
+	todoList, _, err := s.loadTodos(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	title = normalizeTitle(title)
+	for _, todo := range todoList {
+		if !todo.Done && normalizeTitle(todo.Title) == title {
+			return todo, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// loadTodosFrom returns up to limit todos under the given key prefix with
+// an id of at least start, ordered by id, and whether more todos follow.
+// Ids are taken from the keys so todos before start are never read.
+// Todos not matching filters are skipped.
+func (s *server) loadTodosFrom(ctx context.Context, prefix string, start uint64, limit int, filters []todoFilter) (TodoList, bool, error) {
+	var ids []uint64
+
+	keyPrefix := prefix + "todo_"
+	err := s.db.Scan([]byte(keyPrefix), func(key []byte) error {
+		id, err := strconv.ParseUint(strings.TrimPrefix(string(key), keyPrefix), 10, 64)
+		if err != nil {
+			return nil
+		}
+		if id >= start {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var todoList TodoList
+	for _, id := range ids {
+		if len(todoList) == limit {
+			return todoList, true, nil
+		}
+
+		key := fmt.Sprintf("%s%d", keyPrefix, id)
+
+		var todo Todo
+
+		data, err := s.db.Get([]byte(key))
+		if err != nil {
+			contextLog(ctx).WithError(err).WithField("key", key).Error("error getting todo, skipping")
+			continue
+		}
+
+		if err := s.codec.Unmarshal(data, &todo); err != nil {
+			contextLog(ctx).WithError(err).WithField("key", key).Error("error unmarshaling todo, skipping")
+			continue
+		}
+
+		if !matchFilters(&todo, filters) {
+			continue
+		}
+
+		todoList = append(todoList, &todo)
+	}
+
+	return todoList, false, nil
+}
+
+// counterStore is implemented by stores that can atomically increment a
+// counter, returning its new value
+type counterStore interface {
+	Incr(key []byte) (uint64, error)
+}
+
+// allocateID returns the next id from the counter at key, e.g. "nextid".
+// Ids start at 0 and are never handed out twice, using the store's atomic
+// counters when it has them so several instances can share a store.
+func (s *server) allocateID(key string) (uint64, error) {
+	if cs, ok := s.db.(counterStore); ok {
+		n, err := cs.Incr([]byte(key))
+		if err != nil {
+			return 0, err
+		}
+		return n - 1, nil
+	}
+
+	s.ids.Lock()
+	defer s.ids.Unlock()
+
+	id, err := s.readCounter(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.writeCounter(key, id+1); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// readCounter returns the value of an id counter, 0 if it is not set.
+// Counters of stores with atomic counters are kept as decimal strings,
+// others as big endian uint64s.
+func (s *server) readCounter(key string) (uint64, error) {
+	data, err := s.db.Get([]byte(key))
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if _, ok := s.db.(counterStore); ok {
+		return strconv.ParseUint(string(data), 10, 64)
+	}
+	if len(data) != 8 {
+		return 0, errors.New("invalid counter")
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// writeCounter sets the value of an id counter
+func (s *server) writeCounter(key string, n uint64) error {
+	if _, ok := s.db.(counterStore); ok {
+		return s.db.Put([]byte(key), []byte(strconv.FormatUint(n, 10)))
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	return s.db.Put([]byte(key), buf)
+}
+
+// loadTodo returns the todo with the given id under prefix, or
+// bitcask.ErrKeyNotFound if there is no such todo
+func (s *server) loadTodo(prefix string, id uint64) (*Todo, error) {
+	return s.loadTodoAt(fmt.Sprintf("%stodo_%d", prefix, id))
+}
+
+// errUndecodable is wrapped by the errors of loading a todo whose record
+// cannot be decoded
+var errUndecodable = errors.New("undecodable todo")
+
+// loadTodoAt returns the todo stored at key
+func (s *server) loadTodoAt(key string) (*Todo, error) {
+	data, err := s.db.Get([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	todo := &Todo{}
+	if err := s.codec.Unmarshal(data, todo); err != nil {
+		return nil, fmt.Errorf("%w: %s", errUndecodable, err)
+	}
+
+	return todo, nil
+}
+
+// putTodo stores the todo at key bumping its revision
+func (s *server) putTodo(key string, todo *Todo) error {
+	op := opCreate
+	if s.db.Has([]byte(key)) {
+		op = opUpdate
+	}
+
+	todo.Rev++
+
+	data, err := s.codec.Marshal(todo)
+	if err == nil {
+		err = s.db.Put([]byte(key), data)
+	}
+	if err != nil {
+		todo.Rev--
+		return err
+	}
+
+	if m := todoKeyPattern.FindStringSubmatch(key); m != nil && op == opCreate {
+		s.countTodo(m[1], 1)
+	}
+
+	s.recordEvent(op, key, todo)
+
+	return nil
+}
+
+// removeTodo deletes the todo stored at key
+func (s *server) removeTodo(key string) error {
+	existed := s.db.Has([]byte(key))
+	if err := s.db.Delete([]byte(key)); err != nil {
+		return err
+	}
+
+	if m := todoKeyPattern.FindStringSubmatch(key); m != nil && existed {
+		s.countTodo(m[1], -1)
+	}
+
+	s.recordEvent(opDelete, key, nil)
+
+	return nil
+}
+
+// errUnchanged is returned by an update passed to updateTodo to leave the
+// todo as it is
+var errUnchanged = errors.New("todo unchanged")
+
+// updateTodo loads the todo with the given id under prefix, changes it with
+// update and stores it, returning the todo before and after the change.
+// Updates are serialized so none is lost; an error from update aborts the
+// change and is returned as is.
+func (s *server) updateTodo(prefix string, id uint64, update func(todo *Todo) error) (*Todo, *Todo, error) {
+	return s.updateTodoAt(fmt.Sprintf("%stodo_%d", prefix, id), update)
+}
+
+// updateTodoAt changes the todo stored at key like updateTodo
+func (s *server) updateTodoAt(key string, update func(todo *Todo) error) (*Todo, *Todo, error) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	todo, err := s.loadTodoAt(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	before := *todo
+	before.Tags = append([]string(nil), todo.Tags...)
+
+	if err := update(todo); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.putTodo(key, todo); err != nil {
+		return nil, nil, err
+	}
+
+	return &before, todo, nil
+}
+
+// moveTodo moves the todo with the given id under prefix from one
+// namespace to another, e.g. from todoNamespace to archiveNamespace,
+// changing it with update on the way like updateTodo. The todo is stored
+// at its new key before its old key is deleted so it is never lost.
+func (s *server) moveTodo(prefix string, id uint64, from, to string, update func(todo *Todo) error) (*Todo, *Todo, error) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	fromKey := fmt.Sprintf("%s%s%d", prefix, from, id)
+	toKey := fmt.Sprintf("%s%s%d", prefix, to, id)
+
+	todo, err := s.loadTodoAt(fromKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	before := *todo
+	before.Tags = append([]string(nil), todo.Tags...)
+
+	if err := update(todo); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.putTodo(toKey, todo); err != nil {
+		return nil, nil, err
+	}
+	if err := s.removeTodo(fromKey); err != nil {
+		return nil, nil, err
+	}
+
+	return &before, todo, nil
+}
+
+// deleteTodo deletes the todo with the given id under prefix, updating the
+// gauges and recording the deletion so it can be undone. It returns the
+// deleted todo, which is nil if it could not be decoded, or
+// bitcask.ErrKeyNotFound if there is no such todo.
+func (s *server) deleteTodo(ctx context.Context, prefix string, id uint64) (*Todo, error) {
+	return s.deleteTodoAt(ctx, prefix, fmt.Sprintf("%stodo_%d", prefix, id))
+}
+
+// deleteTodoAt deletes the todo stored at key under prefix like
+// deleteTodo, only counting it in the gauges if it is on the list
+func (s *server) deleteTodoAt(ctx context.Context, prefix, key string) (*Todo, error) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	data, err := s.db.Get([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	todo := &Todo{}
+	if err := s.codec.Unmarshal(data, todo); err != nil {
+		contextLog(ctx).WithError(err).WithField("key", key).Warn("error unmarshaling todo being deleted")
+		todo = nil
+	}
+
+	if err := s.removeTodo(key); err != nil {
+		return nil, err
+	}
+
+	if todoKeyPattern.MatchString(key) {
+		s.trackTodo(todo, nil)
+	}
+	if todo != nil {
+		s.undo.Push(prefix, undoEntry{key: key, before: todo})
+	}
+
+	return todo, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// todoTxtPriorities are the todo.txt priority letters of priorities
+var todoTxtPriorities = map[priority]string{
+	priorityHigh: "A",
+	priorityMed:  "B",
+	priorityLow:  "C",
+}
+
+// todoTxtPriority returns the priority of a todo.txt priority letter.
+// todo.txt has 26 priorities, those below C are all low.
+func todoTxtPriority(letter string) (priority, bool) {
+	if len(letter) != 1 || letter[0] < 'A' || letter[0] > 'Z' {
+		return priorityNone, false
+	}
+	for p, l := range todoTxtPriorities {
+		if l == letter {
+			return p, true
+		}
+	}
+	return priorityLow, true
+}
+
+// formatTodoTxt formats a todo as a line of a todo.txt file. Tags are
+// written as +projects and the due date as a due: tag. Completed todos
+// keep their priority as a pri: tag as todo.txt drops it otherwise.
+func formatTodoTxt(todo *Todo) string {
+	var parts []string
+
+	letter, hasPriority := todoTxtPriorities[todo.Priority]
+	if todo.Done {
+		parts = append(parts, "x")
+		if !todo.CompletedAt.IsZero() {
+			parts = append(parts, formatDate(todo.CompletedAt))
+		}
+	} else if hasPriority {
+		parts = append(parts, "("+letter+")")
+	}
+
+	// A completed task's creation date follows its completion date
+	if !todo.CreatedAt.IsZero() && (!todo.Done || !todo.CompletedAt.IsZero()) {
+		parts = append(parts, formatDate(todo.CreatedAt))
+	}
+
+	parts = append(parts, strings.Fields(todo.Title)...)
+	for _, tag := range todo.Tags {
+		parts = append(parts, "+"+tag)
+	}
+	if todo.hasDueDate() {
+		parts = append(parts, "due:"+formatDate(todo.DueDate))
+	}
+	if todo.Done && hasPriority {
+		parts = append(parts, "pri:"+letter)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// parseTodoTxtDate parses a todo.txt date, in the local timezone
+func parseTodoTxtDate(s string) (time.Time, bool) {
+	t, err := time.ParseInLocation(dateFormat, s, time.Local)
+	return t, err == nil
+}
+
+// todoFromTodoTxt builds a todo from a line of a todo.txt file. Both
+// +projects and @contexts become tags.
+func (s *server) todoFromTodoTxt(line string) (*Todo, error) {
+	fields := strings.Fields(line)
+
+	var (
+		done      bool
+		p         priority
+		completed time.Time
+		created   time.Time
+	)
+
+	if len(fields) > 0 && fields[0] == "x" {
+		done = true
+		fields = fields[1:]
+		if len(fields) > 0 {
+			if t, ok := parseTodoTxtDate(fields[0]); ok {
+				completed = t
+				fields = fields[1:]
+			}
+		}
+	} else if len(fields) > 0 && len(fields[0]) == 3 && fields[0][0] == '(' && fields[0][2] == ')' {
+		if v, ok := todoTxtPriority(fields[0][1:2]); ok {
+			p = v
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) > 0 {
+		if t, ok := parseTodoTxtDate(fields[0]); ok {
+			created = t
+			fields = fields[1:]
+		}
+	}
+
+	var (
+		words []string
+		tags  []string
+		due   string
+	)
+	for _, field := range fields {
+		switch {
+		case len(field) > 1 && (field[0] == '+' || field[0] == '@'):
+			tags = append(tags, field[1:])
+		case strings.HasPrefix(field, "due:"):
+			due = strings.TrimPrefix(field, "due:")
+		case strings.HasPrefix(field, "pri:"):
+			if v, ok := todoTxtPriority(strings.TrimPrefix(field, "pri:")); ok {
+				p = v
+			}
+		default:
+			words = append(words, field)
+		}
+	}
+
+	title := strings.Join(words, " ")
+	u := todoUpdate{Title: &title, Tags: &tags, Due: &due}
+	if err := u.normalize(s.maxTitleLength); err != nil {
+		return nil, err
+	}
+
+	todo := &Todo{}
+	u.apply(todo)
+	todo.Priority = p
+	todo.setDone(done)
+	if done && !completed.IsZero() {
+		todo.CompletedAt = completed
+	}
+
+	todo.CreatedAt = todo.UpdatedAt
+	if !created.IsZero() {
+		todo.CreatedAt = created
+	}
+
+	return todo, nil
+}
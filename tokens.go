@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+const (
+	// tokenPrefix is the key prefix under which the API tokens of users
+	// are stored, by the hash of the token
+	tokenPrefix = "tokens_"
+
+	// maxTokenNameLength is the maximum length of an API token's name
+	maxTokenNameLength = 64
+)
+
+// apiToken is an API token of a user in multi-user mode. Only the hash of
+// the token is stored, the token itself is shown once when generated.
+type apiToken struct {
+	ID        string
+	Name      string
+	UserID    uint64
+	Username  string
+	CreatedAt time.Time
+}
+
+// hashToken returns the SHA-256 hash a token is stored under, encoded to
+// fit bitcask's maximum key size. Tokens are random so a fast hash is
+// enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// createToken generates a new API token for the user, returning it along
+// with the token itself
+func (s *server) createToken(user *User, name string) (*apiToken, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	hash := hashToken(token)
+
+	t := &apiToken{
+		ID:        hash[:12],
+		Name:      name,
+		UserID:    user.ID,
+		Username:  user.Username,
+		CreatedAt: time.Now(),
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.db.Put([]byte(tokenPrefix+hash), data); err != nil {
+		return nil, "", err
+	}
+
+	return t, token, nil
+}
+
+// userTokens returns the API tokens of the user by their hashes
+func (s *server) userTokens(user *User) (map[string]*apiToken, error) {
+	tokens := make(map[string]*apiToken)
+
+	err := s.db.Scan([]byte(tokenPrefix), func(key []byte) error {
+		data, err := s.db.Get(key)
+		if err != nil {
+			return err
+		}
+
+		var t apiToken
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil
+		}
+		if t.UserID == user.ID {
+			tokens[strings.TrimPrefix(string(key), tokenPrefix)] = &t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// revokeToken deletes the user's API token with the given id, or returns
+// bitcask.ErrKeyNotFound if the user has no such token
+func (s *server) revokeToken(user *User, id string) error {
+	tokens, err := s.userTokens(user)
+	if err != nil {
+		return err
+	}
+
+	for hash, t := range tokens {
+		if t.ID == id {
+			return s.db.Delete([]byte(tokenPrefix + hash))
+		}
+	}
+
+	return bitcask.ErrKeyNotFound
+}
+
+// tokenUser returns the user whose API token the request carries, or nil
+// if it carries none or the token is not a user's
+func (s *server) tokenUser(r *http.Request) (*User, error) {
+	return s.userByToken(apiKeyFromRequest(r))
+}
+
+// userByToken returns the user the API token belongs to, or nil if it is
+// not a user's
+func (s *server) userByToken(token string) (*User, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	data, err := s.db.Get([]byte(tokenPrefix + hashToken(token)))
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var t apiToken
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(t.Username)
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if user.ID != t.UserID {
+		return nil, nil
+	}
+
+	return user, nil
+}
+
+// renderSettings renders the settings page of the logged in user, showing
+// token once if it was just generated
+func (s *server) renderSettings(w http.ResponseWriter, r *http.Request, token string) {
+	tokens, err := s.userTokens(userFromRequest(r))
+	if err != nil {
+		requestLog(r).WithError(err).Error("error listing api tokens")
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := &templateContext{Title: "settings", NewToken: token}
+	for _, t := range tokens {
+		ctx.Tokens = append(ctx.Tokens, t)
+	}
+	sort.Slice(ctx.Tokens, func(i, j int) bool {
+		return ctx.Tokens[i].CreatedAt.Before(ctx.Tokens[j].CreatedAt)
+	})
+
+	s.render("settings", w, r, ctx)
+}
+
+// SettingsHandler shows the settings of the logged in user
+func (s *server) SettingsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_settings")
+
+		s.renderSettings(w, r, "")
+	}
+}
+
+// CreateTokenHandler generates an API token named by the form's name field
+// for the logged in user and shows it
+func (s *server) CreateTokenHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_create_token")
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" || len(name) > maxTokenNameLength {
+			http.Error(w, "Bad Request: invalid name", http.StatusBadRequest)
+			return
+		}
+
+		_, token, err := s.createToken(userFromRequest(r), name)
+		if err != nil {
+			requestLog(r).WithError(err).Error("error creating api token")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.renderSettings(w, r, token)
+	}
+}
+
+// RevokeTokenHandler deletes an API token of the logged in user
+func (s *server) RevokeTokenHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_revoke_token")
+
+		if err := s.revokeToken(userFromRequest(r), p.ByName("id")); err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				http.Error(w, "Not Found: no such token", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).Error("error revoking api token")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/settings", http.StatusFound)
+	}
+}
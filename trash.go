@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// trashTodo moves the todo with the given id under prefix from namespace,
+// the list or the archive, to the trash so it can be undone or restored
+// until it is purged. It returns the todo or bitcask.ErrKeyNotFound if
+// there is no such todo in namespace.
+func (s *server) trashTodo(prefix, namespace string, id uint64) (*Todo, error) {
+	before, todo, err := s.moveTodo(prefix, id, namespace, trashNamespace, func(todo *Todo) error {
+		todo.DeletedAt = s.now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if namespace == todoNamespace {
+		s.trackTodo(before, nil)
+	}
+	s.undo.Push(prefix, undoEntry{
+		key:    fmt.Sprintf("%s%s%d", prefix, namespace, id),
+		before: before,
+		moved:  fmt.Sprintf("%strash_%d", prefix, id),
+	})
+
+	return todo, nil
+}
+
+// discardTodo moves the todo with the given id under prefix from the list
+// to the trash like trashTodo. A corrupted todo cannot be moved and is
+// deleted right away, in which case the returned todo is nil.
+func (s *server) discardTodo(ctx context.Context, prefix string, id uint64) (*Todo, error) {
+	todo, err := s.trashTodo(prefix, todoNamespace, id)
+	if errors.Is(err, errUndecodable) {
+		contextLog(ctx).WithError(err).WithField("id", id).Warn("deleting corrupted todo")
+		return s.deleteTodo(ctx, prefix, id)
+	}
+	return todo, err
+}
+
+// TrashListHandler lists the todos in the trash, most recently deleted
+// first
+func (s *server) TrashListHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_trash_list")
+
+		todoList, skipped, err := s.loadTrash(r.Context(), keyPrefix(r))
+		if err != nil {
+			requestLog(r).WithError(err).Error("error listing deleted todos")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		sort.SliceStable(todoList, func(i, j int) bool {
+			return todoList[i].DeletedAt.After(todoList[j].DeletedAt)
+		})
+
+		s.render("trash", w, r, &templateContext{
+			Title:    "trash",
+			TodoList: todoList,
+			Total:    len(todoList),
+			Skipped:  skipped,
+		})
+	}
+}
+
+// TrashRestoreHandler brings a todo in the trash back to the list
+func (s *server) TrashRestoreHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_trash_restore")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		key := fmt.Sprintf("%strash_%d", prefix, id)
+
+		before, todo, err := s.moveTodo(prefix, id, trashNamespace, todoNamespace, func(todo *Todo) error {
+			todo.ArchivedAt = time.Time{}
+			todo.DeletedAt = time.Time{}
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("key", key).Warn("deleted todo not found")
+				http.Error(w, "Not Found: no such deleted todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("key", key).Error("error restoring todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.trackTodo(nil, todo)
+		s.undo.Push(prefix, undoEntry{key: key, before: before, moved: fmt.Sprintf("%stodo_%d", prefix, id)})
+
+		redirectBack(w, r)
+	}
+}
+
+// TrashDeleteHandler deletes a todo in the trash for good (or until undone)
+// without waiting for it to be purged
+func (s *server) TrashDeleteHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_trash_delete")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		key := fmt.Sprintf("%strash_%d", prefix, id)
+
+		if _, err := s.deleteTodoAt(r.Context(), prefix, key); err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				requestLog(r).WithField("key", key).Warn("deleted todo not found")
+				http.Error(w, "Not Found: no such deleted todo", http.StatusNotFound)
+				return
+			}
+			requestLog(r).WithError(err).WithField("key", key).Error("error deleting todo")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		s.setFlash(w, "deleted")
+		redirectBack(w, r)
+	}
+}
+
+// purgeTrash permanently deletes every todo of every user that was moved to
+// the trash more than trashRetention before now. Without a retention the
+// trash is never purged.
+func (s *server) purgeTrash(ctx context.Context, now time.Time) {
+	if s.trashRetention <= 0 {
+		return
+	}
+
+	var keys [][]byte
+
+	err := s.db.Fold(func(key []byte) error {
+		if trashKeyPattern.Match(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		contextLog(ctx).WithError(err).Error("error listing todos to purge")
+		return
+	}
+
+	for _, key := range keys {
+		if s.purgeTodo(ctx, key, now) {
+			contextLog(ctx).WithField("key", string(key)).Info("purged todo")
+		}
+	}
+}
+
+// purgeTodo permanently deletes the todo in the trash at key if it was
+// moved there more than trashRetention before now, reporting whether it
+// was.
+// Checking and deleting are done under the write lock so a todo restored
+// in the meantime is not deleted.
+func (s *server) purgeTodo(ctx context.Context, key []byte, now time.Time) bool {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	var todo Todo
+
+	data, err := s.db.Get(key)
+	if err != nil {
+		return false
+	}
+	if err := s.codec.Unmarshal(data, &todo); err != nil {
+		return false
+	}
+
+	if now.Sub(todo.DeletedAt) < s.trashRetention {
+		return false
+	}
+
+	if err := s.removeTodo(string(key)); err != nil {
+		contextLog(ctx).WithError(err).WithField("key", string(key)).Error("error purging todo")
+		return false
+	}
+
+	return true
+}
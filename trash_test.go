@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prologic/bitcask"
+)
+
+func TestClearMovesTodoToTrash(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+
+	if w := serve(s, "POST", "/clear/0", nil); w.Code != 302 {
+		t.Fatalf("expected 302 clearing, got %d", w.Code)
+	}
+
+	if db.Has([]byte("todo_0")) {
+		t.Error("expected the cleared todo to be removed from the list")
+	}
+	trashed, err := s.loadTodoAt("trash_0")
+	if err != nil {
+		t.Fatalf("expected the todo under trash_0: %s", err)
+	}
+	if trashed.DeletedAt.IsZero() {
+		t.Error("expected DeletedAt to be set")
+	}
+	if n := todoGauges(s); n != 0 {
+		t.Errorf("expected no todos counted, got %d", n)
+	}
+
+	if w := serve(s, "GET", "/trash", nil); w.Code != 200 {
+		t.Errorf("expected 200 listing the trash, got %d", w.Code)
+	}
+
+	if w := serve(s, "POST", "/trash/0/restore", nil); w.Code != 302 {
+		t.Fatalf("expected 302 restoring, got %d", w.Code)
+	}
+	restored, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatalf("expected the todo back on the list: %s", err)
+	}
+	if !restored.DeletedAt.IsZero() {
+		t.Errorf("expected DeletedAt to be cleared, got %s", restored.DeletedAt)
+	}
+	if db.Has([]byte("trash_0")) {
+		t.Error("expected the restored todo to be removed from the trash")
+	}
+	if n := todoGauges(s); n != 1 {
+		t.Errorf("expected 1 todo counted, got %d", n)
+	}
+
+	if w := serve(s, "POST", "/trash/0/restore", nil); w.Code != 404 {
+		t.Errorf("expected 404 restoring a todo that is not in the trash, got %d", w.Code)
+	}
+}
+
+func TestClearCompletedMovesTodosToTrash(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+	addTestTodo(t, s, "walk the dog")
+	serve(s, "POST", "/done/0", nil)
+
+	if w := serve(s, "POST", "/clear/completed", url.Values{}); w.Code != 302 {
+		t.Fatalf("expected 302 clearing completed todos, got %d", w.Code)
+	}
+	if db.Has([]byte("todo_0")) || !db.Has([]byte("trash_0")) {
+		t.Error("expected the completed todo to be moved to the trash")
+	}
+	if !db.Has([]byte("todo_1")) {
+		t.Error("expected the open todo to stay on the list")
+	}
+}
+
+func TestTrashUndo(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+
+	serve(s, "POST", "/clear/0", nil)
+	if w := serve(s, "POST", "/undo", nil); w.Code != 302 {
+		t.Fatalf("expected 302 undoing, got %d", w.Code)
+	}
+
+	if _, err := s.loadTodo("", 0); err != nil {
+		t.Errorf("expected undo to bring the todo back: %s", err)
+	}
+	if db.Has([]byte("trash_0")) {
+		t.Error("expected undo to remove the todo from the trash")
+	}
+	if n := todoGauges(s); n != 1 {
+		t.Errorf("expected 1 todo counted, got %d", n)
+	}
+}
+
+func TestTrashDelete(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+	serve(s, "POST", "/clear/0", nil)
+
+	if w := serve(s, "POST", "/trash/0/delete", nil); w.Code != 302 {
+		t.Fatalf("expected 302 deleting, got %d", w.Code)
+	}
+	if _, err := s.loadTodoAt("trash_0"); !errors.Is(err, bitcask.ErrKeyNotFound) {
+		t.Errorf("expected the todo to be deleted for good, got %v", err)
+	}
+	if w := serve(s, "POST", "/trash/0/delete", nil); w.Code != 404 {
+		t.Errorf("expected 404 deleting it again, got %d", w.Code)
+	}
+}
+
+func TestClearCorruptedTodo(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	if err := db.Put([]byte("todo_0"), []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serve(s, "POST", "/clear/0", nil); w.Code != 302 {
+		t.Fatalf("expected 302 clearing, got %d", w.Code)
+	}
+	if db.Has([]byte("todo_0")) || db.Has([]byte("trash_0")) {
+		t.Error("expected the corrupted todo to be deleted right away")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db, withTrashRetention(24*time.Hour))
+
+	now := testTime
+	s.now = func() time.Time { return now }
+
+	for _, title := range []string{"old", "recent", "archived", "on the list"} {
+		addTestTodo(t, s, title)
+	}
+
+	if _, err := s.trashTodo("", todoNamespace, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.archiveTodo("", 2); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(12 * time.Hour)
+	if _, err := s.trashTodo("", todoNamespace, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the todo deleted a day ago has expired
+	now = testTime.Add(24 * time.Hour)
+	s.purgeTrash(context.Background(), now)
+
+	if db.Has([]byte("trash_0")) {
+		t.Error("expected the todo deleted a day ago to be purged")
+	}
+	if !db.Has([]byte("trash_1")) {
+		t.Error("expected the todo deleted 12 hours ago to be kept")
+	}
+
+	now = now.Add(12 * time.Hour)
+	s.purgeTrash(context.Background(), now)
+
+	if db.Has([]byte("trash_1")) {
+		t.Error("expected the second todo to be purged once it expired")
+	}
+	if !db.Has([]byte("archive_2")) {
+		t.Error("expected the archived todo never to be purged")
+	}
+	if !db.Has([]byte("todo_3")) {
+		t.Error("expected the todo on the list never to be purged")
+	}
+}
+
+func TestTrashIsKeptWithoutRetention(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+	serve(s, "POST", "/clear/0", nil)
+
+	s.purgeTrash(context.Background(), testTime.Add(24*365*time.Hour))
+
+	if !db.Has([]byte("trash_0")) {
+		t.Error("expected the trash never to be purged without a retention")
+	}
+}
+
+func TestDeletesMoveToTrash(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		request func() *http.Request
+	}{
+		{"api delete", func() *http.Request {
+			return newJSONRequest("DELETE", "/api/todos/0", "")
+		}},
+		{"api bulk delete", func() *http.Request {
+			return newJSONRequest("POST", "/api/todos/delete", `{"ids":[0]}`)
+		}},
+		{"bulk clear", func() *http.Request {
+			return newFormRequest("POST", "/bulk", url.Values{"action": {"clear"}, "ids": {"0"}})
+		}},
+		{"caldav delete", func() *http.Request {
+			return newFormRequest("DELETE", caldavCalendarPath+"0.ics", nil)
+		}},
+	} {
+		db := newMemoryStore()
+		s := newTestServer(t, db)
+		addTestTodo(t, s, "buy milk")
+
+		if w := serveRequest(s, tc.request()); w.Code >= 400 {
+			t.Fatalf("%s: expected the todo to be deleted, got %d: %s", tc.name, w.Code, w.Body.String())
+		}
+
+		if db.Has([]byte("todo_0")) {
+			t.Errorf("%s: expected the todo to be removed from the list", tc.name)
+		}
+		if _, err := s.loadTodoAt("trash_0"); err != nil {
+			t.Errorf("%s: expected the todo in the trash: %s", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// defaultUndoDepth is the number of actions that can be undone by
+	// default
+	defaultUndoDepth = 10
+
+	// flashCookie names a change just made, shown once on the next page
+	// with a button to undo it
+	flashCookie = "flash"
+
+	// flashMaxAge is how long a flash is kept if no page is shown
+	flashMaxAge = time.Minute
+)
+
+// flashMessages are the messages of the changes flashed
+var flashMessages = map[string]string{
+	"deleted":  "Todo deleted.",
+	"done":     "Todo marked done.",
+	"undone":   "Todo marked not done.",
+	"archived": "Todo archived.",
+	"trashed":  "Todo moved to the trash.",
+}
+
+// undoEntry records the state of a todo before a mutating action so the
+// action can be reverted. A nil before means the todo did not exist.
+type undoEntry struct {
+	key    string
+	before *Todo
+
+	// moved is the key the action moved the todo to, e.g. into the
+	// archive, which is removed again when it is undone
+	moved string
+}
+
+// undoStack holds the most recent undo entries of each scope (the key
+// prefix of a user in multi-user mode) up to a maximum depth
+type undoStack struct {
+	sync.Mutex
+
+	depth   int
+	entries map[string][]undoEntry
+}
+
+func newUndoStack(depth int) *undoStack {
+	return &undoStack{
+		depth:   depth,
+		entries: make(map[string][]undoEntry),
+	}
+}
+
+// Push records an entry dropping the oldest entry once the stack is full
+func (u *undoStack) Push(scope string, entry undoEntry) {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.depth <= 0 {
+		return
+	}
+
+	entries := append(u.entries[scope], entry)
+	if len(entries) > u.depth {
+		entries = entries[len(entries)-u.depth:]
+	}
+	u.entries[scope] = entries
+}
+
+// Pop removes and returns the most recent entry
+func (u *undoStack) Pop(scope string) (undoEntry, bool) {
+	u.Lock()
+	defer u.Unlock()
+
+	entries := u.entries[scope]
+	if len(entries) == 0 {
+		return undoEntry{}, false
+	}
+
+	entry := entries[len(entries)-1]
+	u.entries[scope] = entries[:len(entries)-1]
+	return entry, true
+}
+
+// Clear removes all entries of a scope
+func (u *undoStack) Clear(scope string) {
+	u.Lock()
+	defer u.Unlock()
+
+	delete(u.entries, scope)
+}
+
+// setFlash flashes the change named name on the next page, if changes can
+// be undone
+func (s *server) setFlash(w http.ResponseWriter, name string) {
+	if s.undo.depth <= 0 {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    name,
+		Path:     "/",
+		MaxAge:   int(flashMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// flashFromRequest returns the message of the change flashed to the
+// request, if any, clearing it so it is only shown once
+func flashFromRequest(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(flashCookie)
+	if err != nil {
+		return ""
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: flashCookie, Path: "/", MaxAge: -1})
+	return flashMessages[cookie.Value]
+}
+
+func (s *server) UndoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_undo")
+
+		entry, ok := s.undo.Pop(keyPrefix(r))
+		if !ok {
+			redirectBack(w, r)
+			return
+		}
+
+		s.writes.Lock()
+		defer s.writes.Unlock()
+
+		currentKey := entry.key
+		if entry.moved != "" {
+			currentKey = entry.moved
+		}
+
+		var current *Todo
+		if data, err := s.db.Get([]byte(currentKey)); err == nil {
+			current = &Todo{}
+			if err := s.codec.Unmarshal(data, current); err != nil {
+				current = nil
+			}
+		}
+
+		if entry.before == nil {
+			if err := s.removeTodo(entry.key); err != nil {
+				requestLog(r).WithError(err).WithField("key", entry.key).Error("error undoing add")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			// Restoring is a new revision so clients holding the undone
+			// one see a conflict
+			restored := *entry.before
+			if current != nil {
+				restored.Rev = current.Rev
+			}
+
+			if err := s.putTodo(entry.key, &restored); err != nil {
+				requestLog(r).WithError(err).WithField("key", entry.key).Error("error restoring todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if entry.moved != "" {
+			if err := s.removeTodo(entry.moved); err != nil {
+				requestLog(r).WithError(err).WithField("key", entry.moved).Error("error undoing move")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Only todos on the list are counted
+		if !todoKeyPattern.MatchString(currentKey) {
+			current = nil
+		}
+		before := entry.before
+		if !todoKeyPattern.MatchString(entry.key) {
+			before = nil
+		}
+		s.trackTodo(current, before)
+
+		redirectBack(w, r)
+	}
+}
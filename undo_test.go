@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUndoRestoresDeletedTodo(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+	addTestTodo(t, s, "walk the dog")
+
+	if w := serve(s, "DELETE", "/api/todos/0", nil); w.Code != 204 {
+		t.Fatalf("expected 204 deleting, got %d", w.Code)
+	}
+	if db.Has([]byte("todo_0")) {
+		t.Fatal("expected the todo to be deleted")
+	}
+
+	if w := serve(s, "POST", "/undo", nil); w.Code != 302 {
+		t.Fatalf("expected 302 undoing, got %d", w.Code)
+	}
+
+	todo, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatalf("expected undo to restore the todo under the same id: %s", err)
+	}
+	if todo.Title != "buy milk" {
+		t.Errorf("expected the deleted todo back, got %+v", todo)
+	}
+	if n := todoGauges(s); n != 2 {
+		t.Errorf("expected 2 todos counted, got %d", n)
+	}
+}
+
+func TestUndoDoneAndAdd(t *testing.T) {
+	db := newMemoryStore()
+	s := newTestServer(t, db)
+
+	addTestTodo(t, s, "buy milk")
+	serve(s, "POST", "/done/0", nil)
+
+	serve(s, "POST", "/undo", nil)
+	todo, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Done {
+		t.Error("expected undo to mark the todo not done again")
+	}
+
+	serve(s, "POST", "/undo", nil)
+	if db.Has([]byte("todo_0")) {
+		t.Error("expected undo to remove the added todo")
+	}
+
+	// Nothing is left to undo
+	if w := serve(s, "POST", "/undo", nil); w.Code != 302 {
+		t.Errorf("expected 302 with nothing to undo, got %d", w.Code)
+	}
+}
+
+func TestUndoStackDepth(t *testing.T) {
+	u := newUndoStack(2)
+
+	for _, key := range []string{"todo_0", "todo_1", "todo_2"} {
+		u.Push("", undoEntry{key: key})
+	}
+	u.Push("user_1_", undoEntry{key: "user_1_todo_0"})
+
+	for _, expected := range []string{"todo_2", "todo_1"} {
+		entry, ok := u.Pop("")
+		if !ok || entry.key != expected {
+			t.Errorf("expected %s, got %q", expected, entry.key)
+		}
+	}
+	if _, ok := u.Pop(""); ok {
+		t.Error("expected the oldest entry to be dropped")
+	}
+
+	if entry, ok := u.Pop("user_1_"); !ok || entry.key != "user_1_todo_0" {
+		t.Errorf("expected the other scope's entry to be kept, got %q", entry.key)
+	}
+}
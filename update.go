@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+)
+
+// errConflict is returned when a todo has changed since the client read it
+var errConflict = errors.New("todo has been modified")
+
+// etag returns the entity tag of the todo's current revision
+func etag(todo *Todo) string {
+	return fmt.Sprintf(`"%d"`, todo.Rev)
+}
+
+// checkRevision returns errConflict if the request was made from another
+// revision of the todo than its current one, given by the rev form field
+// or by its ETag in If-Match. Requests giving neither are not checked.
+func checkRevision(r *http.Request, todo *Todo) error {
+	if match := strings.TrimSpace(r.Header.Get("If-Match")); match != "" && match != "*" && match != etag(todo) {
+		return errConflict
+	}
+	if rev := r.FormValue("rev"); rev != "" && rev != strconv.Itoa(todo.Rev) {
+		return errConflict
+	}
+	return nil
+}
+
+// todoUpdate is the body of PUT and PATCH requests. Fields left out are
+// unchanged by PATCH and cleared by PUT.
+type todoUpdate struct {
+	Title    *string   `json:"title"`
+	Body     *string   `json:"body"`
+	Done     *bool     `json:"done"`
+	Color    *string   `json:"color"`
+	Tags     *[]string `json:"tags"`
+	Due      *string   `json:"due"`
+	Remind   *string   `json:"remind"`
+	Priority *string   `json:"priority"`
+
+	dueDate      time.Time
+	remindBefore time.Duration
+	priority     priority
+
+	// uid is the iCalendar UID of a todo created over CalDAV
+	uid string
+}
+
+// fill sets every field left out to its zero value so the update replaces
+// the whole todo
+func (u *todoUpdate) fill() {
+	if u.Title == nil {
+		u.Title = new(string)
+	}
+	if u.Body == nil {
+		u.Body = new(string)
+	}
+	if u.Done == nil {
+		u.Done = new(bool)
+	}
+	if u.Color == nil {
+		u.Color = new(string)
+	}
+	if u.Tags == nil {
+		u.Tags = &[]string{}
+	}
+	if u.Due == nil {
+		u.Due = new(string)
+	}
+	if u.Remind == nil {
+		u.Remind = new(string)
+	}
+	if u.Priority == nil {
+		u.Priority = new(string)
+	}
+}
+
+// normalize validates the update and brings its fields into their canonical
+// form the way adding a todo does
+func (u *todoUpdate) normalize(maxTitleLength int) error {
+	if u.Title != nil {
+		title := *u.Title
+		if len(title) > maxTitleLength {
+			title = title[:maxTitleLength]
+		}
+		if strings.TrimSpace(title) == "" {
+			return errors.New("title is required")
+		}
+		u.Title = &title
+	}
+
+	if u.Body != nil {
+		body, err := normalizeBody(*u.Body)
+		if err != nil {
+			return err
+		}
+		u.Body = &body
+	}
+
+	if u.Color != nil && *u.Color != "" {
+		color, ok := normalizeColor(*u.Color)
+		if !ok {
+			return fmt.Errorf("invalid color: %q", *u.Color)
+		}
+		u.Color = &color
+	}
+
+	if u.Tags != nil {
+		tags, err := normalizeTags(*u.Tags...)
+		if err != nil {
+			return err
+		}
+		u.Tags = &tags
+	}
+
+	if u.Due != nil && *u.Due != "" {
+		due, err := parseDueDate(*u.Due)
+		if err != nil {
+			return fmt.Errorf("invalid due date: %q", *u.Due)
+		}
+		u.dueDate = due
+	}
+
+	if u.Remind != nil && *u.Remind != "" {
+		remind, err := parseRemindBefore(*u.Remind)
+		if err != nil {
+			return err
+		}
+		u.remindBefore = remind
+	}
+
+	if u.Priority != nil {
+		p, err := parsePriority(*u.Priority)
+		if err != nil {
+			return err
+		}
+		u.priority = p
+	}
+
+	return nil
+}
+
+// apply changes the todo by the normalized update
+func (u *todoUpdate) apply(todo *Todo) {
+	if u.Title != nil {
+		todo.Title = *u.Title
+	}
+	if u.Body != nil {
+		todo.Body = *u.Body
+	}
+	if u.Done != nil {
+		todo.setDone(*u.Done)
+	}
+	if u.Color != nil {
+		todo.Color = *u.Color
+	}
+	if u.Tags != nil {
+		todo.Tags = *u.Tags
+	}
+	if u.Due != nil && !todo.DueDate.Equal(u.dueDate) {
+		todo.DueDate = u.dueDate
+		todo.RemindedAt = time.Time{}
+	}
+	if u.Remind != nil && todo.RemindBefore != u.remindBefore {
+		todo.RemindBefore = u.remindBefore
+		todo.RemindedAt = time.Time{}
+	}
+	if u.Priority != nil {
+		todo.Priority = u.priority
+	}
+	if u.uid != "" {
+		todo.UID = u.uid
+	}
+	todo.UpdatedAt = time.Now()
+}
+
+// UpdateTodoHandler replaces (PUT) or changes (PATCH) a todo. The request
+// must carry the todo's ETag in If-Match and fails with 409 Conflict if the
+// todo has been changed since, so concurrent updates are never lost.
+func (s *server) UpdateTodoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_api_update_todo")
+
+		id, err := strconv.ParseUint(p.ByName("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid id", http.StatusBadRequest)
+			return
+		}
+
+		match := strings.TrimSpace(r.Header.Get("If-Match"))
+		if match == "" {
+			http.Error(w, "Precondition Required: If-Match is required", http.StatusPreconditionRequired)
+			return
+		}
+
+		var u todoUpdate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&u); err != nil {
+			http.Error(w, "Bad Request: invalid todo", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPut {
+			u.fill()
+		}
+		if err := u.normalize(s.maxTitleLength); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		prefix := keyPrefix(r)
+		before, todo, err := s.updateTodo(prefix, id, func(todo *Todo) error {
+			if match != "*" && match != etag(todo) {
+				return errConflict
+			}
+			u.apply(todo)
+			return nil
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, bitcask.ErrKeyNotFound):
+				http.Error(w, "Not Found: no such todo", http.StatusNotFound)
+			case errors.Is(err, errConflict):
+				http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+			default:
+				requestLog(r).WithError(err).WithField("id", id).Error("error updating todo")
+				http.Error(w, "Internal Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.trackTodo(before, todo)
+		s.undo.Push(prefix, undoEntry{key: fmt.Sprintf("%stodo_%d", prefix, id), before: before})
+		if !before.Done && todo.Done {
+			s.notifyAsync(r, eventCompleted, todo)
+		}
+
+		w.Header().Set("ETag", etag(todo))
+		writeJSON(w, r, http.StatusOK, todo)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// updateTestTodo sends an API update of todo 0 with the given If-Match
+func updateTestTodo(s *server, method, match, body string) (int, string, *Todo) {
+	r := newJSONRequest(method, "/api/todos/0", body)
+	if match != "" {
+		r.Header.Set("If-Match", match)
+	}
+
+	w := serveRequest(s, r)
+	if w.Code != 200 {
+		return w.Code, "", nil
+	}
+
+	var todo Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		return 0, "", nil
+	}
+	return w.Code, w.Header().Get("ETag"), &todo
+}
+
+func TestUpdateRevisions(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	todo := addTestTodo(t, s, "buy milk")
+
+	w := serve(s, "GET", "/api/todos/0", nil)
+	first := w.Header().Get("ETag")
+	if first != etag(todo) {
+		t.Fatalf("expected the ETag %s, got %s", etag(todo), first)
+	}
+
+	code, second, updated := updateTestTodo(s, "PATCH", first, `{"done":true}`)
+	if code != 200 {
+		t.Fatalf("expected 200 updating with the current ETag, got %d", code)
+	}
+	if second == first || updated.Rev != todo.Rev+1 {
+		t.Errorf("expected the revision to be bumped, got %s (rev %d)", second, updated.Rev)
+	}
+	if !updated.Done || updated.Title != "buy milk" {
+		t.Errorf("expected PATCH to change only done, got %+v", updated)
+	}
+
+	// A client still holding the first revision must not overwrite the
+	// second
+	if code, _, _ := updateTestTodo(s, "PUT", first, `{"title":"walk the dog"}`); code != 409 {
+		t.Errorf("expected 409 updating with a stale ETag, got %d", code)
+	}
+	current, err := s.loadTodo("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Title != "buy milk" {
+		t.Errorf("expected the conflicting update to be rejected, got %+v", current)
+	}
+
+	code, _, updated = updateTestTodo(s, "PUT", second, `{"title":"walk the dog"}`)
+	if code != 200 {
+		t.Fatalf("expected 200 updating with the new ETag, got %d", code)
+	}
+	if updated.Title != "walk the dog" || updated.Done {
+		t.Errorf("expected PUT to replace the whole todo, got %+v", updated)
+	}
+
+	if code, _, _ := updateTestTodo(s, "PATCH", "*", `{"done":true}`); code != 200 {
+		t.Errorf("expected 200 updating with If-Match: *, got %d", code)
+	}
+}
+
+func TestUpdateRequiresIfMatch(t *testing.T) {
+	s := newTestServer(t, newMemoryStore())
+	addTestTodo(t, s, "buy milk")
+
+	if code, _, _ := updateTestTodo(s, "PATCH", "", `{"done":true}`); code != 428 {
+		t.Errorf("expected 428 without If-Match, got %d", code)
+	}
+}
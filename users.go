@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prologic/bitcask"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// tokenCookie is the name of the cookie holding the session token
+	tokenCookie = "token"
+
+	// minPasswordLength is the minimum length of a user's password
+	minPasswordLength = 8
+)
+
+var validUsername = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,32}$`)
+
+// errUserExists is returned when registering a username that is taken
+var errUserExists = errors.New("username already taken")
+
+func userKey(username string) []byte {
+	return []byte(fmt.Sprintf("users_%s", username))
+}
+
+func (s *server) getUser(username string) (*User, error) {
+	data, err := s.db.Get(userKey(username))
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// basicAuthUser returns the user whose username and either password or an
+// API token the request carries with HTTP Basic authentication, or nil if
+// it carries no valid credentials
+func (s *server) basicAuthUser(r *http.Request) (*User, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok || password == "" {
+		return nil, nil
+	}
+
+	user, err := s.userByToken(password)
+	if err != nil || user != nil {
+		if user != nil && user.Username != username {
+			return nil, nil
+		}
+		return user, err
+	}
+
+	user, err = s.getUser(username)
+	if err != nil {
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(user.Password, []byte(password)) != nil {
+		return nil, nil
+	}
+
+	return user, nil
+}
+
+// createUser registers a new user, or returns errUserExists if the
+// username is taken. Registrations are serialized so two concurrent
+// registrations of the same username cannot overwrite each other.
+func (s *server) createUser(username, password string) (*User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	s.accounts.Lock()
+	defer s.accounts.Unlock()
+
+	if s.db.Has(userKey(username)) {
+		return nil, errUserExists
+	}
+
+	id, err := s.allocateID("nextuserid")
+	if err != nil {
+		return nil, err
+	}
+
+	user := newUser(username, hash)
+	user.ID = id
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Put(userKey(username), data); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *server) setSession(w http.ResponseWriter, user *User) error {
+	token, err := encodeJWT(s.jwtSecret, newClaims(user, s.jwtExpiry))
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(s.jwtExpiry),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+func (s *server) LoginHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if r.Method == http.MethodGet {
+			s.render("login", w, r, &templateContext{})
+			return
+		}
+
+		s.counters.Inc("n_login")
+
+		username := r.FormValue("username")
+		password := r.FormValue("password")
+
+		user, err := s.getUser(username)
+		if err != nil && err != bitcask.ErrKeyNotFound {
+			requestLog(r).WithError(err).WithField("username", username).Error("error getting user")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if user == nil || bcrypt.CompareHashAndPassword(user.Password, []byte(password)) != nil {
+			requestLog(r).WithField("username", username).Warn("failed login attempt")
+			s.renderStatus("login", http.StatusUnauthorized, w, r, &templateContext{Error: "Invalid username or password"})
+			return
+		}
+
+		if err := s.setSession(w, user); err != nil {
+			requestLog(r).WithError(err).Error("error creating session")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+func (s *server) RegisterHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_register")
+
+		username := r.FormValue("username")
+		password := r.FormValue("password")
+
+		if !validUsername.MatchString(username) {
+			s.renderStatus("login", http.StatusBadRequest, w, r, &templateContext{Error: "Invalid username"})
+			return
+		}
+
+		if len(password) < minPasswordLength {
+			s.renderStatus("login", http.StatusBadRequest, w, r, &templateContext{
+				Error: fmt.Sprintf("Password must be at least %d characters", minPasswordLength),
+			})
+			return
+		}
+
+		user, err := s.createUser(username, password)
+		if errors.Is(err, errUserExists) {
+			s.renderStatus("login", http.StatusConflict, w, r, &templateContext{Error: "Username already taken"})
+			return
+		}
+		if err != nil {
+			requestLog(r).WithError(err).WithField("username", username).Error("error creating user")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.setSession(w, user); err != nil {
+			requestLog(r).WithError(err).Error("error creating session")
+			http.Error(w, "Internal Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+func (s *server) LogoutHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}
+}
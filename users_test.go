@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginRegisterErrors(t *testing.T) {
+	s := newTestServer(t, newMemoryStore(), withMultiUser("secret", time.Hour))
+	if _, err := s.createUser("alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target, username, password string
+		expected                   int
+		message                    string
+	}{
+		{"/login", "alice", "wrong horse", http.StatusUnauthorized, "Invalid username or password"},
+		{"/login", "bob", "correct horse", http.StatusUnauthorized, "Invalid username or password"},
+		{"/register", "not a name!", "correct horse", http.StatusBadRequest, "Invalid username"},
+		{"/register", "bob", "short", http.StatusBadRequest, "Password must be at least"},
+		{"/register", "alice", "correct horse", http.StatusConflict, "Username already taken"},
+	} {
+		w := serve(s, "POST", tc.target, url.Values{"username": {tc.username}, "password": {tc.password}})
+		if w.Code != tc.expected {
+			t.Errorf("expected %d from %s as %q, got %d", tc.expected, tc.target, tc.username, w.Code)
+		}
+		// The headers set rendering the page are sent with the status
+		if cc := w.Result().Header.Get("Cache-Control"); cc != "private, no-cache" {
+			t.Errorf("expected the login page not to be cached, got %q", cc)
+		}
+		if !strings.Contains(w.Body.String(), tc.message) {
+			t.Errorf("expected %q on the login page, got %q", tc.message, w.Body.String())
+		}
+	}
+}
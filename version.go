@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Build information, set at build time with e.g.
+// -ldflags "-X main.version=1.2.3 -X main.commit=abc123 -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// versionHeader is the response header carrying the running version
+const versionHeader = "X-App-Version"
+
+// versionString describes the running build
+func versionString() string {
+	return fmt.Sprintf("todo %s (commit %s, built %s)", version, commit, buildDate)
+}
+
+// withVersion adds the running version to every response
+func withVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(versionHeader, version)
+		next.ServeHTTP(w, r)
+	})
+}
+
+type healthResponse struct {
+	Status    string `json:"status"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// HealthHandler reports that the server is up along with its version
+func (s *server) HealthHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		writeJSON(w, r, http.StatusOK, healthResponse{
+			Status:    "ok",
+			Version:   version,
+			Commit:    commit,
+			BuildDate: buildDate,
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// webhookAttempts is how many times delivering an event to a webhook
+	// is tried before giving up
+	webhookAttempts = 3
+
+	// webhookRetryDelay is how long to wait before retrying a failed
+	// delivery, doubled for every further retry
+	webhookRetryDelay = time.Second
+
+	// webhookLogSize is the number of recent deliveries kept in the
+	// delivery log
+	webhookLogSize = 100
+
+	// webhookSignatureHeader carries the HMAC-SHA256 of the payload keyed
+	// with the webhook secret
+	webhookSignatureHeader = "X-Todo-Signature"
+)
+
+// webhookPayload is the JSON body posted to webhooks
+type webhookPayload struct {
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Actor string    `json:"actor,omitempty"`
+	Time  time.Time `json:"time"`
+	Todo  *Todo     `json:"todo"`
+}
+
+// webhookDelivery records the outcome of delivering an event to a webhook
+type webhookDelivery struct {
+	ID       string    `json:"id"`
+	URL      string    `json:"url"`
+	Event    string    `json:"event"`
+	TodoID   uint64    `json:"todo_id"`
+	Time     time.Time `json:"time"`
+	Attempts int       `json:"attempts"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// webhookLog keeps the most recent webhook deliveries in memory
+type webhookLog struct {
+	sync.Mutex
+
+	deliveries []webhookDelivery
+}
+
+// Add records a delivery dropping the oldest once the log is full
+func (l *webhookLog) Add(d webhookDelivery) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.deliveries = append(l.deliveries, d)
+	if len(l.deliveries) > webhookLogSize {
+		l.deliveries = l.deliveries[len(l.deliveries)-webhookLogSize:]
+	}
+}
+
+// Recent returns the deliveries in the log, most recent first
+func (l *webhookLog) Recent() []webhookDelivery {
+	l.Lock()
+	defer l.Unlock()
+
+	deliveries := make([]webhookDelivery, 0, len(l.deliveries))
+	for i := len(l.deliveries) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, l.deliveries[i])
+	}
+	return deliveries
+}
+
+// signPayload returns the signature of a payload sent in
+// webhookSignatureHeader
+func signPayload(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhook posts every event it is notified of to a URL, signed with the
+// secret if there is one, retrying failed deliveries
+type webhook struct {
+	url    string
+	secret string
+	client *http.Client
+	log    *webhookLog
+}
+
+func newWebhook(url, secret string, log *webhookLog) *webhook {
+	return &webhook{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: notifyTimeout},
+		log:    log,
+	}
+}
+
+func (wh *webhook) Notify(ctx context.Context, n notification) error {
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	data, err := json.Marshal(webhookPayload{ID: id, Event: n.Event, Actor: n.Actor, Time: now, Todo: n.Todo})
+	if err != nil {
+		return err
+	}
+
+	d := webhookDelivery{ID: id, URL: wh.url, Event: n.Event, TodoID: n.Todo.ID, Time: now}
+
+	delay := webhookRetryDelay
+	for {
+		d.Attempts++
+		d.Status, err = wh.post(ctx, id, n.Event, data)
+		if err == nil || !retryable(d.Status) || d.Attempts == webhookAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delay *= 2
+	}
+
+	if err != nil {
+		d.Error = err.Error()
+	}
+	wh.log.Add(d)
+
+	return err
+}
+
+// post sends a payload to the webhook returning the response's status,
+// which is 0 if there was no response
+func (wh *webhook) post(ctx context.Context, id, event string, data []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, wh.url, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo/"+version)
+	req.Header.Set("X-Todo-Event", event)
+	req.Header.Set("X-Todo-Delivery", id)
+	if wh.secret != "" {
+		req.Header.Set(webhookSignatureHeader, signPayload(wh.secret, data))
+	}
+
+	res, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("webhook returned %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// retryable reports whether a delivery that failed with the status may
+// succeed if tried again
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+type webhooksResponse struct {
+	Deliveries []webhookDelivery `json:"deliveries"`
+}
+
+// WebhooksHandler returns the log of recent webhook deliveries
+func (s *server) WebhooksHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		s.counters.Inc("n_admin_webhooks")
+
+		deliveries := []webhookDelivery{}
+		if s.webhooks != nil {
+			deliveries = s.webhooks.Recent()
+		}
+
+		writeJSON(w, r, http.StatusOK, webhooksResponse{Deliveries: deliveries})
+	}
+}